@@ -0,0 +1,173 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package v1
+
+/*
+ * This file contains the functions which are used to interpret the scheduled
+ * backups of the directory data, and the backup from which a new deployment
+ * is restored.
+ */
+
+/*****************************************************************************/
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+/*****************************************************************************/
+
+/*
+ * The predefined schedules which are supported by the CronJob controller, in
+ * addition to the standard five field cron format.
+ */
+
+var BackupScheduleMacros = []string{
+	"@yearly",
+	"@annually",
+	"@monthly",
+	"@weekly",
+	"@daily",
+	"@midnight",
+	"@hourly",
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the PVC of the replica from
+ * which the backups will be taken.  If no replica has been specified in the
+ * backup the specified principal is used, falling back to the first of the
+ * replicas if there is no principal.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetBackupReplica(
+						principal string) string {
+
+	if s.Backup == nil {
+		return ""
+	}
+
+	if s.Backup.Replica != "" {
+		return s.Backup.Replica
+	}
+
+	if principal != "" {
+		for _, pvcName := range s.Replicas.PVCs {
+			if pvcName == principal {
+				return principal
+			}
+		}
+	}
+
+	if s.Replicas.Principal != "" {
+		return s.Replicas.Principal
+	}
+
+	if len(s.Replicas.PVCs) > 0 {
+		return s.Replicas.PVCs[0]
+	}
+
+	return ""
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to validate the backup section of the
+ * document.  The existence of the backup PVC is validated separately, along
+ * with the other PVCs of the document.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) ValidateBackup() error {
+	if s.Backup == nil {
+		return nil
+	}
+
+	if s.Backup.PVC == "" {
+		return errors.New("A PVC must be specified in spec.backup.pvc.")
+	}
+
+	if s.Backup.Replica != "" {
+		found := false
+
+		for _, pvcName := range s.Replicas.PVCs {
+			if pvcName == s.Backup.Replica {
+				found = true
+			}
+		}
+
+		if !found {
+			return errors.New(fmt.Sprintf("The backup replica, %s, is not " +
+				"one of the PVCs which is specified in spec.replicas.pvcs.",
+				s.Backup.Replica))
+		}
+	}
+
+	if s.Backup.Retention < 0 {
+		return errors.New(fmt.Sprintf("The backup retention, %d, must be " +
+				"at least 1.", s.Backup.Retention))
+	}
+
+	/*
+	 * The schedule must either be one of the predefined schedules, or
+	 * must contain the five fields of the standard cron format.
+	 */
+
+	schedule := strings.TrimSpace(s.Backup.Schedule)
+
+	if strings.HasPrefix(schedule, "@") {
+		for _, macro := range BackupScheduleMacros {
+			if strings.EqualFold(schedule, macro) {
+				return nil
+			}
+		}
+	} else if len(strings.Fields(schedule)) == 5 {
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("The backup schedule, %s, is not a valid " +
+			"cron schedule.", s.Backup.Schedule))
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to validate the restore section of the
+ * document.  The existence of the restore PVC is validated separately, along
+ * with the other PVCs of the document.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) ValidateRestore() error {
+	if s.Restore == nil {
+		return nil
+	}
+
+	if s.Restore.PVC == "" {
+		return errors.New("A PVC must be specified in spec.restore.pvc.")
+	}
+
+	/*
+	 * The path must be a directory within the PVC.
+	 */
+
+	location := path.Clean(s.Restore.Path)
+
+	if s.Restore.Path == "" || path.IsAbs(location) || location == "." ||
+					location == ".." || strings.HasPrefix(location, "../") {
+		return errors.New(fmt.Sprintf("The restore path, %s, must be a " +
+			"directory which is relative to the root of the PVC.", 
+			s.Restore.Path))
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,449 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package v1
+
+/*
+ * This file contains the functions which are used to interpret the replica
+ * groups and the partitioning of the suffixes.  The replicas which serve the
+ * same data (i.e. whose groups are linked by a split of a suffix) form a
+ * replication domain, and replication agreements are only created between the
+ * replicas of the same domain.
+ */
+
+/*****************************************************************************/
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the name of the group to which
+ * the specified replica belongs.  An empty string is returned if the replica
+ * does not belong to a group.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetReplicaGroup(pvcName string) string {
+	for _, group := range s.Replicas.Groups {
+		for _, member := range group.PVCs {
+			if member == pvcName {
+				return group.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the PVCs of the replicas which
+ * belong to the specified group, in the order in which they appear in
+ * spec.replicas.pvcs.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetGroupPVCs(name string) []string {
+	var pvcs []string
+
+	for _, pvcName := range s.Replicas.PVCs {
+		if s.GetReplicaGroup(pvcName) == name {
+			pvcs = append(pvcs, pvcName)
+		}
+	}
+
+	return pvcs
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the PVCs of the replicas which
+ * are in the same replication domain as the specified replica, including the
+ * replica itself, in the order in which they appear in spec.replicas.pvcs.
+ * If no partitions are defined all of the replicas are in the same domain.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetReplicationDomain(
+						pvcName string) []string {
+
+	if len(s.Partitions) == 0 {
+		return s.Replicas.PVCs
+	}
+
+	roots  := s.getDomainRoots()
+	domain := roots[s.GetReplicaGroup(pvcName)]
+
+	var pvcs []string
+
+	for _, member := range s.Replicas.PVCs {
+		if member == pvcName ||
+				(domain != "" && roots[s.GetReplicaGroup(member)] == domain) {
+			pvcs = append(pvcs, member)
+		}
+	}
+
+	return pvcs
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the two specified
+ * replicas are in the same replication domain.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) IsSameReplicationDomain(
+						pvcA string, pvcB string) bool {
+
+	for _, member := range s.GetReplicationDomain(pvcA) {
+		if member == pvcB {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to work out the replication domain of each
+ * group.  Each group is mapped to the name of the first group of its domain,
+ * in the order in which the groups appear in spec.replicas.groups, where the
+ * groups of each split of a suffix are in the same domain.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) getDomainRoots() map[string]string {
+	roots := make(map[string]string)
+	order := make(map[string]int)
+
+	for idx, group := range s.Replicas.Groups {
+		roots[group.Name] = group.Name
+		order[group.Name] = idx
+	}
+
+	var find func(name string) string
+
+	find = func(name string) string {
+		if roots[name] == name || roots[name] == "" {
+			return name
+		}
+
+		return find(roots[name])
+	}
+
+	for _, partition := range s.Partitions {
+		for _, split := range partition.Splits {
+			for _, name := range split.Groups {
+				rootA := find(split.Groups[0])
+				rootB := find(name)
+
+				if rootA == rootB {
+					continue
+				}
+
+				if order[rootB] < order[rootA] {
+					rootA, rootB = rootB, rootA
+				}
+
+				roots[rootB] = rootA
+			}
+		}
+	}
+
+	for name := range roots {
+		roots[name] = find(name)
+	}
+
+	return roots
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to validate the replica groups and the
+ * partitions of the document.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) ValidatePartitions() error {
+	pvcs := make(map[string]bool)
+
+	for _, pvcName := range s.Replicas.PVCs {
+		pvcs[pvcName] = true
+	}
+
+	/*
+	 * Validate the groups.  Each PVC can only belong to a single group.
+	 */
+
+	groups  := make(map[string]bool)
+	members := make(map[string]string)
+
+	for _, group := range s.Replicas.Groups {
+		if group.Name == "" {
+			return errors.New("Each entry in spec.replicas.groups must " +
+							"have a name.")
+		}
+
+		if groups[group.Name] {
+			return errors.New(fmt.Sprintf("The replica group, %s, is " +
+							"defined more than once.", group.Name))
+		}
+
+		groups[group.Name] = true
+
+		if group.Zone != "" && 
+				len(validation.IsDNS1123Label(strings.ToLower(group.Zone))) > 0 {
+			return errors.New(fmt.Sprintf("The zone, %s, of the replica " +
+				"group, %s, is not a valid zone name.", group.Zone, 
+				group.Name))
+		}
+
+		for _, pvcName := range group.PVCs {
+			if !pvcs[pvcName] {
+				return errors.New(fmt.Sprintf("The PVC, %s, of the replica " +
+					"group, %s, is not one of the PVCs which is specified " +
+					"in spec.replicas.pvcs.", pvcName, group.Name))
+			}
+
+			if other, ok := members[pvcName]; ok {
+				return errors.New(fmt.Sprintf("The PVC, %s, belongs to more " +
+					"than one replica group: %s, %s.", pvcName, other,
+					group.Name))
+			}
+
+			members[pvcName] = group.Name
+		}
+	}
+
+	/*
+	 * In the Online seed mode the new replicas are seeded from the seed
+	 * volume of the running principal, and so the seed jobs must be 
+	 * scheduled on the node of the principal.  This is only possible if 
+	 * every replica is placed in the same zone, and if the seed volume can
+	 * be mounted by more than one pod.
+	 */
+
+	if s.Replicas.SeedMode == SeedModeOnline {
+		zones := s.GetZones()
+
+		if len(zones) > 1 {
+			return errors.New("The Online seed mode cannot be used when " +
+				"the replicas are placed in more than one zone, as the seed " +
+				"volume of the principal can only be mounted in its own zone.")
+		}
+
+		if s.Replicas.VolumeClaimTemplate != nil &&
+			! IsSharedAccessMode(s.Replicas.VolumeClaimTemplate.AccessModes) {
+			return errors.New("The Online seed mode cannot be used with " +
+				"the access modes of spec.replicas.volumeClaimTemplate, as " +
+				"the seed volume of the principal must be mounted by the " +
+				"seed jobs of the new replicas while the principal is " +
+				"running.")
+		}
+
+		if len(zones) == 1 {
+			for _, pvcName := range s.Replicas.PVCs {
+				if s.GetReplicaZone(pvcName) == "" {
+					return errors.New(fmt.Sprintf("The Online seed mode " +
+						"cannot be used when the replicas are placed in a " +
+						"zone and the PVC, %s, has not been placed in the " +
+						"zone.", pvcName))
+				}
+			}
+		}
+	}
+
+	if len(s.Partitions) == 0 {
+		return nil
+	}
+
+	/*
+	 * Validate the partitions.  Each replica must belong to a group, each
+	 * suffix can only be partitioned once, and each group must serve at
+	 * least one split.
+	 */
+
+	for _, pvcName := range s.Replicas.PVCs {
+		if _, ok := members[pvcName]; !ok {
+			return errors.New(fmt.Sprintf("The PVC, %s, does not belong to " +
+				"a replica group.  Each replica must belong to a group when " +
+				"spec.partitions is specified.", pvcName))
+		}
+	}
+
+	suffixes := make(map[string]bool)
+	used     := make(map[string]bool)
+
+	for _, partition := range s.Partitions {
+		suffix := strings.ToLower(partition.Suffix)
+
+		if suffixes[suffix] {
+			return errors.New(fmt.Sprintf("The suffix, %s, is partitioned " +
+					"more than once.", partition.Suffix))
+		}
+
+		suffixes[suffix] = true
+
+		if len(partition.Splits) == 0 {
+			return errors.New(fmt.Sprintf("The partition of the suffix, %s, " +
+					"does not contain any splits.", partition.Suffix))
+		}
+
+		for _, split := range partition.Splits {
+			if len(split.Groups) == 0 {
+				return errors.New(fmt.Sprintf("A split of the suffix, %s, " +
+					"does not contain any replica groups.", partition.Suffix))
+			}
+
+			for _, name := range split.Groups {
+				if !groups[name] {
+					return errors.New(fmt.Sprintf("The replica group, %s, " +
+						"which is used by the suffix, %s, is not defined in " +
+						"spec.replicas.groups.", name, partition.Suffix))
+				}
+
+				used[name] = true
+			}
+		}
+	}
+
+	for _, group := range s.Replicas.Groups {
+		if !used[group.Name] {
+			return errors.New(fmt.Sprintf("The replica group, %s, does not " +
+				"serve any of the partitions.", group.Name))
+		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to validate that the partitions cover each
+ * of the specified suffixes from the server configuration, and only those
+ * suffixes.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) ValidatePartitionSuffixes(
+						suffixes []string) error {
+
+	if len(s.Partitions) == 0 {
+		return nil
+	}
+
+	for _, suffix := range suffixes {
+		if s.GetPartition(suffix) == nil {
+			return errors.New(fmt.Sprintf("The suffix, %s, is not included " +
+					"in spec.partitions.", suffix))
+		}
+	}
+
+	for _, partition := range s.Partitions {
+		found := false
+
+		for _, suffix := range suffixes {
+			if strings.EqualFold(suffix, partition.Suffix) {
+				found = true
+			}
+		}
+
+		if !found {
+			return errors.New(fmt.Sprintf("The partitioned suffix, %s, is " +
+					"not defined in the server configuration.",
+					partition.Suffix))
+		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the partition for the
+ * specified suffix.  Nil is returned if the suffix is not partitioned.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetPartition(
+				suffix string) *IBMSecurityVerifyDirectoryPartition {
+
+	for idx := range s.Partitions {
+		if strings.EqualFold(s.Partitions[idx].Suffix, suffix) {
+			return &s.Partitions[idx]
+		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+
+/*
+ * The following function is used to retrieve the sorted list of zones in
+ * which the replica groups have been placed.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetZones() []string {
+	var zones []string
+
+	for _, group := range s.Replicas.Groups {
+		zone := strings.ToLower(group.Zone)
+
+		if zone == "" {
+			continue
+		}
+
+		found := false
+
+		for _, existing := range zones {
+			if existing == zone {
+				found = true
+			}
+		}
+
+		if !found {
+			zones = append(zones, zone)
+		}
+	}
+
+	sort.Strings(zones)
+
+	return zones
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the zone of the group to which
+ * the specified replica belongs.  An empty string is returned if the replica
+ * has not been placed in a zone.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetReplicaZone(pvcName string) string {
+	name := s.GetReplicaGroup(pvcName)
+
+	for _, group := range s.Replicas.Groups {
+		if group.Name == name {
+			return strings.ToLower(group.Zone)
+		}
+	}
+
+	return ""
+}
+
+/*****************************************************************************/
+
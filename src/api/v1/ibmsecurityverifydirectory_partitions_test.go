@@ -0,0 +1,245 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package v1
+
+/*
+ * This file contains the tests for the interpretation of the replica groups
+ * and the partitioning of the suffixes.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to construct a spec which contains the
+ * groups: ga (a1, a2), gb (b1), gc (c1) and gd (d1).  The o=sample suffix is
+ * split between ga and the combination of gb and gc, and the o=other suffix
+ * is served by gd.  The replica, x1, does not belong to a group.
+ */
+
+func newPartitionedSpec() *IBMSecurityVerifyDirectorySpec {
+	return &IBMSecurityVerifyDirectorySpec{
+		Replicas: IBMSecurityVerifyDirectoryReplica{
+			PVCs:   []string{"a1", "b1", "a2", "c1", "d1", "x1"},
+			Groups: []IBMSecurityVerifyDirectoryReplicaGroup{
+				{Name: "ga", PVCs: []string{"a1", "a2"}},
+				{Name: "gb", PVCs: []string{"b1"}},
+				{Name: "gc", PVCs: []string{"c1"}},
+				{Name: "gd", PVCs: []string{"d1"}},
+			},
+		},
+		Partitions: []IBMSecurityVerifyDirectoryPartition{
+			{
+				Suffix: "o=sample",
+				Splits: []IBMSecurityVerifyDirectorySplit{
+					{Groups: []string{"ga"}},
+					{Groups: []string{"gb", "gc"}},
+				},
+			},
+			{
+				Suffix: "o=other",
+				Splits: []IBMSecurityVerifyDirectorySplit{
+					{Groups: []string{"gd"}},
+				},
+			},
+		},
+	}
+}
+
+/*****************************************************************************/
+
+var _ = Describe("GetGroupPVCs", func() {
+	DescribeTable("returns the members of a group in spec order",
+		func(group string, expected []string) {
+			Expect(newPartitionedSpec().GetGroupPVCs(group)).To(
+							Equal(expected))
+		},
+
+		Entry("a group with several members", "ga", []string{"a1", "a2"}),
+		Entry("a group with a single member", "gd", []string{"d1"}),
+		Entry("an unknown group",             "gz", []string(nil)),
+		Entry("the replicas without a group", "",   []string{"x1"}),
+	)
+})
+
+/*****************************************************************************/
+
+var _ = Describe("getDomainRoots", func() {
+	DescribeTable("maps each group to the first group of its domain",
+		func(modify func(spec *IBMSecurityVerifyDirectorySpec),
+					expected map[string]string) {
+			spec := newPartitionedSpec()
+
+			if modify != nil {
+				modify(spec)
+			}
+
+			Expect(spec.getDomainRoots()).To(Equal(expected))
+		},
+
+		Entry("groups which are linked by a split", nil,
+			map[string]string{
+				"ga": "ga", "gb": "gb", "gc": "gb", "gd": "gd"}),
+
+		Entry("groups which are linked through several partitions",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Partitions = append(spec.Partitions,
+					IBMSecurityVerifyDirectoryPartition{
+						Suffix: "o=third",
+						Splits: []IBMSecurityVerifyDirectorySplit{
+							{Groups: []string{"gd", "gc"}},
+						},
+					})
+			},
+			map[string]string{
+				"ga": "ga", "gb": "gb", "gc": "gb", "gd": "gb"}),
+
+		Entry("no partitions",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Partitions = nil
+			},
+			map[string]string{
+				"ga": "ga", "gb": "gb", "gc": "gc", "gd": "gd"}),
+	)
+})
+
+/*****************************************************************************/
+
+var _ = Describe("GetReplicationDomain", func() {
+	DescribeTable("returns the replicas which serve the same data",
+		func(partitioned bool, pvcName string, expected []string) {
+			spec := newPartitionedSpec()
+
+			if !partitioned {
+				spec.Partitions = nil
+			}
+
+			Expect(spec.GetReplicationDomain(pvcName)).To(Equal(expected))
+		},
+
+		Entry("a replica of a group on its own",    true, "a2",
+				[]string{"a1", "a2"}),
+		Entry("a replica of a linked group",        true, "c1",
+				[]string{"b1", "c1"}),
+		Entry("a replica without a group",          true, "x1",
+				[]string{"x1"}),
+		Entry("a replica when nothing is partitioned", false, "d1",
+				[]string{"a1", "b1", "a2", "c1", "d1", "x1"}),
+	)
+
+	It("determines whether two replicas are in the same domain", func() {
+		spec := newPartitionedSpec()
+
+		Expect(spec.IsSameReplicationDomain("b1", "c1")).To(BeTrue())
+		Expect(spec.IsSameReplicationDomain("a1", "b1")).To(BeFalse())
+	})
+})
+
+/*****************************************************************************/
+
+var _ = Describe("ValidatePartitions", func() {
+	DescribeTable("validates the groups and partitions",
+		func(modify func(spec *IBMSecurityVerifyDirectorySpec),
+					message string) {
+			spec := newPartitionedSpec()
+
+			/*
+			 * Every replica must belong to a group when the suffixes are
+			 * partitioned, and so x1 is placed in the group gd.
+			 */
+
+			spec.Replicas.Groups[3].PVCs = []string{"d1", "x1"}
+
+			modify(spec)
+
+			err := spec.ValidatePartitions()
+
+			if message == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			}
+		},
+
+		Entry("a valid spec",
+			func(spec *IBMSecurityVerifyDirectorySpec) {}, ""),
+
+		Entry("a group without a name",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Replicas.Groups[0].Name = ""
+			}, "must have a name"),
+
+		Entry("a PVC in more than one group",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Replicas.Groups[1].PVCs = []string{"b1", "a1"}
+			}, "belongs to more than one replica group"),
+
+		Entry("a replica without a group",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Replicas.Groups[3].PVCs = []string{"d1"}
+			}, "does not belong to a replica group"),
+
+		Entry("a suffix which is partitioned twice",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Partitions[1].Suffix = "O=Sample"
+			}, "is partitioned more than once"),
+
+		Entry("an unknown group in a split",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Partitions[1].Splits[0].Groups = []string{"gz"}
+			}, "is not defined in spec.replicas.groups"),
+
+		Entry("the Online seed mode across zones",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Replicas.SeedMode       = SeedModeOnline
+				spec.Replicas.Groups[0].Zone = "zone-a"
+				spec.Replicas.Groups[1].Zone = "zone-b"
+			}, "more than one zone"),
+
+		Entry("the Online seed mode with the ReadWriteOncePod access mode",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Replicas.SeedMode            = SeedModeOnline
+				spec.Replicas.VolumeClaimTemplate =
+						&IBMSecurityVerifyDirectoryVolumeClaimTemplate{
+					AccessModes: []corev1.PersistentVolumeAccessMode{
+						corev1.ReadWriteOncePod,
+					},
+				}
+			}, "access modes"),
+
+		Entry("the Online seed mode with the ReadWriteOnce access mode",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Replicas.SeedMode            = SeedModeOnline
+				spec.Replicas.VolumeClaimTemplate =
+						&IBMSecurityVerifyDirectoryVolumeClaimTemplate{
+					AccessModes: []corev1.PersistentVolumeAccessMode{
+						corev1.ReadWriteOnce,
+					},
+				}
+			}, ""),
+
+		Entry("the Online seed mode within a single zone",
+			func(spec *IBMSecurityVerifyDirectorySpec) {
+				spec.Replicas.SeedMode = SeedModeOnline
+
+				for idx := range spec.Replicas.Groups {
+					spec.Replicas.Groups[idx].Zone = "zone-a"
+				}
+			}, ""),
+	)
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,273 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package v1
+
+/*
+ * This file contains the functions which are used to interpret the PVCs
+ * which are created, and named, by the operator when a count of replicas,
+ * rather than a list of PVCs, is specified in the document, along with the
+ * size to which the PVCs are expanded and the threshold at which the storage
+ * of a replica is regarded as low.
+ */
+
+/*****************************************************************************/
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to generate the name of the PVC which is
+ * created by the operator for the specified replica.  The replicas are
+ * numbered from 1.
+ */
+
+func (r *IBMSecurityVerifyDirectory) GetManagedPVCName(index int32) string {
+	return strings.ToLower(fmt.Sprintf("%s-replica-%d", r.Name, index))
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the specified PVC is
+ * one of the PVCs which is created by the operator for this document.  The
+ * index of the replica is not checked against the count, so that the PVCs
+ * of replicas which are being removed are also recognised.
+ */
+
+func (r *IBMSecurityVerifyDirectory) IsManagedPVC(pvcName string) bool {
+
+	if r.Spec.Replicas.Count == 0 {
+		return false
+	}
+
+	prefix := strings.ToLower(fmt.Sprintf("%s-replica-", r.Name))
+
+	if ! strings.HasPrefix(pvcName, prefix) {
+		return false
+	}
+
+	index, err := strconv.Atoi(strings.TrimPrefix(pvcName, prefix))
+
+	return err == nil && index > 0 && 
+				r.GetManagedPVCName(int32(index)) == pvcName
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to populate the list of PVCs of the
+ * replicas, if the PVCs are created by the operator.  The list is only
+ * populated in memory, so that the rest of the operator can work with the
+ * names of the PVCs regardless of how they were specified.
+ */
+
+func (r *IBMSecurityVerifyDirectory) ResolveReplicaPVCs() {
+
+	if r.Spec.Replicas.Count == 0 {
+		return
+	}
+
+	pvcs := make([]string, 0, r.Spec.Replicas.Count)
+
+	for idx := int32(1); idx <= r.Spec.Replicas.Count; idx++ {
+		pvcs = append(pvcs, r.GetManagedPVCName(idx))
+	}
+
+	r.Spec.Replicas.PVCs = pvcs
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the retention policy of the
+ * PVCs which are created by the operator.  Any unset entry of the policy
+ * defaults to retaining the PVCs.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetPVCRetentionPolicy() (
+					policy IBMSecurityVerifyDirectoryPVCRetentionPolicy) {
+
+	if s.Replicas.PVCRetentionPolicy != nil {
+		policy = *s.Replicas.PVCRetentionPolicy
+	}
+
+	if policy.WhenDeleted == "" {
+		policy.WhenDeleted = PVCRetentionPolicyRetain
+	}
+
+	if policy.WhenScaled == "" {
+		policy.WhenScaled = PVCRetentionPolicyRetain
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to validate the way in which the PVCs of
+ * the replicas have been specified.  Either a list of pre-created PVCs, or a
+ * count of replicas along with a template for the PVCs, must be specified.
+ * This function must be called before the list of PVCs is resolved.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) ValidateVolumeClaimTemplate() error {
+
+	replicas := s.Replicas
+
+	if replicas.Count > 0 && len(replicas.PVCs) > 0 {
+		return errors.New("The spec.replicas.pvcs and spec.replicas.count " +
+			"entries cannot both be specified.")
+	}
+
+	if replicas.Count == 0 {
+		if len(replicas.PVCs) == 0 {
+			return errors.New("Either spec.replicas.pvcs or " +
+				"spec.replicas.count must be specified.")
+		}
+
+		if replicas.VolumeClaimTemplate != nil ||
+						replicas.PVCRetentionPolicy != nil {
+			return errors.New("The spec.replicas.volumeClaimTemplate and " +
+				"spec.replicas.pvcRetentionPolicy entries can only be used " +
+				"with spec.replicas.count.")
+		}
+
+		return nil
+	}
+
+	template := replicas.VolumeClaimTemplate
+
+	if template == nil {
+		return errors.New("The spec.replicas.volumeClaimTemplate entry " +
+			"must be specified with spec.replicas.count.")
+	}
+
+	if template.Size.Sign() <= 0 {
+		return errors.New(fmt.Sprintf("The size of the volume claim " +
+			"template, %s, is not valid.", template.Size.String()))
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The default percentage of the file system of a replica which can be used
+ * before the storage of the replica is regarded as low.
+ */
+
+const DefaultStorageLowThreshold = 90
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the percentage of the file
+ * system of a replica which can be used before the storage of the replica
+ * is regarded as low.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetStorageLowThreshold() int32 {
+
+	if s.StorageLowThreshold <= 0 || s.StorageLowThreshold > 100 {
+		return DefaultStorageLowThreshold
+	}
+
+	return s.StorageLowThreshold
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the size of the PVCs which are
+ * created by the operator.  If the storage size is larger than the size in
+ * the template the new PVCs are created with the storage size, so that they
+ * don't need to be expanded.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) GetVolumeClaimSize() resource.Quantity {
+
+	size := resource.Quantity{}
+
+	if s.Replicas.VolumeClaimTemplate != nil {
+		size = s.Replicas.VolumeClaimTemplate.Size
+	}
+
+	if s.StorageSize != nil && s.StorageSize.Cmp(size) > 0 {
+		size = *s.StorageSize
+	}
+
+	return size
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to validate the storage size, and to 
+ * ensure that the size has not been reduced from the size in the original
+ * document, if there is one.
+ */
+
+func (s *IBMSecurityVerifyDirectorySpec) ValidateStorageSize(
+				old *IBMSecurityVerifyDirectorySpec) error {
+
+	if s.StorageSize == nil {
+		return nil
+	}
+
+	if s.StorageSize.Sign() <= 0 {
+		return errors.New(fmt.Sprintf("The storage size, %s, is not valid.",
+				s.StorageSize.String()))
+	}
+
+	if old != nil && old.StorageSize != nil && 
+					s.StorageSize.Cmp(*old.StorageSize) < 0 {
+		return errors.New(fmt.Sprintf("The storage size cannot be reduced " +
+			"from %s to %s.  A PVC can only be expanded.", 
+			old.StorageSize.String(), s.StorageSize.String()))
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether a PVC with the 
+ * specified access modes can be mounted by more than one pod.  A PVC with 
+ * no access modes is created with the ReadWriteOnce access mode, which 
+ * allows the PVC to be shared by the pods on the same node.
+ */
+
+func IsSharedAccessMode(modes []corev1.PersistentVolumeAccessMode) bool {
+
+	if len(modes) == 0 {
+		return true
+	}
+
+	for _, mode := range modes {
+		if mode != corev1.ReadWriteOncePod {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*****************************************************************************/
+
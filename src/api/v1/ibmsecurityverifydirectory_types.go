@@ -9,6 +9,8 @@ package v1
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // IBMSecurityVerifyDirectoryReplica defines details associated with a 
@@ -16,10 +18,198 @@ import (
 type IBMSecurityVerifyDirectoryReplica struct {
 	// A list of persistent volume claims which will be used by the 
 	// replica.  Each replica must have its own PVC, and the PVC must be 
-	// pre-created.
+	// pre-created.  Either pvcs or count must be specified.
+	// +optional
+	PVCs []string `json:"pvcs,omitempty"`
+
+	// The number of replicas.  If a count is specified the PVCs of the 
+	// replicas are created by the operator, from the volumeClaimTemplate, 
+	// and are named <document-name>-replica-<n>, where n runs from 1 to the
+	// count.  Either pvcs or count must be specified.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Count int32 `json:"count,omitempty"`
+
+	// The template which is used when the operator creates the PVCs of the
+	// replicas.  This is required if a count is specified.
+	// +optional
+	VolumeClaimTemplate *IBMSecurityVerifyDirectoryVolumeClaimTemplate `json:"volumeClaimTemplate,omitempty"`
+
+	// The policy which controls whether the PVCs which are created by the
+	// operator are retained or deleted when they are no longer used.
+	// +optional
+	PVCRetentionPolicy *IBMSecurityVerifyDirectoryPVCRetentionPolicy `json:"pvcRetentionPolicy,omitempty"`
+
+	// The PVC of the replica which should be used as the principal when
+	// new replicas are added.  The principal must be one of the PVCs which
+	// is specified in the list of replicas.  If the principal is not 
+	// available another healthy replica will be used instead.
+	// +optional
+	Principal string `json:"principal,omitempty"`
+
+	//+kubebuilder:validation:Enum=Offline;Online
+	//+kubebuilder:default=Offline
+	// The mode which is used when seeding new replicas.  In the Offline mode
+	// the principal is stopped while the new replicas are seeded from its
+	// PVC.  In the Online mode a backup is taken from the running principal,
+	// within a separate seed volume which is created by the operator for
+	// each replica, and the new replicas are seeded from the backup.
+	// +optional
+	SeedMode IBMSecurityVerifyDirectorySeedMode `json:"seedMode,omitempty"`
+
+	// Named subsets of the replicas.  If groups are defined each of the
+	// PVCs must belong to exactly one group.  Each group is added to the
+	// proxy configuration as its own server group.
+	// +optional
+	Groups []IBMSecurityVerifyDirectoryReplicaGroup `json:"groups,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryVolumeClaimTemplate defines the PVCs which are
+// created by the operator for the replicas.
+type IBMSecurityVerifyDirectoryVolumeClaimTemplate struct {
+	// The name of the storage class of the PVCs.  If no storage class is
+	// specified the default storage class of the cluster is used.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// The size of each of the PVCs (e.g. 10Gi).
+	Size resource.Quantity `json:"size"`
+
+	//+kubebuilder:default={ReadWriteOnce}
+	// The access modes of the PVCs.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryPVCRetentionPolicy defines what happens to the
+// PVCs which are created by the operator when they are no longer used.
+type IBMSecurityVerifyDirectoryPVCRetentionPolicy struct {
+	//+kubebuilder:validation:Enum=Retain;Delete
+	//+kubebuilder:default=Retain
+	// What happens to the PVCs when the document is deleted.
+	// +optional
+	WhenDeleted IBMSecurityVerifyDirectoryPVCRetentionPolicyType `json:"whenDeleted,omitempty"`
+
+	//+kubebuilder:validation:Enum=Retain;Delete
+	//+kubebuilder:default=Retain
+	// What happens to the PVC of a replica when the count is reduced.
+	// +optional
+	WhenScaled IBMSecurityVerifyDirectoryPVCRetentionPolicyType `json:"whenScaled,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryReplicaGroup defines a named subset of the 
+// replicas.
+type IBMSecurityVerifyDirectoryReplicaGroup struct {
+	// The name of the group.
+	Name string `json:"name"`
+
+	// The PVCs of the replicas which belong to the group.  Each PVC must
+	// also be specified in spec.replicas.pvcs.
 	PVCs []string `json:"pvcs"`
+
+	// The zone (i.e. the value of the topology.kubernetes.io/zone node 
+	// label) in which the replicas of the group will be scheduled.  If any
+	// of the groups has a zone a proxy deployment is created in each zone, 
+	// and each proxy will prefer the groups in its own zone.
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// The relative weight of the group when the proxy distributes requests
+	// across the groups which have the same preference.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Weight int32 `json:"weight,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryPartition defines how a suffix is partitioned
+// across the replica groups.
+type IBMSecurityVerifyDirectoryPartition struct {
+	// The suffix which is being partitioned.  The suffix must be one of the
+	// suffixes which is defined in the server configuration.
+	Suffix string `json:"suffix"`
+
+	// The splits of the suffix.  If a single split is specified the entire 
+	// suffix is served by the groups of the split, otherwise the entries of
+	// the suffix are distributed across the splits by the proxy using a 
+	// hash of the RDN of each entry.
+	// +kubebuilder:validation:MinItems=1
+	Splits []IBMSecurityVerifyDirectorySplit `json:"splits"`
+}
+
+// IBMSecurityVerifyDirectorySplit defines the replica groups which serve a
+// single split of a partitioned suffix.
+type IBMSecurityVerifyDirectorySplit struct {
+	// The names of the replica groups which serve the split.
+	// +kubebuilder:validation:MinItems=1
+	Groups []string `json:"groups"`
+}
+
+// IBMSecurityVerifyDirectoryBackup defines the scheduled backups of the
+// directory data.
+type IBMSecurityVerifyDirectoryBackup struct {
+	// The schedule, in the standard cron format (e.g. "0 2 * * *"), on which
+	// the backups will be taken.
+	Schedule string `json:"schedule"`
+
+	// The name of the PVC to which the backups will be written.  The PVC 
+	// must be pre-created, and must not be used by any of the replicas or 
+	// the proxy.
+	PVC string `json:"pvc"`
+
+	// The PVC of the replica from which the backups will be taken.  If no
+	// replica is specified the principal will be used.
+	// +optional
+	Replica string `json:"replica,omitempty"`
+
+	//+kubebuilder:default=7
+	//+kubebuilder:validation:Minimum=1
+	// The number of successful backups which will be retained on the PVC.
+	// The oldest backups are removed once a new backup has completed.
+	// +optional
+	Retention int32 `json:"retention,omitempty"`
+
+	// Whether the scheduling of new backups has been suspended.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryRestore defines the backup from which a new
+// deployment will be bootstrapped.
+type IBMSecurityVerifyDirectoryRestore struct {
+	// The name of the PVC which contains the backup.  The PVC must be 
+	// pre-created, and must not be used by any of the replicas or the proxy.
+	PVC string `json:"pvc"`
+
+	// The directory, relative to the root of the PVC, which contains the
+	// backup (e.g. isvd/20240101020000).  The directory should contain an 
+	// LDIF file for each of the suffixes.
+	Path string `json:"path"`
 }
 
+// IBMSecurityVerifyDirectorySeedMode defines the mode which is used when
+// seeding new replicas.
+type IBMSecurityVerifyDirectorySeedMode string
+
+const (
+	// The principal is stopped while the new replicas are seeded.
+	SeedModeOffline IBMSecurityVerifyDirectorySeedMode = "Offline"
+
+	// The new replicas are seeded from a backup of the running principal.
+	SeedModeOnline IBMSecurityVerifyDirectorySeedMode = "Online"
+)
+
+// IBMSecurityVerifyDirectoryPVCRetentionPolicyType defines whether a PVC
+// which is no longer used is retained or deleted.
+type IBMSecurityVerifyDirectoryPVCRetentionPolicyType string
+
+const (
+	// The PVC is retained.
+	PVCRetentionPolicyRetain IBMSecurityVerifyDirectoryPVCRetentionPolicyType = "Retain"
+
+	// The PVC is deleted.
+	PVCRetentionPolicyDelete IBMSecurityVerifyDirectoryPVCRetentionPolicyType = "Delete"
+)
+
 // IBMSecurityVerifyDirectoryImage defines the details associated with the
 // docker images used by the operator.
 type IBMSecurityVerifyDirectoryImage struct {
@@ -105,7 +295,6 @@ type IBMSecurityVerifyDirectoryPods struct {
 	ConfigMap IBMSecurityVerifyDirectoryConfigMap `json:"configMap"`
 
     // Compute Resources required by this container.
-    // Cannot be updated.
     // More info: https://kubernetes.io/docs/concepts/configuration/manage-resources-containers/
     // +optional
     Resources corev1.ResourceRequirements `json:"resources,omitempty" protobuf:"bytes,8,opt,name=resources"`
@@ -116,12 +305,10 @@ type IBMSecurityVerifyDirectoryPods struct {
     // exists in multiple sources, the value associated with the last source 
     // will take precedence.  Values defined by an Env with a duplicate key 
     // will take precedence.
-    // Cannot be updated.
     // +optional
     EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty" protobuf:"bytes,19,rep,name=envFrom"`
 
     // List of environment variables to set in the container.
-    // Cannot be updated.
     // +optional
     // +patchMergeKey=name
     // +patchStrategy=merge
@@ -149,16 +336,472 @@ type IBMSecurityVerifyDirectorySpec struct {
 
 	// Details which are used when creating the server pods.
 	Pods IBMSecurityVerifyDirectoryPods `json:"pods"`
+
+	// The partitioning of the suffixes across the replica groups.  If 
+	// partitions are defined each of the suffixes in the server configuration
+	// must be partitioned, and replication agreements are only created 
+	// between the replicas which serve the same data.  If no partitions are
+	// defined each suffix is served by all of the replicas.
+	// +optional
+	Partitions []IBMSecurityVerifyDirectoryPartition `json:"partitions,omitempty"`
+
+	// The scheduled backups of the directory data.  If no backup is 
+	// specified backups will not be taken by the operator.
+	// +optional
+	Backup *IBMSecurityVerifyDirectoryBackup `json:"backup,omitempty"`
+
+	// The backup from which the deployment will be bootstrapped.  The 
+	// backup is only restored when the deployment is first created, into 
+	// the PVC of the principal, and the other replicas are then seeded from
+	// the principal.
+	// +optional
+	Restore *IBMSecurityVerifyDirectoryRestore `json:"restore,omitempty"`
+
+	// The name of another document, in the same namespace, from which the
+	// deployment will be cloned.  When the deployment is first created a
+	// backup is taken from the running principal of the source document, 
+	// and each of the replicas is seeded from this backup.  The cloned 
+	// replicas have their own replication topology and proxy.
+	// +optional
+	CloneFrom string `json:"cloneFrom,omitempty"`
+
+	// The size to which the PVCs of the replicas, and the PVC of the proxy, 
+	// are expanded (e.g. 20Gi).  When the size is increased the operator 
+	// will expand each PVC which is smaller, restarting the replicas one at
+	// a time if the file system can only be resized when the volume is 
+	// mounted.  The storage class of each PVC must allow volume expansion,
+	// and the size cannot be reduced.
+	// +optional
+	StorageSize *resource.Quantity `json:"storageSize,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=100
+	//+kubebuilder:default=90
+	// The percentage of the file system of a replica which can be used 
+	// before the StorageLow condition is raised.
+	// +optional
+	StorageLowThreshold int32 `json:"storageLowThreshold,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryPhase defines the step of the deployment 
+// workflow which is currently being processed by the operator.
+type IBMSecurityVerifyDirectoryPhase string
+
+const (
+	// The deployment has been fully processed and no work is outstanding.
+	PhaseReady IBMSecurityVerifyDirectoryPhase = "Ready"
+
+	// The existing replicas are being updated, one at a time, so that they
+	// match the current pod specification (e.g. a new image label).
+	PhaseUpdatingReplicas IBMSecurityVerifyDirectoryPhase = "UpdatingReplicas"
+
+	// A backup is being taken from the running principal of the document
+	// specified in spec.cloneFrom.
+	PhaseBackingUpSource IBMSecurityVerifyDirectoryPhase = "BackingUpSource"
+
+	// The replicas are being seeded with the backup which was taken from
+	// the document specified in spec.cloneFrom.
+	PhaseCloningReplicas IBMSecurityVerifyDirectoryPhase = "CloningReplicas"
+
+	// The principal replica is being created and started.
+	PhaseCreatingPrincipal IBMSecurityVerifyDirectoryPhase = "CreatingPrincipal"
+
+	// The new principal replica has been stopped and the backup specified
+	// in spec.restore is being imported into its directory instance.
+	PhaseRestoringPrincipal IBMSecurityVerifyDirectoryPhase = "RestoringPrincipal"
+
+	// The replication agreements between the principal and the new replicas
+	// are being created.
+	PhaseCreatingAgreements IBMSecurityVerifyDirectoryPhase = "CreatingAgreements"
+
+	// A backup is being taken from the running principal replica so that it
+	// can be used to seed the new replicas.
+	PhaseBackingUpPrincipal IBMSecurityVerifyDirectoryPhase = "BackingUpPrincipal"
+
+	// The principal replica is being stopped so that it can be used to seed
+	// the new replicas.
+	PhaseStoppingPrincipal IBMSecurityVerifyDirectoryPhase = "StoppingPrincipal"
+
+	// The new replicas are being seeded with the data from the principal.
+	PhaseSeedingReplicas IBMSecurityVerifyDirectoryPhase = "SeedingReplicas"
+
+	// The new replicas are being started.
+	PhaseStartingReplicas IBMSecurityVerifyDirectoryPhase = "StartingReplicas"
+
+	// The replication agreements and services for the new replicas are 
+	// being created.
+	PhaseConfiguringReplicas IBMSecurityVerifyDirectoryPhase = "ConfiguringReplicas"
+
+	// The principal replica is being restarted.
+	PhaseStartingPrincipal IBMSecurityVerifyDirectoryPhase = "StartingPrincipal"
+
+	// The proxy is being deployed.
+	PhaseDeployingProxy IBMSecurityVerifyDirectoryPhase = "DeployingProxy"
+
+	// The PVCs which are smaller than spec.storageSize are being expanded.
+	PhaseExpandingVolumes IBMSecurityVerifyDirectoryPhase = "ExpandingVolumes"
+
+	// The replicas which are no longer required are being deleted.
+	PhaseDeletingReplicas IBMSecurityVerifyDirectoryPhase = "DeletingReplicas"
+)
+
+// IBMSecurityVerifyDirectoryReplicaRole is the role which a replica plays 
+// in the replication topology.
+type IBMSecurityVerifyDirectoryReplicaRole string
+
+const (
+	// The replica is the principal, which is used to seed new replicas.
+	ReplicaRolePrincipal IBMSecurityVerifyDirectoryReplicaRole = "principal"
+
+	// The replica is a peer of the principal.
+	ReplicaRolePeer IBMSecurityVerifyDirectoryReplicaRole = "peer"
+)
+
+// IBMSecurityVerifyDirectoryAgreementStatus defines the observed state of a
+// replication agreement from a replica to one of its consumers.
+type IBMSecurityVerifyDirectoryAgreementStatus struct {
+	// The name of the PVC of the consumer replica.
+	Consumer string `json:"consumer"`
+
+	// The suffix which is replicated by the agreement.
+	Suffix string `json:"suffix"`
+
+	// The state of the agreement, as reported by the server (e.g. ready,
+	// retrying, on hold).
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// The number of changes which are still to be replicated to the 
+	// consumer.
+	// +optional
+	PendingChanges int32 `json:"pendingChanges,omitempty"`
+
+	// The result of the most recent replication attempt, as reported by the
+	// server.
+	// +optional
+	LastResult string `json:"lastResult,omitempty"`
+
+	// The time at which a change was last successfully replicated to the
+	// consumer.
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+
+	// Whether the agreement is healthy.
+	Healthy bool `json:"healthy"`
+}
+
+// IBMSecurityVerifyDirectoryDriftType describes how a replication agreement
+// differs from the full-mesh topology.
+// +kubebuilder:validation:Enum=Missing;Stale
+type IBMSecurityVerifyDirectoryDriftType string
+
+const (
+	// The agreement is required by the topology but does not exist.
+	DriftTypeMissing IBMSecurityVerifyDirectoryDriftType = "Missing"
+
+	// The agreement exists but is not required by the topology.
+	DriftTypeStale IBMSecurityVerifyDirectoryDriftType = "Stale"
+)
+
+// IBMSecurityVerifyDirectoryAgreementDrift describes a replication agreement
+// which differs from the full-mesh topology.
+type IBMSecurityVerifyDirectoryAgreementDrift struct {
+	// The name of the PVC of the supplier replica.
+	Supplier string `json:"supplier"`
+
+	// The name of the PVC of the consumer replica, or the replica identifier
+	// of the consumer if the consumer is not a replica of this deployment.
+	Consumer string `json:"consumer"`
+
+	// The suffix which is replicated by the agreement.
+	// +optional
+	Suffix string `json:"suffix,omitempty"`
+
+	// How the agreement differs from the topology.
+	Type IBMSecurityVerifyDirectoryDriftType `json:"type"`
+
+	// Whether the agreement has been repaired.
+	Repaired bool `json:"repaired"`
+}
+
+// IBMSecurityVerifyDirectoryExpansionState describes the progress of the
+// expansion of a PVC.
+// +kubebuilder:validation:Enum=Pending;Resizing;Restarting;Complete
+type IBMSecurityVerifyDirectoryExpansionState string
+
+const (
+	// The PVC has not yet been expanded.
+	ExpansionStatePending IBMSecurityVerifyDirectoryExpansionState = "Pending"
+
+	// The new size has been requested and the volume is being resized.
+	ExpansionStateResizing IBMSecurityVerifyDirectoryExpansionState = "Resizing"
+
+	// The pod which uses the PVC is being restarted so that the file
+	// system can be resized.
+	ExpansionStateRestarting IBMSecurityVerifyDirectoryExpansionState = "Restarting"
+
+	// The PVC has been expanded.
+	ExpansionStateComplete IBMSecurityVerifyDirectoryExpansionState = "Complete"
+)
+
+// IBMSecurityVerifyDirectoryExpansionStatus defines the progress of the 
+// expansion of a single PVC.
+type IBMSecurityVerifyDirectoryExpansionStatus struct {
+	// The name of the PVC.
+	PVC string `json:"pvc"`
+
+	// The size which has been requested for the PVC.
+	Requested resource.Quantity `json:"requested"`
+
+	// The capacity of the PVC, as last reported by the PVC.
+	// +optional
+	Capacity *resource.Quantity `json:"capacity,omitempty"`
+
+	// The progress of the expansion.
+	State IBMSecurityVerifyDirectoryExpansionState `json:"state"`
+}
+
+// IBMSecurityVerifyDirectoryBackupResult describes the result of a backup.
+// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+type IBMSecurityVerifyDirectoryBackupResult string
+
+const (
+	// The backup is still being taken.
+	BackupResultRunning IBMSecurityVerifyDirectoryBackupResult = "Running"
+
+	// The backup completed successfully.
+	BackupResultSucceeded IBMSecurityVerifyDirectoryBackupResult = "Succeeded"
+
+	// The backup failed.
+	BackupResultFailed IBMSecurityVerifyDirectoryBackupResult = "Failed"
+)
+
+// IBMSecurityVerifyDirectoryBackupStatus defines the observed state of a 
+// single backup.
+type IBMSecurityVerifyDirectoryBackupStatus struct {
+	// The name of the job which took the backup.
+	Name string `json:"name"`
+
+	// The directory, within the backup PVC, which contains the backup.
+	// +optional
+	Location string `json:"location,omitempty"`
+
+	// The time at which the backup was started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// The time at which the backup completed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// The size, in bytes, of the backup.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// The result of the backup.
+	Result IBMSecurityVerifyDirectoryBackupResult `json:"result"`
+
+	// A message which describes the result of the backup.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryReplicaStatus defines the observed state of a
+// single replica.
+type IBMSecurityVerifyDirectoryReplicaStatus struct {
+	// The name of the PVC which contains the data for the replica.
+	PVC string `json:"pvc"`
+
+	// The name of the pod which is currently running the replica.
+	// +optional
+	PodName string `json:"podName,omitempty"`
+
+	// The name of the cluster service for the replica.
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// Whether the pod for the replica is running and ready.
+	Ready bool `json:"ready"`
+
+	// The role of the replica in the replication topology.
+	// +optional
+	Role IBMSecurityVerifyDirectoryReplicaRole `json:"role,omitempty"`
+
+	// The time at which the replication agreements for the replica were 
+	// last set up.
+	// +optional
+	LastAgreementTime *metav1.Time `json:"lastAgreementTime,omitempty"`
+
+	// The state of the replication agreements from the replica to each of
+	// its consumers, as observed by the most recent health check.
+	// +optional
+	Agreements []IBMSecurityVerifyDirectoryAgreementStatus `json:"agreements,omitempty"`
+
+	// The usage of the file system of the replica, as observed by the most
+	// recent storage check.
+	// +optional
+	Storage *IBMSecurityVerifyDirectoryStorageUsage `json:"storage,omitempty"`
+}
+
+// IBMSecurityVerifyDirectoryStorageUsage defines the usage of the file 
+// system which holds the data of a replica.
+type IBMSecurityVerifyDirectoryStorageUsage struct {
+	// The size of the file system, in bytes.
+	Capacity int64 `json:"capacity"`
+
+	// The number of bytes which are in use.
+	Used int64 `json:"used"`
+
+	// The number of bytes which are available.
+	Available int64 `json:"available"`
+
+	// The percentage of the file system which is in use.
+	UsedPercent int32 `json:"usedPercent"`
 }
 
 // IBMSecurityVerifyDirectoryStatus defines the observed state of 
 // IBMSecurityVerifyDirectory
 type IBMSecurityVerifyDirectoryStatus struct {
     Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// The phase of the deployment workflow which is currently being 
+	// processed by the operator.
+	// +optional
+	Phase IBMSecurityVerifyDirectoryPhase `json:"phase,omitempty"`
+
+	// The time at which the current phase was entered.
+	// +optional
+	PhaseStartTime *metav1.Time `json:"phaseStartTime,omitempty"`
+
+	// The PVC of the replica which was most recently selected as the
+	// principal.  This replica will be preferred as the principal by 
+	// subsequent workflows, unless a principal is specified in the spec.
+	// +optional
+	Principal string `json:"principal,omitempty"`
+
+	// The PVCs of the replicas which are being added by the current
+	// workflow.
+	// +optional
+	ReplicasToAdd []string `json:"replicasToAdd,omitempty"`
+
+	// The PVCs of the existing replicas which are still to be updated by
+	// the current workflow.
+	// +optional
+	ReplicasToUpdate []string `json:"replicasToUpdate,omitempty"`
+
+	// The PVCs of the replicas which are being deleted by the current 
+	// workflow.
+	// +optional
+	ReplicasToDelete []string `json:"replicasToDelete,omitempty"`
+
+	// The PVCs of the replicas which have been seeded by the current phase
+	// of the workflow.  The seed job of a replica is deleted once the
+	// replica has been recorded here, and is never recreated.
+	// +optional
+	SeededReplicas []string `json:"seededReplicas,omitempty"`
+
+	// The PVCs which are being expanded by the current workflow.
+	// +optional
+	VolumesToExpand []IBMSecurityVerifyDirectoryExpansionStatus `json:"volumesToExpand,omitempty"`
+
+	// The number of consecutive times that the current phase of the
+	// workflow has failed.  This is used to calculate the delay before
+	// the failed phase is retried.
+	// +optional
+	RetryCount int32 `json:"retryCount,omitempty"`
+
+	// The time at which the failed phase of the workflow will next be
+	// retried.
+	// +optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+
+	// The label of the Verify Directory images which are currently 
+	// deployed.
+	// +optional
+	CurrentVersion string `json:"currentVersion,omitempty"`
+
+	// The label of the Verify Directory images which are being deployed by
+	// the current workflow.
+	// +optional
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// The generation of the document which was most recently processed
+	// successfully.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The generation of the document which is being processed by the 
+	// current workflow.  Any changes which are made to the document while
+	// the workflow is running are processed by the next workflow.
+	// +optional
+	WorkflowGeneration int64 `json:"workflowGeneration,omitempty"`
+
+	// The state of each of the replicas.
+	// +optional
+	Replicas []IBMSecurityVerifyDirectoryReplicaStatus `json:"replicas,omitempty"`
+
+	// The number of replicas which are ready.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// The replication agreements which differed from the full-mesh topology
+	// when the topology was last checked.
+	// +optional
+	TopologyDrift []IBMSecurityVerifyDirectoryAgreementDrift `json:"topologyDrift,omitempty"`
+
+	// The time at which the replication topology was last checked.
+	// +optional
+	LastTopologyCheckTime *metav1.Time `json:"lastTopologyCheckTime,omitempty"`
+
+	// The most recent backups, with the oldest backup first.  The status of
+	// a backup is removed once the backup is no longer retained.
+	// +optional
+	Backups []IBMSecurityVerifyDirectoryBackupStatus `json:"backups,omitempty"`
+
+	// The time at which the backup specified in spec.restore was restored
+	// into the PVC of the principal.
+	// +optional
+	RestoreTime *metav1.Time `json:"restoreTime,omitempty"`
+
+	// The PVC of the replica of the document specified in spec.cloneFrom
+	// from which the deployment is being cloned.
+	// +optional
+	CloneSource string `json:"cloneSource,omitempty"`
+
+	// The PVCs of the replicas which have been seeded from the document 
+	// specified in spec.cloneFrom by the current workflow.
+	// +optional
+	ClonedReplicas []string `json:"clonedReplicas,omitempty"`
+
+	// The time at which the deployment was cloned from the document 
+	// specified in spec.cloneFrom.
+	// +optional
+	CloneTime *metav1.Time `json:"cloneTime,omitempty"`
+
+	// The address, in the format <host>:<port>, of the cluster service for
+	// the proxy.
+	// +optional
+	ProxyEndpoint string `json:"proxyEndpoint,omitempty"`
+
+	// The port which is used to communicate with the replicas, as defined
+	// in the server configuration.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Whether the port which is used to communicate with the replicas is
+	// secure (i.e. LDAPS).
+	// +optional
+	Secure bool `json:"secure,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+//+kubebuilder:printcolumn:name="Principal",type=string,JSONPath=`.status.principal`
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.currentVersion`
+//+kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.status.proxyEndpoint`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // IBMSecurityVerifyDirectory is the Schema for the 
 // ibmsecurityverifydirectories API
@@ -23,7 +23,6 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/go-yaml/yaml"
 	"github.com/go-ldap/ldap/v3"
 	"github.com/ibm-security/verify-directory-operator/utils"
 
@@ -94,7 +93,18 @@ func (r *IBMSecurityVerifyDirectory) ValidateCreate() error {
 	logger.V(1).Info("Entering a function", 
 				r.createLogParams("Function", "ValidateCreate")...)
 
-	return r.validateDocument()
+	err := r.validateDocument()
+
+	if err != nil {
+		return err
+	}
+
+	/*
+	 * The source of a clone is only used when the document is first 
+	 * created, and so it is only validated at this time.
+	 */
+
+	return r.validateCloneSource()
 }
 
 /*****************************************************************************/
@@ -130,12 +140,19 @@ func (r *IBMSecurityVerifyDirectory) ValidateUpdate(old runtime.Object) error {
 		return err
 	}
 
+	oldDirectory, ok := old.(*IBMSecurityVerifyDirectory)
+
+	if !ok {
+		return errors.New("An internal error occurred while trying to " +
+								"access the original document.")
+	}
+
 	/*
-	 * Check to ensure that the document is not currently in the failing
-	 * state.
+	 * Check to ensure that the update is allowed if the document is 
+	 * currently in the failing state.
 	 */
 
-	err = r.validateDocumentState()
+	err = r.validateDocumentState(oldDirectory)
 
 	if err != nil {
 		return err
@@ -146,13 +163,6 @@ func (r *IBMSecurityVerifyDirectory) ValidateUpdate(old runtime.Object) error {
 	 * document.
 	 */
 
-	oldDirectory, ok := old.(*IBMSecurityVerifyDirectory)
-
-	if !ok {
-		return errors.New("An internal error occurred while trying to " +
-								"access the original document.")
-	}
-
 	err = r.validateDocumentUpdates(oldDirectory)
 
 	if err != nil {
@@ -208,15 +218,40 @@ func (r *IBMSecurityVerifyDirectory) validateDocument() error {
 				r.createLogParams("Function", "validateDocument")...)
 
 	/*
-	 * Validate that each of the PVCs specified in the document exists.
+	 * Validate the way in which the PVCs of the replicas have been 
+	 * specified, and then generate the names of the PVCs which are to be
+	 * created by the operator.
+	 */
+
+	err = r.Spec.ValidateVolumeClaimTemplate()
+
+	if err != nil {
+		return err
+	}
+
+	r.ResolveReplicaPVCs()
+
+	/*
+	 * Validate that each of the PVCs specified in the document exists.  The
+	 * PVCs which are created by the operator don't need to exist yet.
 	 */
 
 	for _, pvcName := range r.Spec.Replicas.PVCs {
+		if r.IsManagedPVC(pvcName) {
+			continue
+		}
+
 		err = r.validatePVC(pvcName)
 
 		if err != nil {
 			return err
 		}
+
+		err = r.validateSeedPVC(pvcName)
+
+		if err != nil {
+			return err
+		}
 	}
 
 	if r.Spec.Pods.Proxy.PVC != "" {
@@ -227,6 +262,22 @@ func (r *IBMSecurityVerifyDirectory) validateDocument() error {
 		}
 	}
 
+	if r.Spec.Backup != nil && r.Spec.Backup.PVC != "" {
+		err = r.validatePVC(r.Spec.Backup.PVC)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Spec.Restore != nil && r.Spec.Restore.PVC != "" {
+		err = r.validatePVC(r.Spec.Restore.PVC)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	/*
 	 * Ensure that the same PVC is not specified multiple times.
 	 */
@@ -256,6 +307,77 @@ func (r *IBMSecurityVerifyDirectory) validateDocument() error {
 		}
 	}
 
+	if r.Spec.Backup != nil && r.Spec.Backup.PVC != "" {
+		_, ok := allPVCs[r.Spec.Backup.PVC]
+
+		if ok || r.Spec.Backup.PVC == r.Spec.Pods.Proxy.PVC {
+			return errors.New(fmt.Sprintf(
+				"The document contains a PVC which is referenced more than " +
+				"once: %s.  Each PVC in the document must be unique.", 
+				r.Spec.Backup.PVC))
+		}
+	}
+
+	if r.Spec.Restore != nil && r.Spec.Restore.PVC != "" {
+		_, ok := allPVCs[r.Spec.Restore.PVC]
+
+		if ok || r.Spec.Restore.PVC == r.Spec.Pods.Proxy.PVC {
+			return errors.New(fmt.Sprintf(
+				"The restore PVC, %s, is also used by a replica or the " +
+				"proxy.", r.Spec.Restore.PVC))
+		}
+	}
+
+	/*
+	 * Ensure that the principal, if specified, is one of the replicas.
+	 */
+
+	principal := r.Spec.Replicas.Principal
+
+	if principal != "" {
+		if _, ok := allPVCs[principal]; !ok {
+			return errors.New(fmt.Sprintf(
+				"The principal, %s, is not one of the PVCs which is " +
+				"specified in spec.replicas.pvcs.", principal))
+		}
+	}
+
+	/*
+	 * Validate the replica groups and the partitioning of the suffixes.
+	 */
+
+	err = r.Spec.ValidatePartitions()
+
+	if err != nil {
+		return err
+	}
+
+	/*
+	 * Validate the scheduled backups and the restore.
+	 */
+
+	err = r.Spec.ValidateBackup()
+
+	if err != nil {
+		return err
+	}
+
+	err = r.Spec.ValidateRestore()
+
+	if err != nil {
+		return err
+	}
+
+	/*
+	 * Validate the size to which the PVCs are expanded.
+	 */
+
+	err = r.Spec.ValidateStorageSize(nil)
+
+	if err != nil {
+		return err
+	}
+
 	/*
 	 * Validate that each of the ConfigMaps specified in the document
 	 * exists.
@@ -320,6 +442,90 @@ func (r *IBMSecurityVerifyDirectory) validateDocument() error {
 		return err
 	}
 
+	/*
+	 * Validate that the server ConfigMap contains each of the configuration
+	 * entries which are required by the operator.
+	 */
+
+	err = r.validateServerConfigMap()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * This function is used to validate the document which is specified in
+ * spec.cloneFrom.  The source document must exist, must use the Online seed
+ * mode, and must not share any PVCs with this document.
+ */
+
+func (r *IBMSecurityVerifyDirectory) validateCloneSource() (err error) {
+
+	if r.Spec.CloneFrom == "" {
+		return nil
+	}
+
+	logger.V(1).Info("Entering a function", 
+		r.createLogParams("Function", "validateCloneSource", 
+					"Source", r.Spec.CloneFrom)...)
+
+	if r.Spec.CloneFrom == r.Name {
+		return errors.New("A document cannot be cloned from itself.")
+	}
+
+	if r.Spec.Restore != nil {
+		return errors.New("The spec.cloneFrom and spec.restore entries " +
+				"cannot both be specified.")
+	}
+
+	source := &IBMSecurityVerifyDirectory{}
+	err     = k8s_client.Get(context.TODO(), client.ObjectKey{
+							Namespace: r.Namespace,
+							Name:      r.Spec.CloneFrom,
+					}, source)
+
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = errors.New(fmt.Sprintf("The document, %s, which is " +
+					"specified in spec.cloneFrom doesn't exist!", 
+					r.Spec.CloneFrom))
+		} else {
+			logger.Error(err, "Failed to retrieve the source document.",
+					r.createLogParams("Source", r.Spec.CloneFrom)...)
+		}
+
+		return
+	}
+
+	source.ResolveReplicaPVCs()
+
+	/*
+	 * The backup of the source is taken within the seed volume of the
+	 * principal of the source, which is only mounted in the Online seed
+	 * mode.
+	 */
+
+	if source.Spec.Replicas.SeedMode != SeedModeOnline {
+		return errors.New(fmt.Sprintf("The document, %s, which is " +
+				"specified in spec.cloneFrom must use the Online seed mode.",
+				r.Spec.CloneFrom))
+	}
+
+	for _, pvcName := range r.Spec.Replicas.PVCs {
+		for _, sourcePvc := range source.Spec.Replicas.PVCs {
+			if pvcName == sourcePvc {
+				return errors.New(fmt.Sprintf("The PVC, %s, is also used " +
+					"by the source document, %s.", pvcName, 
+					r.Spec.CloneFrom))
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -358,6 +564,46 @@ func (r *IBMSecurityVerifyDirectory) validatePVC(pvcName string) (err error) {
 
 /*****************************************************************************/
 
+/*
+ * This function is used to validate that the specified PVC of a replica can
+ * be used in the Online seed mode.  The seed volume of the replica is 
+ * created with the access modes of the PVC, and must be able to be mounted 
+ * by the seed jobs of the new replicas while the replica is running.
+ */
+
+func (r *IBMSecurityVerifyDirectory) validateSeedPVC(pvcName string) (err error) {
+
+	if r.Spec.Replicas.SeedMode != SeedModeOnline {
+		return nil
+	}
+
+	logger.V(1).Info("Entering a function", 
+		r.createLogParams("Function", "validateSeedPVC", "PVC.Name", pvcName)...)
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err  = k8s_client.Get(context.TODO(), client.ObjectKey{
+							Namespace: r.Namespace,
+							Name:      pvcName,
+					}, pvc)
+
+	if err != nil {
+		logger.Error(err, "Failed to retieve the requsted PVC.",
+					r.createLogParams("PVC", pvcName)...)
+
+		return
+	}
+
+	if ! IsSharedAccessMode(pvc.Spec.AccessModes) {
+		err = errors.New(fmt.Sprintf("The Online seed mode cannot be used " +
+			"as the access modes of the PVC, %s, do not allow the PVC to " +
+			"be mounted by more than one pod.", pvcName))
+	}
+
+	return 
+}
+
+/*****************************************************************************/
+
 /*
  * This function is used to validate that specified ConfigMap, and optionally
  * the specified key in the ConfigMap, exists.
@@ -437,6 +683,67 @@ func (r *IBMSecurityVerifyDirectory) validateSecret(
 
 /*****************************************************************************/
 
+/*
+ * This function is used to validate the server ConfigMap.  It will ensure that
+ * each of the configuration entries which are required by the operator has
+ * been correctly defined.
+ */
+
+func (r *IBMSecurityVerifyDirectory) validateServerConfigMap() (err error) {
+
+	logger.V(1).Info("Entering a function", 
+		r.createLogParams("Function", "validateServerConfigMap")...)
+
+	/*
+	 * Retrieve the ConfigMap which contains the server configuration.
+	 */
+
+	name := r.Spec.Pods.ConfigMap.Server.Name
+	key  := r.Spec.Pods.ConfigMap.Server.Key
+
+	config := &corev1.ConfigMap{}
+	err	    = k8s_client.Get(context.TODO(), client.ObjectKey{
+							Namespace: r.Namespace,
+							Name:      name,
+					}, config)
+
+	if err != nil {
+		logger.Error(err, "Failed to retieve the requsted ConfigMap.",
+					r.createLogParams("ConfigMap", name)...)
+
+		return err
+	}
+
+	/*
+	 * Parse and validate the configuration.
+	 */
+
+	serverConfig, err := utils.ParseConfig(config.Data[key])
+
+	if err == nil {
+		err = serverConfig.ValidateServer(r.Namespace)
+	}
+
+	if err == nil {
+		var suffixes []string
+
+		suffixes, err = serverConfig.GetSuffixes()
+
+		if err == nil {
+			err = r.Spec.ValidatePartitionSuffixes(suffixes)
+		}
+	}
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("The server ConfigMap key, %s:%s, is " +
+					"invalid: %s", name, key, err.Error()))
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
 /*
  * This function is used to validate the proxy ConfigMap.  It will ensure that
  * no server groups or suffixes have been defined.
@@ -471,25 +778,21 @@ func (r *IBMSecurityVerifyDirectory) validateProxyConfigMap() (err error) {
 	}
 
 	/*
-	 * Parse the YAML configuration into a map.  Unfortunately it is not
-	 * easy to parse YAML into a generic structure, and so after we have
-	 * unmarshalled the data we want to iteratively convert the data into 
-	 * a map of strings.
+	 * Parse the YAML configuration into the typed configuration model.
 	 */
 
-    var body interface{}
+	proxyConfig, err := utils.ParseConfig(config.Data[key])
 
-    if err = yaml.Unmarshal([]byte(config.Data[key]), &body); err != nil {
+	if err != nil {
 		logger.Error(err, "Failed to unmarshal the ConfigMap data.",
 					r.createLogParams("ConfigMap", name)...)
 
-		return err
-    }
-
-	body = utils.ConvertYaml(body)
+		return errors.New(fmt.Sprintf("The proxy ConfigMap key, %s:%s, is " +
+					"invalid: %s", name, key, err.Error()))
+	}
 
 	logger.V(1).Info("Retrieved the Proxy ConfigMap data", 
-			r.createLogParams("ConfigMap.Name", name, "Data", body)...)
+			r.createLogParams("ConfigMap.Name", name, "Data", proxyConfig)...)
 
 	/*
 	 * Ensure that the server-groups and suffixes entries don't exist.
@@ -498,10 +801,7 @@ func (r *IBMSecurityVerifyDirectory) validateProxyConfigMap() (err error) {
 	entries := []string { "server-groups", "suffixes" }
 
 	for _, entry := range entries {
-		config := utils.GetYamlValue(body, []string{"proxy", entry}, false, 
-						r.Namespace)
-
-		if config != nil {
+		if proxyConfig.HasProxyEntry(entry) {
 			err = errors.New(
 				fmt.Sprintf("The proxy ConfigMap key, %s:%s, includes the " +
 				"proxy.%s configuration entry. This is not allowed as this " +
@@ -517,19 +817,33 @@ func (r *IBMSecurityVerifyDirectory) validateProxyConfigMap() (err error) {
 /*****************************************************************************/
 
 /*
- * This function will check to ensure that the document is not currently in 
- * the failing state.
+ * This function will check to ensure that the update is allowed if the 
+ * document is currently in the failing state.  The operator will 
+ * automatically retry the failed phase of the workflow, and so the document
+ * can be updated (e.g. to correct the cause of the failure), but the 
+ * replicas cannot be changed until the interrupted workflow has completed.
  */
 
-func (r *IBMSecurityVerifyDirectory) validateDocumentState() (err error) {
+func (r *IBMSecurityVerifyDirectory) validateDocumentState(
+		old *IBMSecurityVerifyDirectory) (err error) {
 
 	logger.V(1).Info("Entering a function", 
 		r.createLogParams("Function", "validateDocumentState")...)
 
-	if meta.IsStatusConditionFalse(r.Status.Conditions, "Available") {
-		return errors.New(
-			"The deployment is in a failing state which means that it " +
-			"cannot be updated and instead must be deleted and then recreated.")
+	if ! meta.IsStatusConditionFalse(r.Status.Conditions, "Available") {
+		return nil
+	}
+
+	if r.Status.Phase == "" || r.Status.Phase == PhaseReady {
+		return nil
+	}
+
+	if ! reflect.DeepEqual(r.Spec.Replicas, old.Spec.Replicas) {
+		return errors.New(fmt.Sprintf(
+			"The deployment is in a failing state while processing the " +
+			"%s workflow phase.  The spec.replicas entry cannot be changed " +
+			"until the operator has recovered the failed phase.", 
+			r.Status.Phase))
 	}
 
 	return nil
@@ -561,8 +875,10 @@ func (r *IBMSecurityVerifyDirectory) compareElements(
 
 /*
  * This function will check to ensure that only valid fields have been updated 
- * in the document.  We essentially want to ensure that none of the pod
- * configuration has been updated.
+ * in the document.  We essentially want to ensure that the ConfigMaps used by 
+ * the pods have not been changed.  The remainder of the pod configuration 
+ * (e.g. the image, resources and environment) can be updated as the operator
+ * will perform a rolling update of the replicas and the proxy.
  */
 
 func (r *IBMSecurityVerifyDirectory) validateDocumentUpdates(
@@ -571,12 +887,6 @@ func (r *IBMSecurityVerifyDirectory) validateDocumentUpdates(
 	logger.V(1).Info("Entering a function", 
 		r.createLogParams("Function", "validateDocumentUpdates")...)
 
-	err = r.compareElements(r.Spec.Pods.Image, old.Spec.Pods.Image, "Image")
-
-	if err != nil {
-		return
-	}
-
 	err = r.compareElements(
 				r.Spec.Pods.ConfigMap, old.Spec.Pods.ConfigMap, "ConfigMap")
 
@@ -584,31 +894,59 @@ func (r *IBMSecurityVerifyDirectory) validateDocumentUpdates(
 		return
 	}
 
-	err = r.compareElements(
-				r.Spec.Pods.Resources, old.Spec.Pods.Resources, "Resources")
+	/*
+	 * The data which is held by a replica depends on the partitions which
+	 * are served by its group, and so the partitions cannot be changed and,
+	 * if the suffixes are partitioned, an existing replica cannot be moved 
+	 * to a different group.
+	 */
 
-	if err != nil {
-		return
+	if ! reflect.DeepEqual(r.Spec.Partitions, old.Spec.Partitions) {
+		return errors.New("The spec.partitions entry has been changed.  If " +
+			"you need to modify spec.partitions you must first delete the " +
+			"document and then recreate it.")
 	}
 
-	err = r.compareElements(
-				r.Spec.Pods.EnvFrom, old.Spec.Pods.EnvFrom, "EnvFrom")
+	/*
+	 * The replicas cannot be switched between pre-created PVCs and PVCs
+	 * which are created by the operator, and the template of the PVCs which
+	 * are created by the operator cannot be changed.
+	 */
 
-	if err != nil {
-		return
+	if (r.Spec.Replicas.Count == 0) != (old.Spec.Replicas.Count == 0) {
+		return errors.New("The spec.replicas.pvcs and spec.replicas.count " +
+			"entries cannot be interchanged.  If you need to change the " +
+			"way in which the PVCs are specified you must first delete the " +
+			"document and then recreate it.")
+	}
+
+	if ! reflect.DeepEqual(r.Spec.Replicas.VolumeClaimTemplate, 
+						old.Spec.Replicas.VolumeClaimTemplate) {
+		return errors.New("The spec.replicas.volumeClaimTemplate entry has " +
+			"been changed.  The template of the PVCs cannot be modified.")
 	}
 
-	err = r.compareElements(r.Spec.Pods.Env, old.Spec.Pods.Env, "Env")
+	err = r.Spec.ValidateStorageSize(&old.Spec)
 
 	if err != nil {
 		return
 	}
 
-	err = r.compareElements(r.Spec.Pods.ServiceAccountName, 
-				old.Spec.Pods.ServiceAccountName, "ServiceAccountName")
+	old.ResolveReplicaPVCs()
 
-	if err != nil {
-		return
+	for _, pvcName := range old.Spec.Replicas.PVCs {
+		if ! utils.Contains(r.Spec.Replicas.PVCs, pvcName) {
+			continue
+		}
+
+		oldGroup := old.Spec.GetReplicaGroup(pvcName)
+		newGroup := r.Spec.GetReplicaGroup(pvcName)
+
+		if oldGroup != newGroup && len(r.Spec.Partitions) > 0 {
+			return errors.New(fmt.Sprintf("The replica, %s, cannot be moved " +
+				"from the replica group '%s' to the replica group '%s'.",
+				pvcName, oldGroup, newGroup))
+		}
 	}
 
 	return 
@@ -795,104 +1133,85 @@ func (r *IBMSecurityVerifyDirectory) getPrimaryWriteMasters() (primaries map[str
 	port    := service.Spec.Ports[0].Port
 
 	/*
-	 * Work out some of the configuration information for the proxy.
+	 * Work out some of the configuration information for the proxy.  If
+	 * the replica groups have been placed in zones the configuration of 
+	 * the proxy without a zone is not maintained, and so the configuration
+	 * of a zone is used instead.  The configuration of the proxy without a
+	 * zone is used if the configuration of the zones doesn't exist yet
+	 * (i.e. the zones are being added by this update).
 	 */
 
-	configMapName := utils.GetProxyConfigMapName(r.Name)
+	secretNames := []string{}
 
-	config := &corev1.ConfigMap{}
-	err	    = k8s_client.Get(context.TODO(), client.ObjectKey{
-						Namespace: r.Namespace,
-						Name:      configMapName }, 
-					config)
+	for _, zone := range r.Spec.GetZones() {
+		secretNames = append(secretNames, utils.GetProxyZoneName(
+						utils.GetProxyConfigName(r.Name), zone))
+	}
+
+	secretNames = append(secretNames, utils.GetProxyConfigName(r.Name))
+
+	var secretName string
+
+	secret := &corev1.Secret{}
+
+	for _, secretName = range secretNames {
+		err = k8s_client.Get(context.TODO(), client.ObjectKey{
+							Namespace: r.Namespace,
+							Name:      secretName }, 
+						secret)
 
-	logger.V(1).Info("Retrieved the proxy ConfigMap", 
-			r.createLogParams("ConfigMap", config)...)
+		if err == nil || ! k8serrors.IsNotFound(err) {
+			break
+		}
+	}
 
 	if err != nil {
- 		logger.Error(err, "Failed to retrieve the ConfigMap",
-						r.createLogParams("ConfigMap.Name", configMapName)...)
+ 		logger.Error(err, "Failed to retrieve the proxy configuration",
+						r.createLogParams("Secret.Name", secretName)...)
 
 		return 
 	}
 
 	/*
-	 * Parse the configuration data into a map.
+	 * Parse the configuration data into the typed configuration model.
 	 */
 
-    var body interface{}
-
-    err = yaml.Unmarshal([]byte(config.Data[utils.ProxyCMKey]), &body)
+	proxyConfig, err := utils.ParseConfig(
+						string(secret.Data[utils.ProxyCMKey]))
 
 	if err != nil {
-		logger.Error(err, "Failed to decode the data from the ConfigMap.",
-				r.createLogParams("ConfigMap.Name", configMapName,
-				"ConfigMap.Key", utils.ProxyCMKey)...)
+		logger.Error(err, "Failed to decode the proxy configuration.",
+				r.createLogParams("Secret.Name", secretName,
+				"Secret.Key", utils.ProxyCMKey)...)
 
 		return
-    }
-
-	logger.V(1).Info("Retrieved the proxy ConfigMap data", 
-			r.createLogParams("Key", utils.ProxyCMKey, "Data", body)...)
-
-
-	body      = utils.ConvertYaml(body)
-	body, ok := body.(map[string]interface{})
-
-	if ! ok {
-		err = errors.New("Failed to decode the ConfigMap for the proxy.")
-
-		logger.Error(err, "Failed to decode the data from the ConfigMap.",
-				r.createLogParams("ConfigMap.Name", configMapName,
-				"ConfigMap.Key", utils.ProxyCMKey)...)
-
-		return 
 	}
 
+	logger.V(1).Info("Retrieved the proxy configuration", 
+			r.createLogParams("Secret.Name", secretName)...)
+
 	/*
-	 * Retrieve the data from the map.
+	 * Retrieve the data from the configuration.
 	 */
 
-	secure    := false
-	adminDn   := "cn=root"
-	adminPwd  := ""
-
-	entry := utils.GetYamlValue(body, []string{"general","ports","ldap"}, 
-						true, r.Namespace)
-
-	if entry != nil {
-		iport, ok := entry.(int)
-
-		if ! ok {
-			err = errors.New(
-						"The general.ports.ldap configuration is incorrect.")
-
-			return
-		}
+	_, secure, err := proxyConfig.GetPort(r.Namespace)
 
-		if (iport == 0) {
-			secure = true
-		}
+	if err != nil {
+		return
 	}
 
-	entry = utils.GetYamlValue(body, []string{"general","admin","dn"}, 
-						true, r.Namespace)
+	adminDn, err := proxyConfig.GetAdminDn(true, r.Namespace)
 
-	if entry != nil {
-		adminDn = entry.(string)
+	if err != nil {
+		return
 	}
 
-	entry = utils.GetYamlValue(body, []string{"general","admin","pwd"}, 
-						true, r.Namespace)
-
-	if entry == nil {
-		err = errors.New("The general.admin.pwd configuration is missing.")
+	adminPwd, err := proxyConfig.GetAdminPwd(true, r.Namespace)
 
+	if err != nil {
 		return
 	}
 
-	adminPwd = entry.(string)
-
 	/*
 	 * Connect to the server.
 	 */
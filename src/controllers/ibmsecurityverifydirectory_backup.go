@@ -0,0 +1,684 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * manage the scheduled backups of the directory data.  The backups are taken
+ * by a CronJob which exports each of the suffixes, in LDIF format, from the
+ * chosen replica to the backup PVC.  The CronJob prunes the old backups from
+ * the PVC, and the controller records the result of each backup in the
+ * status of the document.
+ */
+
+/*****************************************************************************/
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	ctrl  "sigs.k8s.io/controller-runtime"
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The directory at which the backup PVC is mounted, and the command which is
+ * used to export the data of each suffix.
+ */
+
+const BackupMountPath     = "/var/isvd/backup"
+const BackupExportCommand = "idsldapsearch"
+
+/*
+ * The number of backups which are retained if no retention has been
+ * specified, and the number of finished jobs which are kept by the CronJob.
+ */
+
+const DefaultBackupRetention = 7
+const BackupJobHistoryLimit  = 3
+
+/*
+ * The key, within the backup Secret, which holds the password of the
+ * administrator.
+ */
+
+const BackupPasswordKey = "admin-password"
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to bring the backup CronJob in line with
+ * the document.  The CronJob, along with the Secret which holds the
+ * credentials which are used by the backup, is removed if backups are no
+ * longer required.  The existing backups on the PVC are never removed.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deployBackup(
+			h *RequestHandle) (err error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "deployBackup")...)
+
+	name := r.getBackupName(h.directory)
+
+	if h.directory.Spec.Backup == nil {
+		return r.deleteBackup(h)
+	}
+
+	/*
+	 * The credentials of the administrator may reference a secret, and so
+	 * they need to be resolved as the backup script uses them as is.
+	 */
+
+	adminDn, adminPwd, err := r.resolveAdminCredentials(h)
+
+	if err != nil {
+		return
+	}
+
+	err = r.createSecret(h, name, BackupPasswordKey, adminPwd)
+
+	if err != nil {
+		return
+	}
+
+	cronJob := r.constructBackupCronJob(h, adminDn)
+
+	/*
+	 * Kubernetes will add default values to the CronJob specification and
+	 * so we compare a hash of our specification, in the same way as we do
+	 * for the deployments.
+	 */
+
+	hash := utils.GetSpecHash(cronJob.Spec)
+
+	cronJob.ObjectMeta.Annotations = map[string]string{
+		utils.SpecHashKey: hash,
+	}
+
+	ctrl.SetControllerReference(h.directory, cronJob, r.Scheme)
+
+	existing := &batchv1.CronJob{}
+	err       = r.Get(h.ctx, types.NamespacedName{
+					Name:      name,
+					Namespace: h.directory.Namespace}, existing)
+
+	if err != nil {
+		if ! k8serrors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to retrieve the backup CronJob",
+						r.createLogParams(h, "CronJob.Name", name)...)
+
+			return
+		}
+
+		r.Log.Info("Creating the backup CronJob",
+						r.createLogParams(h, "CronJob.Name", name)...)
+
+		r.Log.V(1).Info("Backup CronJob details",
+						r.createLogParams(h, "Details", cronJob)...)
+
+		err = r.Create(h.ctx, cronJob)
+
+		if err != nil {
+			r.Log.Error(err, "Failed to create the backup CronJob",
+						r.createLogParams(h, "CronJob.Name", name)...)
+		}
+
+		return
+	}
+
+	if existing.ObjectMeta.Annotations[utils.SpecHashKey] == hash {
+		return nil
+	}
+
+	/*
+	 * The CronJob already exists, but the specification has changed.  We
+	 * update the existing object so that we retain the resource version.
+	 */
+
+	existing.ObjectMeta.Labels = cronJob.ObjectMeta.Labels
+	existing.Spec              = cronJob.Spec
+
+	if existing.ObjectMeta.Annotations == nil {
+		existing.ObjectMeta.Annotations = make(map[string]string)
+	}
+
+	existing.ObjectMeta.Annotations[utils.SpecHashKey] = hash
+
+	r.Log.Info("Updating the backup CronJob",
+						r.createLogParams(h, "CronJob.Name", name)...)
+
+	err = r.Update(h.ctx, existing)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to update the backup CronJob",
+						r.createLogParams(h, "CronJob.Name", name)...)
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to delete the backup CronJob, along with
+ * its jobs and the backup Secret.  It is not an error if the resources do
+ * not exist.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteBackup(
+			h *RequestHandle) error {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "deleteBackup")...)
+
+	name := r.getBackupName(h.directory)
+
+	objects := []client.Object{
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: h.directory.Namespace,
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: h.directory.Namespace,
+			},
+		},
+	}
+
+	for _, object := range objects {
+		err := r.Delete(h.ctx, object,
+				client.PropagationPolicy(metav1.DeletePropagationBackground))
+
+		if err == nil {
+			r.Log.Info("Deleted a backup resource",
+				r.createLogParams(h, "Name", name,
+					"Kind", fmt.Sprintf("%T", object))...)
+		} else if ! k8serrors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to delete a backup resource",
+				r.createLogParams(h, "Name", name,
+					"Kind", fmt.Sprintf("%T", object))...)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to construct the CronJob which is used to
+ * take the backups.  Each job of the CronJob exports each of the suffixes
+ * from the chosen replica into a new time-stamped directory on the backup
+ * PVC, removes the oldest backups which exceed the retention, and reports
+ * the location and size of the backup in its termination message.  The
+ * specified DN of the administrator must already have been resolved.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) constructBackupCronJob(
+			h       *RequestHandle,
+			adminDn string) *batchv1.CronJob {
+
+	backup  := h.directory.Spec.Backup
+	name    := r.getBackupName(h.directory)
+	replica := h.directory.Spec.GetBackupReplica(h.directory.Status.Principal)
+	host    := r.getReplicaPodName(h.directory, replica)
+
+	imageName := fmt.Sprintf("%s/verify-directory-server:%s",
+					h.directory.Spec.Pods.Image.Repo,
+					h.directory.Spec.Pods.Image.Label)
+
+	retention := backup.Retention
+
+	if retention <= 0 {
+		retention = DefaultBackupRetention
+	}
+
+	/*
+	 * Construct the export command for each of the suffixes.  The backups
+	 * of each document are held in their own directory of the PVC.
+	 */
+
+	base := fmt.Sprintf("%s/%s", BackupMountPath, h.directory.Name)
+
+	var exports []string
+
+	for _, suffix := range h.config.suffixes {
+		args := []string{
+			BackupExportCommand,
+			"-h", host,
+			"-p", strconv.Itoa(int(h.config.port)),
+			"-D", "\"$ADMIN_DN\"",
+			"-w", "\"$ADMIN_PWD\"",
+		}
+
+		if h.config.secure {
+			args = append(args, "-Z")
+		}
+
+		args = append(args, "-b", shellQuote(suffix), "-s", "sub", "-L",
+				shellQuote("(objectclass=*)"), ">",
+				fmt.Sprintf("\"$dir/%s.ldif\"", getSuffixFileName(suffix)))
+
+		exports = append(exports, strings.Join(args, " "))
+	}
+
+	script := strings.Join([]string{
+		fmt.Sprintf("dir=%s/$(date -u +%%Y%%m%%d%%H%%M%%S)", base),
+		"mkdir -p \"$dir\"",
+		fmt.Sprintf("if ! ( %s ); then rm -rf \"$dir\"; exit 1; fi",
+					strings.Join(exports, " && ")),
+		"size=$(du -sk \"$dir\" | cut -f1)",
+		fmt.Sprintf("ls -1d %s/[0-9]* | sort -r | tail -n +%d | " +
+					"xargs -r rm -rf", base, retention + 1),
+		"echo \"$dir $((size * 1024))\" > /dev/termination-log",
+	}, "\n")
+
+	/*
+	 * Set up the environment variables.  The password of the administrator
+	 * is taken from the backup Secret.
+	 */
+
+	env := append(append([]corev1.EnvVar{}, h.directory.Spec.Pods.Env...),
+		corev1.EnvVar{
+			Name:  "ADMIN_DN",
+			Value: adminDn,
+		},
+		corev1.EnvVar{
+			Name:  "ADMIN_PWD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: name,
+					},
+					Key: BackupPasswordKey,
+				},
+			},
+		},
+	)
+
+	volumes := []corev1.Volume{
+		{
+			Name: "isvd-backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: backup.PVC,
+					ReadOnly:  false,
+				},
+			},
+		},
+	}
+
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "isvd-backup",
+			MountPath: BackupMountPath,
+		},
+	}
+
+	/*
+	 * Create the CronJob.  Only a single backup is allowed to run at a
+	 * time.
+	 */
+
+	labels := utils.LabelsForApp(h.directory.Name, name)
+	suspend := backup.Suspend
+
+	var history      int32 = BackupJobHistoryLimit
+	var backOffLimit int32 = 1
+	var deadline     int64 = int64(BackupTimeout.Seconds())
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: h.directory.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   backup.Schedule,
+			Suspend:                    &suspend,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: &history,
+			FailedJobsHistoryLimit:     &history,
+			JobTemplate:                batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit:          &backOffLimit,
+					ActiveDeadlineSeconds: &deadline,
+					Template:              corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: labels,
+						},
+						Spec: corev1.PodSpec{
+							Volumes:            volumes,
+							ImagePullSecrets:   h.directory.Spec.Pods.Image.ImagePullSecrets,
+							ServiceAccountName: h.directory.Spec.Pods.ServiceAccountName,
+							SecurityContext:    h.directory.Spec.Pods.SecurityContext,
+							RestartPolicy:      corev1.RestartPolicyNever,
+							Containers:         []corev1.Container{{
+								Command:         []string{"sh", "-c", script},
+								Env:             env,
+								Image:           imageName,
+								Name:            name,
+								ImagePullPolicy: h.directory.Spec.Pods.Image.ImagePullPolicy,
+								VolumeMounts:    volumeMounts,
+								TerminationMessagePolicy:
+										corev1.TerminationMessageFallbackToLogsOnError,
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to record the result of each of the
+ * backup jobs in the status of the document.  The status of a backup is
+ * retained until the backup itself has been pruned from the PVC.  The
+ * status is not saved by this function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) checkBackups(
+			h *RequestHandle) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "checkBackups")...)
+
+	backup := h.directory.Spec.Backup
+
+	if backup == nil {
+		h.directory.Status.Backups = nil
+
+		return
+	}
+
+	jobs := &batchv1.JobList{}
+
+	err := r.List(h.ctx, jobs,
+		client.InNamespace(h.directory.Namespace),
+		client.MatchingLabels(utils.LabelsForApp(
+				h.directory.Name, r.getBackupName(h.directory))))
+
+	if err != nil {
+		r.Log.Error(err, "Failed to retrieve the backup jobs",
+						r.createLogParams(h)...)
+
+		return
+	}
+
+	/*
+	 * Merge the state of each of the jobs into the existing status.  The
+	 * jobs themselves are removed by the CronJob, and so the existing status
+	 * is the only record of the older backups.
+	 */
+
+	backups := make(map[string]ibmv1.IBMSecurityVerifyDirectoryBackupStatus)
+
+	for _, entry := range h.directory.Status.Backups {
+		backups[entry.Name] = entry
+	}
+
+	for idx := range jobs.Items {
+		job      := &jobs.Items[idx]
+		previous := backups[job.Name]
+
+		if previous.Result == ibmv1.BackupResultSucceeded ||
+				previous.Result == ibmv1.BackupResultFailed {
+			continue
+		}
+
+		entry := r.getBackupStatus(h, job)
+
+		switch entry.Result {
+			case ibmv1.BackupResultSucceeded:
+				r.recordEvent(h, EventBackupSucceeded,
+					"The backup, %s, has completed: %s (%d bytes).",
+					job.Name, entry.Location, entry.Size)
+
+			case ibmv1.BackupResultFailed:
+				r.recordWarning(h, EventBackupFailed,
+					"The backup, %s, has failed: %s", job.Name, entry.Message)
+		}
+
+		backups[job.Name] = entry
+	}
+
+	/*
+	 * Order the backups, newest first, and prune those backups which are
+	 * no longer retained.  Only the most recent failures are kept.
+	 */
+
+	var sorted []ibmv1.IBMSecurityVerifyDirectoryBackupStatus
+
+	for _, entry := range backups {
+		sorted = append(sorted, entry)
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].StartTime == nil || sorted[j].StartTime == nil {
+			return sorted[i].Name > sorted[j].Name
+		}
+
+		if sorted[i].StartTime.Equal(sorted[j].StartTime) {
+			return sorted[i].Name > sorted[j].Name
+		}
+
+		return sorted[j].StartTime.Before(sorted[i].StartTime)
+	})
+
+	retention := int(backup.Retention)
+
+	if retention <= 0 {
+		retention = DefaultBackupRetention
+	}
+
+	var retained  []ibmv1.IBMSecurityVerifyDirectoryBackupStatus
+	var succeeded int
+	var failed    int
+
+	for _, entry := range sorted {
+		if succeeded >= retention {
+			break
+		}
+
+		switch entry.Result {
+			case ibmv1.BackupResultSucceeded:
+				succeeded++
+
+			case ibmv1.BackupResultFailed:
+				failed++
+
+				if failed > BackupJobHistoryLimit {
+					continue
+				}
+		}
+
+		retained = append([]ibmv1.IBMSecurityVerifyDirectoryBackupStatus{
+							entry}, retained...)
+	}
+
+	h.directory.Status.Backups = retained
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to work out the status of a single backup
+ * job.  The location and size of a successful backup are taken from the
+ * termination message of the pod of the job.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getBackupStatus(
+			h   *RequestHandle,
+			job *batchv1.Job) ibmv1.IBMSecurityVerifyDirectoryBackupStatus {
+
+	entry := ibmv1.IBMSecurityVerifyDirectoryBackupStatus{
+		Name:           job.Name,
+		StartTime:      job.Status.StartTime,
+		CompletionTime: job.Status.CompletionTime,
+		Result:         ibmv1.BackupResultRunning,
+	}
+
+	if entry.StartTime == nil {
+		entry.StartTime = &job.ObjectMeta.CreationTimestamp
+	}
+
+	/*
+	 * Determine whether the job has finished.
+	 */
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+			case batchv1.JobComplete:
+				entry.Result = ibmv1.BackupResultSucceeded
+
+			case batchv1.JobFailed:
+				entry.Result  = ibmv1.BackupResultFailed
+				entry.Message = condition.Message
+
+				if entry.CompletionTime == nil {
+					entry.CompletionTime = &condition.LastTransitionTime
+				}
+		}
+	}
+
+	if entry.Result == ibmv1.BackupResultRunning {
+		return entry
+	}
+
+	/*
+	 * Retrieve the termination message of the most recent pod of the job.
+	 */
+
+	pods := &corev1.PodList{}
+
+	err := r.List(h.ctx, pods,
+		client.InNamespace(h.directory.Namespace),
+		client.MatchingLabels{"job-name": job.Name})
+
+	if err != nil {
+		r.Log.Error(err, "Failed to retrieve the pods of the backup job",
+						r.createLogParams(h, "Job.Name", job.Name)...)
+
+		return entry
+	}
+
+	var message string
+	var latest  *metav1.Time
+
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+
+			if terminated == nil {
+				continue
+			}
+
+			if latest == nil || latest.Before(&terminated.FinishedAt) {
+				latest  = &terminated.FinishedAt
+				message = strings.TrimSpace(terminated.Message)
+			}
+		}
+	}
+
+	if entry.Result == ibmv1.BackupResultFailed {
+		if message != "" {
+			entry.Message = message
+		}
+
+		return entry
+	}
+
+	/*
+	 * The termination message of a successful backup contains the location
+	 * and the size of the backup.
+	 */
+
+	fields := strings.Fields(message)
+
+	if len(fields) == 2 {
+		entry.Location = fields[0]
+		entry.Size, _  = strconv.ParseInt(fields[1], 10, 64)
+	}
+
+	entry.Message = "The backup has completed."
+
+	return entry
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to generate the name of the backup CronJob
+ * and the backup Secret.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getBackupName(
+			directory *ibmv1.IBMSecurityVerifyDirectory) string {
+	return strings.ToLower(fmt.Sprintf("%s-backup", directory.Name))
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to generate the name of the file, within
+ * the backup directory, which holds the export of the specified suffix.
+ */
+
+func getSuffixFileName(suffix string) string {
+	return strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			return c
+		}
+
+		return '_'
+	}, strings.ToLower(suffix))
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to quote the specified value so that it
+ * can be safely used within a shell command.
+ */
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "'\\''") + "'"
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,234 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the scheduled backups.
+ */
+
+/*****************************************************************************/
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"context"
+	"time"
+
+	"k8s.io/client-go/tools/record"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("backups", func() {
+	const namespace = "default"
+	const jobName   = "isvd-backup-1"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var recorder   *record.FakeRecorder
+	var h          *RequestHandle
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, recorder = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace,
+				[]string{"replica-1", "replica-2"})
+
+		h.directory.Spec.Backup = &ibmv1.IBMSecurityVerifyDirectoryBackup{
+			Schedule:  "0 2 * * *",
+			PVC:       "backup-pvc",
+			Replica:   "replica-2",
+			Retention: 2,
+		}
+	})
+
+	AfterEach(func() {
+		k8sClient.Delete(context.Background(), &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: namespace},
+		})
+		k8sClient.Delete(context.Background(), &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: namespace},
+		})
+	})
+
+	It("exports each suffix from the chosen replica", func() {
+		cronJob := reconciler.constructBackupCronJob(h, "cn=admin")
+
+		Expect(cronJob.Name).To(Equal("isvd-backup"))
+		Expect(cronJob.Spec.Schedule).To(Equal("0 2 * * *"))
+		Expect(cronJob.Spec.ConcurrencyPolicy).To(
+						Equal(batchv1.ForbidConcurrent))
+
+		pod    := cronJob.Spec.JobTemplate.Spec.Template.Spec
+		script := pod.Containers[0].Command[2]
+
+		Expect(pod.Volumes[0].PersistentVolumeClaim.ClaimName).To(
+						Equal("backup-pvc"))
+		Expect(script).To(ContainSubstring(
+			"idsldapsearch -h isvd-replica-2 -p 9389 -D \"$ADMIN_DN\" " +
+			"-w \"$ADMIN_PWD\" -b 'o=sample' -s sub -L '(objectclass=*)' > " +
+			"\"$dir/o_sample.ldif\""))
+		Expect(script).To(ContainSubstring("tail -n +3"))
+		Expect(pod.Containers[0].Env).To(ContainElement(
+			corev1.EnvVar{Name: "ADMIN_DN", Value: "cn=admin"}))
+	})
+
+	It("does not modify the environment of the document", func() {
+		h.directory.Spec.Pods.Env = make([]corev1.EnvVar, 1, 10)
+		h.directory.Spec.Pods.Env[0] = corev1.EnvVar{Name: "A", Value: "B"}
+
+		reconciler.constructBackupCronJob(h, "cn=admin")
+
+		Expect(h.directory.Spec.Pods.Env[:2][1]).To(Equal(corev1.EnvVar{}))
+	})
+
+	It("resolves the administrator credentials from a secret", func() {
+		utils.K8sClient = k8sClient
+
+		Expect(k8sClient.Create(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "isvd-admin", Namespace: namespace},
+			StringData: map[string]string{
+				"dn": "cn=admin", "pwd": "passw0rd"},
+		})).To(Succeed())
+
+		DeferCleanup(func() {
+			k8sClient.Delete(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "isvd-admin", Namespace: namespace},
+			})
+		})
+
+		h.config.adminDn  = "secret:isvd-admin/dn"
+		h.config.adminPwd = "secret:isvd-admin/pwd"
+
+		adminDn, adminPwd, err := reconciler.resolveAdminCredentials(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adminDn).To(Equal("cn=admin"))
+		Expect(adminPwd).To(Equal("passw0rd"))
+
+		h.config.adminPwd = "secret:isvd-admin/missing"
+
+		_, _, err = reconciler.resolveAdminCredentials(h)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("records the result of a completed backup", func() {
+		labels := utils.LabelsForApp("isvd", "isvd-backup")
+
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: namespace,
+				Labels:    labels,
+			},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						RestartPolicy: corev1.RestartPolicyNever,
+						Containers:    []corev1.Container{{
+							Name:  "backup",
+							Image: "icr.io/isvd/verify-directory-server",
+						}},
+					},
+				},
+			},
+		}
+
+		Expect(k8sClient.Create(context.Background(), job)).To(Succeed())
+
+		now := metav1.Now()
+
+		job.Status.StartTime      = &now
+		job.Status.CompletionTime = &now
+		job.Status.Succeeded      = 1
+		job.Status.Conditions     = []batchv1.JobCondition{{
+			Type:   batchv1.JobComplete,
+			Status: corev1.ConditionTrue,
+		}}
+
+		Expect(k8sClient.Status().Update(
+						context.Background(), job)).To(Succeed())
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: namespace,
+				Labels:    map[string]string{"job-name": jobName},
+			},
+			Spec: job.Spec.Template.Spec,
+		}
+
+		Expect(k8sClient.Create(context.Background(), pod)).To(Succeed())
+
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "backup",
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					FinishedAt: now,
+					Message:    "/var/isvd/backup/isvd/20260101020000 4096",
+				},
+			},
+		}}
+
+		Expect(k8sClient.Status().Update(
+						context.Background(), pod)).To(Succeed())
+
+		/*
+		 * The status of an older backup, which is beyond the retention,
+		 * should be pruned.
+		 */
+
+		type backupStatus = ibmv1.IBMSecurityVerifyDirectoryBackupStatus
+
+		old := func(name string, age time.Duration) backupStatus {
+			start := metav1.NewTime(now.Add(-age))
+
+			return backupStatus{
+				Name:      name,
+				StartTime: &start,
+				Result:    ibmv1.BackupResultSucceeded,
+			}
+		}
+
+		h.directory.Status.Backups = []backupStatus{
+			old("isvd-backup-old", 48 * time.Hour),
+			old("isvd-backup-recent", 24 * time.Hour),
+		}
+
+		reconciler.checkBackups(h)
+
+		backups := h.directory.Status.Backups
+
+		Expect(backups).To(HaveLen(2))
+		Expect(backups[0].Name).To(Equal("isvd-backup-recent"))
+		Expect(backups[1].Name).To(Equal(jobName))
+		Expect(backups[1].Result).To(Equal(ibmv1.BackupResultSucceeded))
+		Expect(backups[1].Location).To(
+						Equal("/var/isvd/backup/isvd/20260101020000"))
+		Expect(backups[1].Size).To(Equal(int64(4096)))
+
+		Expect(getRecordedEvents(recorder)).To(ContainElement(
+						ContainSubstring(EventBackupSucceeded)))
+	})
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,324 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * clone a new deployment from another, running, document.  A backup is
+ * taken from the principal of the source document, within the seed volume
+ * of the principal, and each of the replicas of the new deployment is then
+ * seeded from this backup.  The seeded replicas are given their own
+ * replication topology and proxy by the remainder of the workflow.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The prefix of the directory, within the seed volume of the principal of
+ * the source document, which is used to hold the backup from which the new
+ * deployment is cloned.
+ */
+
+const CloneBackupPrefix = "clone-backup"
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the BackingUpSource phase of
+ * the workflow.  The replica of the source document which is to be cloned
+ * is chosen, and saved in the status, and a backup is then taken from the
+ * running replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) backupSource(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "backupSource",
+						"Source", h.directory.Spec.CloneFrom)...)
+
+	source, err := r.getCloneSource(h)
+
+	if err != nil {
+		return "", err
+	}
+
+	/*
+	 * The principal of the source document is cloned.  The chosen replica is
+	 * saved so that a change of principal in the source document doesn't
+	 * affect a clone which is in progress.
+	 */
+
+	if h.directory.Status.CloneSource == "" {
+		sourcePvc := source.Status.Principal
+
+		if ! utils.Contains(source.Spec.Replicas.PVCs, sourcePvc) {
+			sourcePvc = source.Spec.Replicas.Principal
+		}
+
+		if sourcePvc == "" && len(source.Spec.Replicas.PVCs) > 0 {
+			sourcePvc = source.Spec.Replicas.PVCs[0]
+		}
+
+		if sourcePvc == "" {
+			return "", errors.New(fmt.Sprintf("The document, %s, does not " +
+				"contain any replicas which can be cloned.", source.Name))
+		}
+
+		h.directory.Status.CloneSource = sourcePvc
+
+		if err := r.Status().Update(h.ctx, h.directory); err != nil {
+			r.Log.Error(err, "Failed to update the clone source for the " +
+					"resource", r.createLogParams(h, "Source.PVC", sourcePvc)...)
+
+			return "", err
+		}
+	}
+
+	sourcePvc := h.directory.Status.CloneSource
+
+	podName, err := r.getReplicaSetPodName(h,
+						r.getReplicaPodName(source, sourcePvc))
+
+	if err != nil {
+		return "", err
+	}
+
+	complete, err := r.takeSeedBackup(
+					h, sourcePvc, podName, r.getCloneBackupDir(h.directory))
+
+	if err != nil {
+		return "", err
+	}
+
+	if !complete {
+		return ibmv1.PhaseBackingUpSource, nil
+	}
+
+	r.Log.Info("The backup of the source has completed",
+			r.createLogParams(h, "Source", source.Name,
+					"Source.PVC", sourcePvc)...)
+
+	return ibmv1.PhaseCloningReplicas, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the CloningReplicas phase of
+ * the workflow.  We kick off a seed job for the principal, and each of the
+ * other new replicas, using the backup which was taken from the source, and
+ * then wait for all of the jobs to complete.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) cloneReplicas(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "cloneReplicas",
+						"Source", h.directory.Spec.CloneFrom)...)
+
+	source, err := r.getCloneSource(h)
+
+	if err != nil {
+		return "", err
+	}
+
+	sourcePvc := h.directory.Status.CloneSource
+	backup    := r.getCloneBackupDir(h.directory)
+	replicas  := append([]string{h.directory.Status.Principal},
+						h.directory.Status.ReplicasToAdd...)
+
+	/*
+	 * The seed configuration ensures that the replication configuration of
+	 * the source is not carried over to the clone.
+	 */
+
+	seedConfigMapName := r.getSeedConfigMapName(h.directory)
+
+	err = r.createConfigMap(h, seedConfigMapName,
+			ConfigMapKey, "seed: \n  replica: \n    clean: true\n")
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, pvcName := range replicas {
+		if utils.Contains(h.directory.Status.SeededReplicas, pvcName) {
+			continue
+		}
+
+		err = r.seedReplicaFrom(h, source, sourcePvc, backup, pvcName)
+
+		if err != nil {
+			r.deleteConfigMap(h, seedConfigMapName)
+
+			return "", err
+		}
+	}
+
+	/*
+	 * Check whether all of the seed jobs have completed.
+	 */
+
+	complete, err := r.checkSeedJobs(h, replicas)
+
+	if err != nil {
+		r.deleteConfigMap(h, seedConfigMapName)
+
+		return "", err
+	}
+
+	if !complete {
+		return ibmv1.PhaseCloningReplicas, nil
+	}
+
+	/*
+	 * Delete the temporary ConfigMap, along with the backup which was taken
+	 * from the source.
+	 */
+
+	r.deleteConfigMap(h, seedConfigMapName)
+
+	err = r.removeCloneBackup(h)
+
+	if err != nil {
+		return "", err
+	}
+
+	r.recordEvent(h, EventCloned,
+			"The deployment has been cloned from the replica, %s, of the " +
+			"document, %s.", sourcePvc, source.Name)
+
+	now := metav1.Now()
+
+	h.directory.Status.ClonedReplicas = replicas
+	h.directory.Status.SeededReplicas = nil
+	h.directory.Status.CloneTime      = &now
+
+	return ibmv1.PhaseCreatingPrincipal, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to remove the backup which was taken from
+ * the source of the clone.  It is not an error if the backup does not
+ * exist.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) removeCloneBackup(
+			h *RequestHandle) error {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "removeCloneBackup")...)
+
+	if h.directory.Status.CloneSource == "" {
+		return nil
+	}
+
+	source, err := r.getCloneSource(h)
+
+	if err != nil {
+		return err
+	}
+
+	podName, err := r.getReplicaSetPodName(h,
+				r.getReplicaPodName(source, h.directory.Status.CloneSource))
+
+	if err != nil {
+		return err
+	}
+
+	return r.executeCommand(h, podName, []string{"rm", "-rf",
+		fmt.Sprintf("%s/%s", SeedVolumePath, r.getCloneBackupDir(h.directory))})
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether each of the replicas
+ * which are being added by the current workflow has already been seeded
+ * from the source of the clone.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isCloned(
+			h *RequestHandle) bool {
+
+	if len(h.directory.Status.ClonedReplicas) == 0 {
+		return false
+	}
+
+	for _, pvcName := range h.directory.Status.ReplicasToAdd {
+		if ! utils.Contains(h.directory.Status.ClonedReplicas, pvcName) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the document which is being
+ * cloned.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getCloneSource(
+			h *RequestHandle) (*ibmv1.IBMSecurityVerifyDirectory, error) {
+
+	source := &ibmv1.IBMSecurityVerifyDirectory{}
+
+	err := r.Get(h.ctx, types.NamespacedName{
+				Name:      h.directory.Spec.CloneFrom,
+				Namespace: h.directory.Namespace}, source)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to retrieve the source of the clone",
+				r.createLogParams(h, "Source", h.directory.Spec.CloneFrom)...)
+
+		return nil, err
+	}
+
+	source.ResolveReplicaPVCs()
+
+	return source, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to generate the name of the directory,
+ * within the seed volume of the source replica, which holds the backup from
+ * which the specified document is cloned.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getCloneBackupDir(
+			directory *ibmv1.IBMSecurityVerifyDirectory) string {
+	return strings.ToLower(
+				fmt.Sprintf("%s-%s", CloneBackupPrefix, directory.Name))
+}
+
+/*****************************************************************************/
+
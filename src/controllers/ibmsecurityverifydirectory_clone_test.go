@@ -0,0 +1,155 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the cloning of a deployment from another
+ * document.
+ */
+
+/*****************************************************************************/
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("backupSource", func() {
+	const namespace = "default"
+
+	var executor   *FakePodExecutor
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+	var state      string
+	var process    string
+	var df         string
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		state   = ""
+		process = "alive"
+		df      = testDfOutput
+
+		executor = &FakePodExecutor{
+			Handler: func(pod string, command []string) (string, string, error) {
+				switch {
+					case command[0] == "df":
+						return df, "", nil
+
+					case strings.HasPrefix(command[len(command)-1], "cat "):
+						return state, "", nil
+
+					case strings.HasPrefix(command[len(command)-1], "kill "):
+						return process, "", nil
+				}
+
+				return "", "", nil
+			},
+		}
+
+		reconciler, _ = newTestReconciler(executor, &FakePodResolver{
+			Pods: map[string]string{
+				"prod-replica-2": "prod-replica-2-pod",
+			},
+		})
+
+		source := newTestHandle("prod", namespace,
+				[]string{"replica-1", "replica-2"}).directory
+
+		source.Spec.Replicas.SeedMode = ibmv1.SeedModeOnline
+
+		createTestDocument(source)
+
+		source.Status.Principal = "replica-2"
+
+		Expect(k8sClient.Status().Update(
+						context.Background(), source)).To(Succeed())
+
+		h = newTestHandle("staging", namespace,
+				[]string{"clone-1", "clone-2"})
+
+		h.directory.Spec.CloneFrom = "prod"
+
+		createTestDocument(h.directory)
+	})
+
+	It("backs up the principal of the source", func() {
+		phase, err := reconciler.backupSource(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseBackingUpSource))
+		Expect(h.directory.Status.CloneSource).To(Equal("replica-2"))
+
+		commands := executor.Commands()
+
+		Expect(commands).To(HaveLen(6))
+		Expect(commands[2]).To(Equal("prod-replica-2-pod: rm -rf " +
+				"/var/isvd/seed/clone-backup-staging"))
+		Expect(commands[3]).To(HavePrefix("prod-replica-2-pod: df "))
+		Expect(commands[4]).To(HavePrefix("prod-replica-2-pod: df "))
+		Expect(commands[5]).To(HavePrefix("prod-replica-2-pod: sh -c " +
+				"rm -rf /var/isvd/seed/clone-backup-staging && "))
+
+		state = "running"
+
+		phase, err = reconciler.backupSource(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseBackingUpSource))
+
+		state = "complete"
+
+		phase, err = reconciler.backupSource(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseCloningReplicas))
+	})
+
+	It("reports a failed backup", func() {
+		state = "failed"
+
+		_, err := reconciler.backupSource(h)
+
+		Expect(err).To(HaveOccurred())
+		Expect(executor.Commands()).To(ContainElement(
+			"prod-replica-2-pod: rm -f " +
+			"/var/isvd/seed/clone-backup-staging/.state"))
+	})
+
+	It("reports a backup whose process is no longer running", func() {
+		state   = "running"
+		process = "lost"
+
+		_, err := reconciler.backupSource(h)
+
+		Expect(err).To(MatchError(ContainSubstring("no longer running")))
+	})
+
+	It("refuses to start a backup without enough free space", func() {
+		df = "Filesystem     1024-blocks    Used Available Capacity Mounted on\n" +
+			"/dev/sdb           4194304 3145728   1048576      75% /var/isvd/data\n"
+
+		_, err := reconciler.backupSource(h)
+
+		Expect(err).To(MatchError(ContainSubstring("free space")))
+
+		for _, command := range executor.Commands() {
+			Expect(command).NotTo(ContainSubstring(SeedBackupCommand))
+		}
+	})
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,416 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * execute the isvd_manage_replica command within a replica, and to
+ * interpret the results of the command.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+/*****************************************************************************/
+
+/*
+ * The name of the command which is used to manage the replication
+ * agreements of a replica.
+ */
+
+const ManageReplicaCommand = "isvd_manage_replica"
+
+/*
+ * The name of the command which is used to delete an entry from the
+ * directory of a replica.
+ */
+
+const LdapDeleteCommand = "idsldapdelete"
+
+/*
+ * The value which is logged in place of a password which is passed as an
+ * argument of a command.
+ */
+
+const RedactedValue = "********"
+
+/*
+ * The name of the condition which reports whether the replication
+ * agreements have been successfully configured.
+ */
+
+const ReplicationConfiguredCondition = "ReplicationConfigured"
+
+/*
+ * The number of times which a command which has failed with a transient
+ * error will be attempted, and the delay between each attempt.
+ */
+
+const CommandAttempts   = 3
+const CommandRetryDelay = 2 * time.Second
+
+/*
+ * The exit code which is reported when the command could not be executed,
+ * or when the exit code of the command is not known.
+ */
+
+const UnknownExitCode = -1
+
+/*****************************************************************************/
+
+/*
+ * The classification of a failed command.
+ */
+
+type CommandErrorClass string
+
+const (
+	/*
+	 * The command failed because of a condition which is expected to clear
+	 * by itself, such as the server not yet accepting connections.  The
+	 * command can be retried.
+	 */
+
+	CommandErrorTransient CommandErrorClass = "Transient"
+
+	/*
+	 * The command failed because of a condition which requires intervention,
+	 * such as invalid credentials.  Retrying the command will not help.
+	 */
+
+	CommandErrorPermanent CommandErrorClass = "Permanent"
+
+	/*
+	 * The command failed because the replication agreement which was
+	 * being operated on does not exist.
+	 */
+
+	CommandErrorNotFound CommandErrorClass = "NotFound"
+)
+
+/*****************************************************************************/
+
+/*
+ * The CommandResult structure contains the result of a command which has
+ * been executed within a pod.  The command is held with the value of any
+ * password argument redacted.
+ */
+
+type CommandResult struct {
+	Pod      string
+	Command  []string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+/*
+ * The CommandError structure is used to report a command which has failed,
+ * along with the classification of the failure.
+ */
+
+type CommandError struct {
+	Result *CommandResult
+	Class  CommandErrorClass
+	Reason string
+	Err    error
+}
+
+/*
+ * The CommandFailure structure is used to map the output of a failed
+ * isvd_manage_replica command to a classification.
+ */
+
+type CommandFailure struct {
+	Pattern string
+	Class   CommandErrorClass
+	Reason  string
+}
+
+/*****************************************************************************/
+
+/*
+ * The known failures of the isvd_manage_replica command.  The patterns are
+ * matched, in order, against the lower case output of the command.
+ */
+
+var ManageReplicaFailures = []CommandFailure{
+	{ "no such object",             CommandErrorNotFound,  "AgreementNotFound"  },
+	{ "does not exist",             CommandErrorNotFound,  "AgreementNotFound"  },
+	{ "can't contact ldap server",  CommandErrorTransient, "ServerUnavailable"  },
+	{ "connection refused",         CommandErrorTransient, "ServerUnavailable"  },
+	{ "server is unavailable",      CommandErrorTransient, "ServerUnavailable"  },
+	{ "server is busy",             CommandErrorTransient, "ServerBusy"         },
+	{ "timed out",                  CommandErrorTransient, "Timeout"            },
+	{ "timeout",                    CommandErrorTransient, "Timeout"            },
+	{ "invalid credentials",        CommandErrorPermanent, "InvalidCredentials" },
+	{ "insufficient access",        CommandErrorPermanent, "InsufficientAccess" },
+	{ "already exists",             CommandErrorPermanent, "AgreementExists"    },
+	{ "invalid dn syntax",          CommandErrorPermanent, "InvalidDN"          },
+	{ "usage:",                     CommandErrorPermanent, "InvalidArguments"   },
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function returns the message for a command error.
+ */
+
+func (e *CommandError) Error() string {
+	output := strings.TrimSpace(e.Result.Stderr)
+
+	if output == "" {
+		output = strings.TrimSpace(e.Result.Stdout)
+	}
+
+	return fmt.Sprintf("The command, %s, failed on the pod, %s, with the " +
+		"exit code %d (%s: %s): %s", strings.Join(e.Result.Command, " "),
+		e.Result.Pod, e.Result.ExitCode, e.Class, e.Reason, output)
+}
+
+/*
+ * The following function returns the underlying error of a command error.
+ */
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the specified error
+ * is a command error of the specified class.
+ */
+
+func isCommandError(err error, class CommandErrorClass) bool {
+	var cmdErr *CommandError
+
+	return errors.As(err, &cmdErr) && cmdErr.Class == class
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to classify the failure of an
+ * isvd_manage_replica command.  A failure to execute the command at all
+ * (e.g. because the container is not running) is treated as transient, as
+ * is an unknown failure.
+ */
+
+func classifyManageReplicaFailure(
+			result *CommandResult) (CommandErrorClass, string) {
+
+	if result.ExitCode == UnknownExitCode {
+		return CommandErrorTransient, "ExecFailed"
+	}
+
+	output := strings.ToLower(result.Stdout + "\n" + result.Stderr)
+
+	for _, failure := range ManageReplicaFailures {
+		if strings.Contains(output, failure.Pattern) {
+			return failure.Class, failure.Reason
+		}
+	}
+
+	return CommandErrorPermanent, "CommandFailed"
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to execute a command on the specified
+ * pod, returning the structured result of the command.  An error is only
+ * returned if the command could not be executed or exited with a non-zero
+ * exit code, in which case the result is still returned.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) executeCommandWithResult(
+				h       *RequestHandle,
+				pod     string,
+				command []string) (*CommandResult, error) {
+
+	logged := redactCommand(command)
+
+	r.Log.V(1).Info("Entering a function",
+			r.createLogParams(h, "Function", "executeCommandWithResult",
+					"Pod", pod, "Command", logged)...)
+
+	start := time.Now()
+
+	stdout, stderr, err := r.Executor.Execute(
+						h.ctx, h.directory.Namespace, pod, command)
+
+	result := &CommandResult{
+		Pod:      pod,
+		Command:  logged,
+		ExitCode: 0,
+		Stdout:   stdout,
+		Stderr:   stderr,
+	}
+
+	r.observeCommand(command, start, err)
+
+	if err != nil {
+		var exitErr utilexec.ExitError
+
+		if errors.As(err, &exitErr) && exitErr.Exited() {
+			result.ExitCode = exitErr.ExitStatus()
+		} else {
+			result.ExitCode = UnknownExitCode
+		}
+
+		r.Log.Error(err, "Failed to execute a command!",
+				r.createLogParams(h, "command", logged,
+					"exitCode", result.ExitCode,
+					"stdout", stdout, "stderr", stderr)...)
+
+		return result, err
+	}
+
+	r.Log.V(1).Info("Command Results",
+			r.createLogParams(h, "Pod", pod, "Command", logged,
+				"stdout", stdout, "stderr", stderr)...)
+
+	return result, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to return a copy of the specified command
+ * which can be safely logged, with the value of any password argument (-w)
+ * replaced.
+ */
+
+func redactCommand(command []string) []string {
+	redacted := make([]string, len(command))
+
+	copy(redacted, command)
+
+	for idx := 1; idx < len(redacted); idx++ {
+		if redacted[idx - 1] == "-w" {
+			redacted[idx] = RedactedValue
+		}
+	}
+
+	return redacted
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to execute the isvd_manage_replica
+ * command on the specified pod.  Transient failures are retried, and the
+ * outcome of the command is recorded in the ReplicationConfigured condition
+ * of the document.  Any failure is returned as a CommandError.  The status
+ * is not saved by this function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) executeManageReplica(
+				h    *RequestHandle,
+				pod  string,
+				args ...string) error {
+
+	command := append([]string{ManageReplicaCommand}, args...)
+
+	r.Log.Info("Executing a command",
+			r.createLogParams(h, "Pod", pod, "Command", command)...)
+
+	var cmdErr *CommandError
+
+	for attempt := 1; attempt <= CommandAttempts; attempt++ {
+		result, err := r.executeCommandWithResult(h, pod, command)
+
+		if err == nil {
+			r.setReplicationConfigured(h, nil)
+
+			return nil
+		}
+
+		class, reason := classifyManageReplicaFailure(result)
+
+		cmdErr = &CommandError{
+			Result: result,
+			Class:  class,
+			Reason: reason,
+			Err:    err,
+		}
+
+		if class != CommandErrorTransient {
+			break
+		}
+
+		if attempt < CommandAttempts {
+			r.Log.Info("Retrying a command which failed with a transient error",
+				r.createLogParams(h, "Pod", pod, "Command", command,
+					"Reason", reason, "Attempt", attempt)...)
+
+			select {
+				case <-h.ctx.Done():
+					return cmdErr
+				case <-time.After(CommandRetryDelay):
+			}
+		}
+	}
+
+	/*
+	 * A missing agreement is reported to the caller, but is not treated as
+	 * a failure of the replication configuration.
+	 */
+
+	if cmdErr.Class != CommandErrorNotFound {
+		r.setReplicationConfigured(h, cmdErr)
+	}
+
+	return cmdErr
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set the ReplicationConfigured condition
+ * based on the result of the last isvd_manage_replica command.  The status
+ * is not saved by this function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) setReplicationConfigured(
+				h      *RequestHandle,
+				cmdErr *CommandError) {
+
+	condition := metav1.Condition{
+		Type:               ReplicationConfiguredCondition,
+		ObservedGeneration: h.directory.Generation,
+	}
+
+	if cmdErr == nil {
+		condition.Status  = metav1.ConditionTrue
+		condition.Reason  = "CommandSucceeded"
+		condition.Message = "The replication agreements have been configured."
+	} else {
+		condition.Status  = metav1.ConditionFalse
+		condition.Reason  = cmdErr.Reason
+		condition.Message = cmdErr.Error()
+	}
+
+	meta.SetStatusCondition(&h.directory.Status.Conditions, condition)
+}
+
+/*****************************************************************************/
+
@@ -9,18 +9,28 @@ package controllers
 /*****************************************************************************/
 
 import (
+	appsv1  "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1  "k8s.io/api/core/v1"
 	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"context"
+	"sort"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
 	"github.com/ibm-security/verify-directory-operator/utils"
@@ -37,6 +47,67 @@ import (
 
 const ConfigMapKey = "config.yaml"
 
+/*
+ * The amount of time to wait before checking on the progress of a phase
+ * which is waiting for a resource to become available.
+ */
+
+const RequeueDelay = 5 * time.Second
+
+/*
+ * The maximum amount of time which we will wait for a pod to start, a pod
+ * to stop, and a job to complete.
+ */
+
+const PodStartTimeout = 600 * time.Second
+const PodStopTimeout  = 300 * time.Second
+const JobTimeout      = 600 * time.Second
+
+/*
+ * The maximum amount of time which we will wait for an updated replica to
+ * catch up with the changes which were made on the other replicas.
+ */
+
+const ReplicationTimeout = 900 * time.Second
+
+/*
+ * The maximum amount of time which we will wait for the backup of the 
+ * principal, which is used when seeding replicas in the Online mode, to 
+ * complete.
+ */
+
+const BackupTimeout = 1800 * time.Second
+
+/*
+ * The directory, within the seed volume of the principal, which is used to
+ * hold the backup which is used when seeding replicas in the Online mode, 
+ * along with the command which is used to take the backup.  In the Online
+ * mode each replica is given a seed volume, which is a separate PVC that is
+ * mounted at the seed volume path, so that the backup doesn't consume the
+ * storage of the data volume.
+ */
+
+const SeedBackupDir     = "seed-backup"
+const SeedBackupCommand = "isvd_backup"
+const SeedVolumePath    = "/var/isvd/seed"
+const SeedPVCSuffix     = "seed"
+
+/*
+ * The initial, and maximum, amount of time to wait before retrying a
+ * workflow phase which has failed.  The delay is doubled each time that the
+ * phase fails.
+ */
+
+const RetryDelay    = 10 * time.Second
+const MaxRetryDelay = 600 * time.Second
+
+/*
+ * The amount of time between each check of the health of the replication
+ * agreements once a deployment has been processed.
+ */
+
+const HealthCheckInterval = 60 * time.Second
+
 /*****************************************************************************/
 
 /*
@@ -48,6 +119,9 @@ type IBMSecurityVerifyDirectoryReconciler struct {
 	client.Client
 	Log logr.Logger
 	Scheme *runtime.Scheme
+	Recorder record.EventRecorder
+	Executor PodExecutor
+	Resolver PodResolver
 }
 
 /*****************************************************************************/
@@ -56,13 +130,17 @@ type IBMSecurityVerifyDirectoryReconciler struct {
 //+kubebuilder:rbac:groups=ibm.com,resources=ibmsecurityverifydirectories/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=ibm.com,resources=ibmsecurityverifydirectories/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch;create;update;delete
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;delete
 //+kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;delete
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
-//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;delete
-//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
-//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 /*****************************************************************************/
 
@@ -138,6 +216,8 @@ func (r *IBMSecurityVerifyDirectoryReconciler) Reconcile(
 				"Resource not found most likely due to it having been deleted", 
 								r.createLogParams(&h)...)
 
+			r.deleteDocumentMetrics(req.Namespace, req.Name)
+
 			err = nil
 		} else {
 			/*
@@ -151,64 +231,32 @@ func (r *IBMSecurityVerifyDirectoryReconciler) Reconcile(
 		return ctrl.Result{}, nil
 	}
 
-	r.Log.V(1).Info("Reconciling a document", 
-				r.createLogParams(&h, "Document", h.directory)...)
-
-	/*
-	 * Check to see whether the document is currently in the failing state.
-	 * We don't allow documents to be updated when they are in the failing
-	 * state.
-	 */
-
-	if meta.IsStatusConditionFalse(h.directory.Status.Conditions, "Available") {
-		return ctrl.Result{}, nil
-	}
-
-	/*
-	 * Retrieve the list of existing pods for the deployment.
-	 */
-
-	existing, err := r.getExistingPods(&h)
-
-	if err != nil {
-		r.setCondition(err, &h,
-							"Failed to retrieve the list of existing pods.")
-
-		return ctrl.Result{}, nil
-	}
-
-	r.Log.Info("Existing pods", r.createLogParams(&h, "Pods", existing)...)
-
 	/*
-	 * Work out the list of replicas to be deleted, and the list of
-	 * replicas to be added.
+	 * If the PVCs of the replicas are created by the operator we need to
+	 * generate the names of the PVCs.
 	 */
 
-	toBeDeleted, toBeAdded := r.analyseExistingPods(&h, existing)
+	h.directory.ResolveReplicaPVCs()
 
-	r.Log.Info("Updates required",
-		r.createLogParams(&h, 
-			"to be deleted", toBeDeleted,
-			"to be added", toBeAdded)...)
+	r.Log.V(1).Info("Reconciling a document", 
+				r.createLogParams(&h, "Document", h.directory)...)
 
 	/*
-	 * Mark the deployment as in-progress.
+	 * Check to see whether the document is currently in the failing state.
+	 * If it is we need to wait until the next retry is due before we 
+	 * attempt to process the failed phase of the workflow again.
 	 */
 
-	condition := metav1.Condition{
-		Type:    "InProgress",
-		Reason:  "DeploymentProgress",
-		Message: "The deployment is being processed.",
-		Status:  metav1.ConditionTrue,
-	}
+	if meta.IsStatusConditionFalse(h.directory.Status.Conditions, "Available") {
+		if ! r.isRetryDue(&h) {
+			return r.getRetryResult(&h), nil
+		}
 
-	meta.SetStatusCondition(&h.directory.Status.Conditions, condition)
+		err = r.startRetry(&h)
 
-	if err := r.Status().Update(h.ctx, h.directory); err != nil {
-		r.Log.Error(err, "Failed to update the condition for the resource",
-						r.createLogParams(&h)...)
-	
-		return ctrl.Result{}, nil
+		if err != nil {
+			return ctrl.Result{RequeueAfter: RequeueDelay}, nil
+		}
 	}
 
 	/*
@@ -221,58 +269,40 @@ func (r *IBMSecurityVerifyDirectoryReconciler) Reconcile(
 		r.setCondition(err, &h,
 				"Failed to obtain the server information from the ConfigMap.")
 
-		return ctrl.Result{}, nil
-	}
-
-	if len(toBeDeleted) != 0 || len(toBeAdded) != 0 {
-		/*
-		 * Create the new replicas.
-		 */
-
-		existing, err = r.createReplicas(&h, existing, toBeAdded)
-
-		if err != nil {
-			r.setCondition(err, &h,
-					"Failed to create the new replicas.")
-
-			return ctrl.Result{}, nil
-		}
+		return r.getRetryResult(&h), nil
 	}
 
 	/*
-	 * Now that we have created the replicas we need to deploy the
-	 * front-end proxy.
+	 * If there is no workflow currently in progress we need to work out
+	 * the changes which are required and start a new workflow.  If the 
+	 * document has not changed since the last workflow completed we instead
+	 * just need to bring the deployment back in line with the document, as
+	 * one of the resources which we manage may have been changed or deleted.
 	 */
 
-	err = r.deployProxy(&h)
-
-	if err != nil {
-		r.setCondition(err, &h, "Failed to deploy the proxy.")
-
-		return ctrl.Result{}, nil
-	}
-
-	/*
-	 * Delete the replicas which have been removed from the deployment.
-	 */
+	if h.directory.Status.Phase == "" || 
+					h.directory.Status.Phase == ibmv1.PhaseReady {
+		if r.isDocumentProcessed(&h) {
+			return r.convergeDeployment(&h)
+		}
 
-	err = r.deleteReplicas(&h, existing, toBeDeleted)
+		err = r.startWorkflow(&h)
 
-	if err != nil {
-		r.setCondition(err, &h, "Failed to delete the obsolete replicas.")
+		if err != nil {
+			r.setCondition(err, &h, "Failed to start the workflow.")
 
-		return ctrl.Result{}, nil
+			return r.getRetryResult(&h), nil
+		}
 	}
 
 	/*
-	 * Set the condition of the document.
+	 * Process the current phase of the workflow.  Each phase will either
+	 * complete, in which case we move on to the next phase, or will need to
+	 * wait for a resource to become available, in which case we requeue the
+	 * request rather than blocking the worker.
 	 */
 
-	r.Log.Info("Reconciled the document", r.createLogParams(&h)...)
-
-	r.setCondition(err, &h, "")
-
-	return ctrl.Result{}, nil
+	return r.processPhase(&h)
 }
 
 /*****************************************************************************/
@@ -308,11 +338,46 @@ func (r *IBMSecurityVerifyDirectoryReconciler) setCondition(
 		condition.Message = "The deployment has been updated."
 	}
 
+	/*
+	 * If an error has occurred we schedule a retry of the failed phase,
+	 * otherwise we can clear out any retry information.
+	 */
+
 	if err != nil {
 		condition.Message = err.Error()
 		condition.Status  = metav1.ConditionFalse
+
+		h.directory.Status.RetryCount += 1
+
+		phaseFailures.WithLabelValues(string(h.directory.Status.Phase)).Inc()
+
+		r.recordWarning(h, EventPhaseFailed, "%s %s", msg, err.Error())
+
+		nextRetry := metav1.NewTime(time.Now().Add(
+						r.getRetryDelay(h.directory.Status.RetryCount)))
+
+		h.directory.Status.NextRetryTime = &nextRetry
+		condition.ObservedGeneration = h.directory.Generation
 	} else {
-		condition.Status  = metav1.ConditionTrue
+		/*
+		 * The document is only marked as processed up to the generation
+		 * which was processed by the workflow, so that any changes which
+		 * were made while the workflow was running will start a new 
+		 * workflow.
+		 */
+
+		generation := h.directory.Status.WorkflowGeneration
+
+		if generation == 0 {
+			generation = h.directory.Generation
+		}
+
+		condition.Status             = metav1.ConditionTrue
+		condition.ObservedGeneration = generation
+
+		h.directory.Status.RetryCount         = 0
+		h.directory.Status.NextRetryTime      = nil
+		h.directory.Status.ObservedGeneration = generation
 	}
 
 	r.Log.V(1).Info("Setting a condition", 
@@ -410,6 +475,8 @@ func (r *IBMSecurityVerifyDirectoryReconciler) analyseExistingPods(
 		}
 	}
 
+	sort.Strings(toBeDeleted)
+
 	/*
 	 * Work out the entries to be added.  This consists of those replicas
 	 * which appear in the document which are not in the existing list of
@@ -449,18 +516,74 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createLogParams(
 /*****************************************************************************/
 
 /*
- * SetupWithManager sets up the controller with the Manager.
+ * The following function is used to locate the documents which reference
+ * the specified ConfigMap as either their server or proxy configuration.  It
+ * is used to trigger the reconciliation of these documents whenever the
+ * ConfigMap is changed.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getConfigMapRequests(
+			object client.Object) []reconcile.Request {
+
+	var requests []reconcile.Request
+
+	directories := &ibmv1.IBMSecurityVerifyDirectoryList{}
+
+	err := r.List(context.TODO(), directories, 
+						client.InNamespace(object.GetNamespace()))
+
+	if err != nil {
+ 		r.Log.Error(err, "Failed to retrieve the list of documents",
+					"ConfigMap.Namespace", object.GetNamespace(),
+					"ConfigMap.Name",      object.GetName())
+
+		return nil
+	}
+
+	for _, directory := range directories.Items {
+		configMap := directory.Spec.Pods.ConfigMap
+
+		if configMap.Server.Name == object.GetName() || 
+					configMap.Proxy.Name == object.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      directory.Name,
+					Namespace: directory.Namespace,
+				},
+			})
+		}
+	}
+
+	return requests
+}
+
+/*****************************************************************************/
+
+/*
+ * SetupWithManager sets up the controller with the Manager.  In addition to
+ * the documents themselves we watch each of the resources which are created
+ * by the operator, along with the ConfigMaps which are referenced by the 
+ * documents, so that any drift can be corrected.
  */
 
 func (r *IBMSecurityVerifyDirectoryReconciler) SetupWithManager(
 							mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&ibmv1.IBMSecurityVerifyDirectory{}).
-		WithEventFilter(predicate.Or(
+		For(&ibmv1.IBMSecurityVerifyDirectory{}, 
+			builder.WithPredicates(predicate.Or(
 				predicate.GenerationChangedPredicate{}, 
-				predicate.LabelChangedPredicate{})).
+				predicate.LabelChangedPredicate{}))).
+		Owns(&appsv1.ReplicaSet{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&batchv1.Job{}).
+		Owns(&batchv1.CronJob{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.getConfigMapRequests)).
 		Complete(r)
 }
 
 /*****************************************************************************/
-
@@ -19,131 +19,489 @@ import (
 	corev1  "k8s.io/api/core/v1"
 	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/ibm-security/verify-directory-operator/utils"
 
-	ctrl "sigs.k8s.io/controller-runtime"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	ctrl  "sigs.k8s.io/controller-runtime"
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
 )
 
 /*****************************************************************************/
 
 /*
- * Create the required replicas for this deployment.
+ * The following function is used to process the CreatingPrincipal phase of
+ * the workflow.  The principal doesn't currently exist and so we need to
+ * create the principal and then wait for it to become ready.
  */
 
-func (r *IBMSecurityVerifyDirectoryReconciler) createReplicas(
-			h          *RequestHandle,
-			existing   map[string]string,
-			toBeAdded  []string) (map[string]string, error) {
+func (r *IBMSecurityVerifyDirectoryReconciler) createPrincipal(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
 
-	var err error = nil
+	principal := h.directory.Status.Principal
 
 	r.Log.V(1).Info("Entering a function", 
-				r.createLogParams(h, "Function", "createReplicas")...)
+				r.createLogParams(h, "Function", "createPrincipal",
+						"Principal", principal)...)
+
+	err := r.startReplica(h, principal)
+
+	if err != nil {
+		return "", err
+	}
+
+	ready, err := r.isReplicaReady(h, principal)
+
+	if err != nil || !ready {
+		return ibmv1.PhaseCreatingPrincipal, err
+	}
 
 	/*
-	 * Don't do anything here if there is nothing to be added.
+	 * If the deployment is being bootstrapped from a backup the backup is
+	 * now restored into the directory instance which has been created by
+	 * the principal.
 	 */
 
-	if len(toBeAdded) == 0 {
-		return existing, nil
+	if h.directory.Spec.Restore != nil && 
+				h.directory.Status.RestoreTime == nil {
+		return ibmv1.PhaseRestoringPrincipal, nil
 	}
 
+	r.recordEvent(h, EventPrincipalCreated, 
+				"The principal replica, %s, has been created.", principal)
+
 	/*
-	 * Work out the principal.  If we have any existing replicas the first
-	 * of the existing replicas will be the principal, otherwise the first of
-	 * the new replicas will be the principal.
+	 * If there are no additional replicas to be added we can move straight
+	 * on to the deployment of the proxy.
 	 */
 
-	var principal string
+	if len(h.directory.Status.ReplicasToAdd) == 0 {
+		return ibmv1.PhaseDeployingProxy, nil
+	}
 
-	if len(existing) > 0 {
+	return ibmv1.PhaseCreatingAgreements, nil
+}
 
-		for key, _ := range existing {
-			principal = key
-			break
-		}
+/*****************************************************************************/
 
-		r.Log.V(1).Info("Using a new principal.", 
-			r.createLogParams(h, "Principal", principal)...)
+/*
+ * The following function is used to process the CreatingAgreements phase of
+ * the workflow.  We iterate over each PVC which is to be added, creating the
+ * replication agreement with the principal.
+ */
 
-	} else {
-		principal, toBeAdded = toBeAdded[0], toBeAdded[1:]
+func (r *IBMSecurityVerifyDirectoryReconciler) createPrincipalAgreements(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
 
-		r.Log.Info("Creating the principal replica", 
-					r.createLogParams(h, "pvc", principal)...)
+	principal := h.directory.Status.Principal
 
-		/*
-		 * The principal doesn't currently exist and so we need to create
-		 * the principal now.
-		 */
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "createPrincipalAgreements",
+						"Principal", principal)...)
+
+	/*
+	 * If the principal is no longer healthy we need to fail over to 
+	 * another healthy replica before we create the replication agreements.
+	 */
+
+	healthy, err := r.isReplicaHealthy(h, principal)
 
-		var pod string
+	if err != nil {
+		return "", err
+	}
 
-		pod, err = r.deployReplica(h, principal)
+	if !healthy {
+		principal, err = r.selectPrincipal(h, h.directory.Status.ReplicasToAdd)
 
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
-		r.Log.V(1).Info("Entering a function", 
-			r.createLogParams(h, "Function", "getReplicaDeploymentName", "pod", pod)...)
-		
-		deployment := r.getReplicaDeploymentName(pod)
+		h.directory.Status.Principal = principal
 
-		r.Log.Info("Getting the replica name", 
-						r.createLogParams(h, "Replica.Name", deployment)...)
+		if err := r.Status().Update(h.ctx, h.directory); err != nil {
+			r.Log.Error(err, "Failed to update the principal for the resource",
+						r.createLogParams(h, "Principal", principal)...)
 
-		err = r.createClusterService(h, deployment, h.config.port, principal)
+			return "", err
+		}
+	}
 
-		if err != nil {
-			return nil, err
+	for _, pvcName := range h.directory.Status.ReplicasToAdd {
+		if ! h.directory.Spec.IsSameReplicationDomain(principal, pvcName) {
+			continue
 		}
 
-		err = r.waitForPod(h, pod)
+		err := r.createReplicationAgreement(
+					h, principal, principal, pvcName)
 
 		if err != nil {
-			return nil, err
+			return "", err
 		}
+	}
 
-		existing[principal] = deployment
+	/*
+	 * If the new replicas have already been seeded from the source of a
+	 * clone we can move straight on to starting the replicas.
+	 */
 
-		/*
-		 * If there are no additional replicas to be added we can simply
-		 * return now.
-		 */
+	if r.isCloned(h) {
+		return ibmv1.PhaseStartingReplicas, nil
+	}
 
-		if len(toBeAdded) == 0 {
-			return existing, err
+	/*
+	 * In the Online seeding mode we take a backup of the running principal
+	 * rather than stopping the principal.  Any backup which is left over
+	 * from a previous workflow is removed as it will not contain the 
+	 * changes which have been made since the backup was taken.
+	 */
+
+	if h.directory.Spec.Replicas.SeedMode == ibmv1.SeedModeOnline {
+		err := r.removeSeedBackup(h, principal)
+
+		if err != nil {
+			return "", err
 		}
+
+		return ibmv1.PhaseBackingUpPrincipal, nil
+	}
+
+	return ibmv1.PhaseStoppingPrincipal, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the BackingUpPrincipal phase of
+ * the workflow.  A backup is taken from the running principal, within the
+ * seed volume of the principal, and we then wait for the backup to complete.
+ * The backup is run in the background so that we don't block the worker
+ * while the backup is being taken.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) backupPrincipal(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	principal := h.directory.Status.Principal
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "backupPrincipal",
+						"Principal", principal)...)
+
+	podName, err := r.getReplicaSetPodName(h, 
+						r.getReplicaPodName(h.directory, principal))
+
+	if err != nil {
+		return "", err
+	}
+
+	complete, err := r.takeSeedBackup(h, principal, podName, SeedBackupDir)
+
+	if err != nil {
+		return "", err
+	}
+
+	if complete {
+		r.Log.Info("The backup of the principal has completed",
+			r.createLogParams(h, "Principal", principal)...)
+
+		return ibmv1.PhaseSeedingReplicas, nil
+	}
+
+	return ibmv1.PhaseBackingUpPrincipal, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to take a backup of a running replica, 
+ * within the specified directory of the seed volume of the replica, which 
+ * can then be used to seed other replicas.  The backup is run in the 
+ * background, and so this function should be called until the backup has
+ * completed.  The state of the backup, and the process identifier of the
+ * background process, are held in files within the backup directory.  The
+ * result of the backup is written to a temporary file, and then moved into
+ * place, so that the state remains 'running' until the backup has finished.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) takeSeedBackup(
+			h       *RequestHandle,
+			replica string,
+			podName string,
+			backup  string) (bool, error) {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "takeSeedBackup",
+						"Replica", replica, "Pod.Name", podName,
+						"Backup", backup)...)
+
+	dir := fmt.Sprintf("%s/%s", SeedVolumePath, backup)
+
+	/*
+	 * Determine the current state of the backup.
+	 */
+
+	state, err := r.getSeedBackupState(h, podName, dir)
+
+	if err != nil {
+		return false, err
 	}
 
 	/*
-	 * Iterate over each PVC which is to be added, creating the replication
-	 * agreement with the principal.
+	 * If the backup process is no longer running, but has not recorded a
+	 * result, the process has been lost (e.g. the pod was restarted).  We
+	 * re-read the state in case the process completed after the state was
+	 * first read.
 	 */
 
-	for _, pvcName := range toBeAdded {
-		err = r.createReplicationAgreement(
-					h, principal, principal, pvcName)
+	if state == "running" {
+		alive, err := r.executeCommandWithOutput(h, podName, []string{
+				"sh", "-c", fmt.Sprintf("kill -0 \"$(cat %s/.pid 2>/dev/null)\" " +
+					"2>/dev/null && echo alive || echo lost", dir)})
 
 		if err != nil {
-			return nil, err
+			return false, err
+		}
+
+		if strings.TrimSpace(alive) == "lost" {
+			state, err = r.getSeedBackupState(h, podName, dir)
+
+			if err != nil {
+				return false, err
+			}
+
+			if state == "running" {
+				state = "lost"
+			}
 		}
 	}
 
+	r.Log.V(1).Info("Retrieved the state of the backup", 
+				r.createLogParams(h, "Replica", replica, 
+						"State", state)...)
+
+	switch state {
+		case "complete":
+			return true, nil
+
+		case "failed", "lost":
+			/*
+			 * The state is removed so that the backup is started again
+			 * when the failed phase is retried.
+			 */
+
+			err = r.executeCommand(h, podName, []string{
+						"rm", "-f", fmt.Sprintf("%s/.state", dir)})
+
+			if err != nil {
+				return false, err
+			}
+
+			if state == "lost" {
+				return false, errors.New(fmt.Sprintf("The backup process " +
+					"of the replica, %s, is no longer running.", replica))
+			}
+
+			return false, errors.New(fmt.Sprintf("The backup of the " +
+				"replica, %s, failed.  The log of the backup can be found " +
+				"in the %s/backup.log file of the replica.", replica, dir))
+
+		case "running":
+			if r.hasPhaseTimedOut(h, BackupTimeout) {
+				return false, errors.New(fmt.Sprintf("The backup of the " +
+					"replica, %s, failed to complete within the allocated " +
+					"time.", replica))
+			}
+
+			return false, nil
+	}
+
 	/*
-	 * Stop the principal.
+	 * The backup has not yet been started.  We first make sure that the
+	 * seed volume is mounted in the pod of the replica, which won't be the
+	 * case until the pod has been restarted after the Online seed mode has
+	 * been selected, and that the image of the replica provides the backup
+	 * command.
 	 */
 
-	err = r.deleteReplica(h, principal)
+	missing, err := r.executeCommandWithOutput(h, podName, []string{
+			"sh", "-c", fmt.Sprintf("[ -d %s ] || echo volume; " +
+				"command -v %s > /dev/null 2>&1 || echo command", 
+				SeedVolumePath, SeedBackupCommand)})
 
 	if err != nil {
-		return nil, err
+		return false, err
+	}
+
+	missing = strings.TrimSpace(missing)
+
+	if missing != "" {
+		message := fmt.Sprintf("The %s command, which is used to take a " +
+			"backup of the running replica, is not available in the pod, " +
+			"%s, of the replica, %s.", SeedBackupCommand, podName, replica)
+
+		if strings.Contains(missing, "volume") {
+			message = fmt.Sprintf("The seed volume, %s, is not mounted in " +
+				"the pod, %s, of the replica, %s.", 
+				r.getSeedPVCName(replica), podName, replica)
+		}
+
+		r.recordWarning(h, EventSeedBackupBlocked, "%s", message)
+
+		return false, errors.New(message)
 	}
 
+	/*
+	 * Any previous backup is removed and we then make sure that the seed
+	 * volume has enough free space to hold a copy of the data of the 
+	 * replica.  If the usage of either file system cannot be determined the
+	 * check is skipped.
+	 */
+
+	err = r.executeCommand(h, podName, []string{"rm", "-rf", dir})
+
+	if err != nil {
+		return false, err
+	}
+
+	usage, err := r.getPodStorageUsage(h, podName)
+
+	var seedUsage *ibmv1.IBMSecurityVerifyDirectoryStorageUsage
+
+	if err == nil {
+		seedUsage, err = r.getPathStorageUsage(h, podName, SeedVolumePath)
+	}
+
+	if err != nil {
+		r.Log.Info("Failed to retrieve the storage usage of the replica",
+				r.createLogParams(h, "Replica", replica,
+						"Error", err.Error())...)
+	} else if seedUsage.Available < usage.Used {
+		r.recordWarning(h, EventStorageInsufficient,
+			"The seed volume of the replica, %s, does not have enough free " +
+			"space (%d bytes) to hold a backup of its data (%d bytes).", 
+			replica, seedUsage.Available, usage.Used)
+
+		return false, errors.New(fmt.Sprintf("The seed volume of the " +
+			"replica, %s, does not have enough free space (%d bytes) to " +
+			"hold a backup of its data (%d bytes).", replica, 
+			seedUsage.Available, usage.Used))
+	}
+
+	r.Log.Info("Starting a backup of the replica",
+				r.createLogParams(h, "Replica", replica)...)
+
+	script := fmt.Sprintf("rm -rf %[1]s && mkdir -p %[1]s && " +
+				"echo running > %[1]s/.state && " +
+				"{ nohup sh -c '(%[2]s %[1]s/data > %[1]s/backup.log 2>&1 && " +
+				"echo complete || echo failed) > %[1]s/.result && " +
+				"mv %[1]s/.result %[1]s/.state' > /dev/null 2>&1 & " +
+				"echo $! > %[1]s/.pid; }", dir, SeedBackupCommand)
+
+	err = r.executeCommand(h, podName, []string{"sh", "-c", script})
+
+	return false, err
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the state of the backup which
+ * is held in the specified directory of a replica.  An empty string is 
+ * returned if the backup has not been started.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getSeedBackupState(
+			h       *RequestHandle,
+			podName string,
+			dir     string) (string, error) {
+
+	state, err := r.executeCommandWithOutput(h, podName, []string{
+			"sh", "-c", fmt.Sprintf("cat %s/.state 2>/dev/null || true", dir)})
+
+	return strings.TrimSpace(state), err
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to remove the backup which is used when
+ * seeding replicas in the Online mode from the specified replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) removeSeedBackup(
+			h       *RequestHandle,
+			pvcName string) error {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "removeSeedBackup",
+						"PVC.Name", pvcName)...)
+
+	podName, err := r.getReplicaSetPodName(h, 
+						r.getReplicaPodName(h.directory, pvcName))
+
+	if err != nil {
+		return err
+	}
+
+	return r.executeCommand(h, podName, []string{
+				"rm", "-rf", fmt.Sprintf("%s/%s", SeedVolumePath, SeedBackupDir)})
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the StoppingPrincipal phase of
+ * the workflow.  The principal needs to be stopped so that its PVC can be
+ * used to seed the new replicas.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) stopPrincipal(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	principal := h.directory.Status.Principal
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "stopPrincipal",
+						"Principal", principal)...)
+
+	err := r.deleteReplica(h, principal)
+
+	if err != nil {
+		return "", err
+	}
+
+	stopped, err := r.isReplicaStopped(h, principal)
+
+	if err != nil || !stopped {
+		return ibmv1.PhaseStoppingPrincipal, err
+	}
+
+	return ibmv1.PhaseSeedingReplicas, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the SeedingReplicas phase of
+ * the workflow.  We kick off the seed job for each of the new replicas, and 
+ * then wait for all of the jobs to complete.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) seedReplicas(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	principal := h.directory.Status.Principal
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "seedReplicas",
+						"Principal", principal)...)
+
 	/*
 	 * We should be able to completely specify the seed container configuration
 	 * via environment variables, but a bug in the 10.0.0.0 release means
@@ -154,137 +512,290 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createReplicas(
 
 	seedConfigMapName := r.getSeedConfigMapName(h.directory)
 
-	err = r.createConfigMap(h, seedConfigMapName, 
+	err := r.createConfigMap(h, seedConfigMapName, 
 			ConfigMapKey, "seed: \n  replica: \n    clean: true\n")
 
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	/*
-	 * Seed each of the new replicas.  We kick off the seed job for each of
-	 * the new replicas, and then wait for all of the jobs to complete.
+	 * Kick off the seed job for each of the new replicas which has not yet
+	 * been seeded.  The job will only be created if it doesn't already 
+	 * exist.
 	 */
 
-	for _, pvcName := range toBeAdded {
+	for _, pvcName := range h.directory.Status.ReplicasToAdd {
+		if utils.Contains(h.directory.Status.SeededReplicas, pvcName) {
+			continue
+		}
+
 		err = r.seedReplica(h, principal, pvcName)
 
 		if err != nil {
 			r.deleteConfigMap(h, seedConfigMapName)
 
-			return nil, err
+			return "", err
 		}
 	}
 
-	for _, pvcName := range toBeAdded {
-		err = r.waitForJob(h, r.getSeedJobName(h.directory, pvcName))
+	/*
+	 * Check whether all of the seed jobs have completed.
+	 */
 
-		if err != nil {
-			r.deleteConfigMap(h, seedConfigMapName)
+	complete, err := r.checkSeedJobs(h, h.directory.Status.ReplicasToAdd)
 
-			return nil, err
-		}
+	if err != nil {
+		r.deleteConfigMap(h, seedConfigMapName)
+
+		return "", err
+	}
+
+	if !complete {
+		return ibmv1.PhaseSeedingReplicas, nil
 	}
 
 	/*
-	 * Delete the temporary ConfigMap which was created.
+	 * Delete the temporary ConfigMap which was created, along with the
+	 * backup of the principal if the replicas were seeded online.
 	 */
 
 	r.deleteConfigMap(h, seedConfigMapName)
 
-	/*
-	 * Now that the PVCs have been seeded with initial data we can now
-	 * create and start each of the new replicas.
-	 */
+	if h.directory.Spec.Replicas.SeedMode == ibmv1.SeedModeOnline {
+		err = r.removeSeedBackup(h, principal)
+
+		if err != nil {
+			return "", err
+		}
+	}
 
-	replicaPods := make(map[string]string)
+	h.directory.Status.SeededReplicas = nil
 
-	for _, pvcName := range toBeAdded {
-		var podName string
+	return ibmv1.PhaseStartingReplicas, nil
+}
 
-		podName, err = r.deployReplica(h, pvcName)
+/*****************************************************************************/
+
+/*
+ * The following function is used to check whether the seed job of each of 
+ * the specified replicas has completed.  When a job completes the replica is
+ * recorded in the status, which is saved, and the job is then deleted.  A 
+ * replica which has been recorded is never seeded again by the current 
+ * phase, and so the job will not be recreated if the operator is restarted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) checkSeedJobs(
+			h        *RequestHandle,
+			replicas []string) (bool, error) {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "checkSeedJobs",
+						"Replicas", replicas)...)
+
+	complete := true
+
+	for _, pvcName := range replicas {
+		if utils.Contains(h.directory.Status.SeededReplicas, pvcName) {
+			continue
+		}
+
+		jobName := r.getSeedJobName(h.directory, pvcName)
+
+		done, err := r.isJobComplete(h, jobName)
 
 		if err != nil {
-			return nil, err
+			r.recordWarning(h, EventSeedJobFailed, 
+				"The seed job for the replica, %s, failed: %s", 
+				pvcName, err.Error())
+
+			return false, err
 		}
 
-		r.Log.V(1).Info("Entering a function", 
-			r.createLogParams(h, "Function", "getReplicaDeploymentName", "pod", podName)...)
-		
-		deploymentName := r.getReplicaDeploymentName(podName)
+		if !done {
+			complete = false
 
-		r.Log.Info("Getting the replica name", 
-						r.createLogParams(h, "Replica.Name", deploymentName)...)
-		
-		replicaPods[pvcName] = deploymentName
-		existing[pvcName]    = deploymentName
-	}
+			continue
+		}
+
+		h.directory.Status.SeededReplicas = append(
+						h.directory.Status.SeededReplicas, pvcName)
+
+		if err := r.Status().Update(h.ctx, h.directory); err != nil {
+			r.Log.Error(err, "Failed to update the seeded replicas for the " +
+					"resource", r.createLogParams(h, "PVC.Name", pvcName)...)
+
+			return false, err
+		}
 
-	for _, replicaName := range replicaPods {
-		podName := r.getReplicaSetPodName(h, replicaName)
-		err = r.waitForPod(h, podName)
+		r.recordEvent(h, EventSeedJobSucceeded, 
+				"The seed job for the replica, %s, has completed.", pvcName)
+
+		err = r.deleteJob(h, jobName)
 
 		if err != nil {
-			return nil, err
+			return false, err
 		}
 	}
 
-	/*
-	 * The pods have each been started and so we now want to create the
-	 * replication agreements between each new pod and all existing pods.
-	 */
+	return complete, nil
+}
 
-	for _, pvcName := range toBeAdded {
-		err = r.createReplicationAgreements(h, principal, pvcName, existing)
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the StartingReplicas phase of
+ * the workflow.  Now that the PVCs have been seeded with initial data we can 
+ * create and start each of the new replicas.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) startReplicas(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "startReplicas")...)
+
+	for _, pvcName := range h.directory.Status.ReplicasToAdd {
+		err := r.deployReplica(h, pvcName)
 
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 	}
 
-	/*
-	 * Now we can create the cluster service for each of the new replicas.
-	 */
+	for _, pvcName := range h.directory.Status.ReplicasToAdd {
+		ready, err := r.isReplicaReady(h, pvcName)
+
+		if err != nil || !ready {
+			return ibmv1.PhaseStartingReplicas, err
+		}
+	}
+
+	return ibmv1.PhaseConfiguringReplicas, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the ConfiguringReplicas phase of
+ * the workflow.  The pods have each been started and so we now want to create 
+ * the replication agreements between each new pod and all existing pods, and
+ * then create the cluster service for each of the new replicas.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) configureReplicas(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
 
-	for pvcName, podName := range replicaPods {
-		err = r.createClusterService(h, podName, h.config.port, pvcName)
+	principal := h.directory.Status.Principal
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "configureReplicas",
+						"Principal", principal)...)
+
+	for _, pvcName := range h.directory.Status.ReplicasToAdd {
+		/*
+		 * Agreements are only created within the replication domain of the
+		 * new replica.  If the principal is in a different domain the 
+		 * agreement from the principal of the domain to the new replica is
+		 * created now, rather than in the CreatingAgreements phase.
+		 */
+
+		domainPrincipal := r.getDomainPrincipal(h, pvcName)
+
+		if domainPrincipal != principal && domainPrincipal != pvcName {
+			err := r.createReplicationAgreement(
+					h, domainPrincipal, domainPrincipal, pvcName)
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		err := r.createReplicationAgreements(h, domainPrincipal, pvcName, 
+					h.directory.Spec.GetReplicationDomain(pvcName))
 
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 	}
 
 	/*
-	 * Start the principal.
+	 * Each of the replicas now has agreements with the new replicas.  The
+	 * agreement time is saved in the status when we move to the next phase.
 	 */
 
-	principalPod, err := r.deployReplica(h, principal)
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		r.setAgreementTime(h, pvcName)
+	}
 
-	if err != nil {
-		return nil, err
+	for _, pvcName := range h.directory.Status.ReplicasToAdd {
+		err := r.createClusterService(h, 
+					r.getReplicaPodName(h.directory, pvcName), 
+					h.config.port, pvcName)
+
+		if err != nil {
+			return "", err
+		}
 	}
 
+	return ibmv1.PhaseStartingPrincipal, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the StartingPrincipal phase of
+ * the workflow.  The principal is restarted and we wait for it to become
+ * ready.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) startPrincipal(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	principal := h.directory.Status.Principal
+
 	r.Log.V(1).Info("Entering a function", 
-		r.createLogParams(h, "Function", "getReplicaDeploymentName", "pod", principalPod)...)
-		
-	principalDeployment := r.getReplicaDeploymentName(principalPod)
+				r.createLogParams(h, "Function", "startPrincipal",
+						"Principal", principal)...)
 
-	r.Log.Info("Getting the replica name", 
-					r.createLogParams(h, "Replica.Name", principalDeployment)...)
-	
-	err = r.createClusterService(h, principalDeployment, h.config.port, principal)
+	err := r.startReplica(h, principal)
 
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	err = r.waitForPod(h, principalPod)
+	ready, err := r.isReplicaReady(h, principal)
+
+	if err != nil || !ready {
+		return ibmv1.PhaseStartingPrincipal, err
+	}
+
+	return ibmv1.PhaseDeployingProxy, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to deploy a replica along with the cluster
+ * service for the replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) startReplica(
+			h       *RequestHandle,
+			pvcName string) error {
+
+	r.Log.V(1).Info("Entering a function", 
+		r.createLogParams(h, "Function", "startReplica", "PVC", pvcName)...)
+
+	err := r.deployReplica(h, pvcName)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return existing, nil
+	return r.createClusterService(h, 
+				r.getReplicaPodName(h.directory, pvcName), 
+				h.config.port, pvcName)
 }
 
 /*****************************************************************************/
@@ -297,11 +808,39 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createReplicas(
 func (r *IBMSecurityVerifyDirectoryReconciler) seedReplica(
 			h            *RequestHandle,
 			principalPvc string,
+			replicaPvc   string) error {
+
+	backup := ""
+
+	if h.directory.Spec.Replicas.SeedMode == ibmv1.SeedModeOnline {
+		backup = SeedBackupDir
+	}
+
+	return r.seedReplicaFrom(h, h.directory, principalPvc, backup, replicaPvc)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to seed a new replica with the data from
+ * a replica of the specified source document, which is either the current
+ * document or the document which is being cloned.  If a backup directory
+ * is specified the replica is seeded from the backup which was taken, 
+ * within the seed volume of the running source replica, rather than from 
+ * the data of the stopped source replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) seedReplicaFrom(
+			h            *RequestHandle,
+			source       *ibmv1.IBMSecurityVerifyDirectory,
+			principalPvc string,
+			backup       string,
 			replicaPvc   string) (err error) {
 
 	r.Log.V(1).Info("Entering a function", 
-			r.createLogParams(h, "Function", "seedReplica",
-				"Principal.PVC", principalPvc, "Replica.PVC", replicaPvc)...)
+			r.createLogParams(h, "Function", "seedReplicaFrom",
+				"Source", source.Name, "Principal.PVC", principalPvc, 
+				"Backup", backup, "Replica.PVC", replicaPvc)...)
 
 	/*
 	 * Create the seed job which is used to seed the new replica with the
@@ -368,6 +907,57 @@ func (r *IBMSecurityVerifyDirectoryReconciler) seedReplica(
 		},
 	}
 
+	/*
+	 * The job is scheduled in the zone of the new replica, so that the PVC
+	 * of the new replica is bound in the zone in which the replica will be
+	 * run.
+	 */
+
+	zone     := h.directory.Spec.GetReplicaZone(replicaPvc)
+	affinity := r.getZoneAffinity(zone)
+
+	/*
+	 * If we are seeding from a backup the principal is still running, and
+	 * so we seed from the backup which was taken, within the seed volume of
+	 * the principal, rather than from the data volume of the principal.  The
+	 * seed volume is mounted by the principal, and can only be shared by
+	 * pods on the same node, and so the job must be scheduled on the same
+	 * node as the principal, which must therefore be in the same zone as 
+	 * the new replica.
+	 */
+
+	if backup != "" {
+		sourceZone := source.Spec.GetReplicaZone(principalPvc)
+
+		if zone != "" && zone != sourceZone {
+			return errors.New(fmt.Sprintf("The replica, %s, in the zone, " +
+				"%s, cannot be seeded from the running replica, %s, which " +
+				"is not in the same zone.", replicaPvc, zone, principalPvc))
+		}
+
+		volumes[2].PersistentVolumeClaim.ClaimName = 
+							r.getSeedPVCName(principalPvc)
+
+		volumeMounts[2].SubPath  = fmt.Sprintf("%s/data", backup)
+		volumeMounts[2].ReadOnly = true
+
+		if affinity == nil {
+			affinity = &corev1.Affinity{}
+		}
+
+		affinity.PodAffinity = &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: 
+							[]corev1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: utils.LabelsForPod(source.Name, 
+						r.getReplicaPodName(source, principalPvc), 
+						principalPvc),
+				},
+				TopologyKey: "kubernetes.io/hostname",
+			}},
+		}
+	}
+
 	/*
 	 * Set up the environment variables.
 	 */
@@ -388,12 +978,14 @@ func (r *IBMSecurityVerifyDirectoryReconciler) seedReplica(
 	)
 
 	/*
-	 * Create the job.
+	 * Create the job.  The job is deleted by the workflow once it has
+	 * completed, rather than being left for the TTL controller, so that a
+	 * completed job is never confused with a job which has yet to be 
+	 * created.
 	 */
 
 	var completions  int32 = 1
 	var backOffLimit int32 = 1
-	var ttl          int32 = 60
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
@@ -402,15 +994,15 @@ func (r *IBMSecurityVerifyDirectoryReconciler) seedReplica(
 			Labels:    utils.LabelsForApp(h.directory.Name, replicaPvc),
 		},
 		Spec: batchv1.JobSpec{
-			Completions:             &completions,
-			TTLSecondsAfterFinished: &ttl,
-			BackoffLimit:            &backOffLimit,
-			Template:                corev1.PodTemplateSpec{
+			Completions:  &completions,
+			BackoffLimit: &backOffLimit,
+			Template:     corev1.PodTemplateSpec{
 				Spec: corev1.PodSpec{
 					Volumes:            volumes,
 					ImagePullSecrets:   h.directory.Spec.Pods.Image.ImagePullSecrets,
 					ServiceAccountName: h.directory.Spec.Pods.ServiceAccountName,
 					SecurityContext:    h.directory.Spec.Pods.SecurityContext,
+					Affinity:           affinity,
 					RestartPolicy:      corev1.RestartPolicyNever,
 					Containers:         []corev1.Container{{
 						Env:             env,
@@ -426,7 +1018,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) seedReplica(
 
 	ctrl.SetControllerReference(h.directory, job, r.Scheme)
 
-	r.Log.Info("Creating a new seed job", 
+	r.Log.V(1).Info("Creating a new seed job", 
 						r.createLogParams(h, "Job.Name", job.Name)...)
 
 	r.Log.V(1).Info("Seed job details", 
@@ -435,12 +1027,26 @@ func (r *IBMSecurityVerifyDirectoryReconciler) seedReplica(
 	err = r.Create(h.ctx, job)
 
 	if err != nil {
- 		r.Log.Error(err, "Failed to create the new job",
+		if k8serrors.IsAlreadyExists(err) {
+			r.Log.V(1).Info("The seed job already exists", 
 						r.createLogParams(h, "Job.Name", job.Name)...)
 
+			err = nil
+		} else {
+ 			r.Log.Error(err, "Failed to create the new job",
+						r.createLogParams(h, "Job.Name", job.Name)...)
+		}
+
 		return
 	}
 
+	r.Log.Info("Created a new seed job", 
+						r.createLogParams(h, "Job.Name", job.Name)...)
+
+	r.recordEvent(h, EventSeedJobStarted, 
+				"The seed job, %s, for the replica, %s, has been started.", 
+				job.Name, replicaPvc)
+
 	return
 }
 
@@ -455,7 +1061,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createReplicationAgreements(
 			h            *RequestHandle,
 			principalPvc string,
 			replicaPvc   string,
-			existing     map[string]string) (err error) {
+			existing     []string) (err error) {
 
 	r.Log.V(1).Info("Entering a function", 
 			r.createLogParams(h, "Function", "createReplicationAgreements",
@@ -465,7 +1071,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createReplicationAgreements(
 	 * Set up the replication agreement for every existing pod to this pod.
 	 */
 
-	for pvcName, _ := range existing {
+	for _, pvcName := range existing {
 		if pvcName != principalPvc && pvcName != replicaPvc {
 			err = r.createReplicationAgreement(
 					h, principalPvc, pvcName, replicaPvc)
@@ -498,34 +1104,41 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createReplicationAgreement(
 	principalRep  := r.getReplicaPodName(h.directory, principalPvc)
 	srcRep        := r.getReplicaPodName(h.directory, sourcePvc)
 	dstRep        := r.getReplicaPodName(h.directory, destPvc)
-	command       := []string{"isvd_manage_replica"}
 	portStr       := strconv.Itoa(int(h.config.port))
 
-	//principalPod := r.getReplicaSetPodName(h, principalRep)
-	srcPod       := r.getReplicaSetPodName(h, srcRep)
-	//dstPod       := r.getReplicaSetPodName(h, dstRep)
+	var args []string
+
+	srcPod, err  := r.getReplicaSetPodName(h, srcRep)
+
+	if err != nil {
+		return err
+	}
 
 	/*
 	 * Let's play it safe and delete any pre-existing replication agreements
-	 * for this replica.
+	 * for this replica.  It is expected that the agreement will not usually
+	 * exist.
 	 */
 
-	r.executeCommand(
-			h, srcPod, []string{"isvd_manage_replica", "-r", "-i", dstRep})
+	err = r.executeManageReplica(h, srcPod, "-r", "-i", dstRep)
+
+	if err != nil && !isCommandError(err, CommandErrorNotFound) {
+		return err
+	}
 
 	/*
 	 * Now we can add in the replication agreement.
 	 */
 
 	if principalRep == srcRep {
-		command = append(command, "-ap",
-            		"-h",  dstRep,
+		args = append(args, "-ap",
+			"-h",  dstRep,
 			"-p",  portStr,
 			"-i",  dstRep,
-            		"-ph", srcRep,
+			"-ph", srcRep,
 			"-pp", portStr)
 	} else {
-		command = append(command, "-ar",
+		args = append(args, "-ar",
 			"-h", dstRep,
 			"-p", portStr,
 			"-i", dstRep,
@@ -533,10 +1146,20 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createReplicationAgreement(
 	}
 
 	if h.config.secure {
-		command = append(command, "-z")
+		args = append(args, "-z")
 	}
 
-	return r.executeCommand(h, srcPod, command)
+	err = r.executeManageReplica(h, srcPod, args...)
+
+	if err != nil {
+		return err
+	}
+
+	r.recordEvent(h, EventAgreementCreated, 
+			"The replication agreement from %s to %s has been created.",
+			sourcePvc, destPvc)
+
+	return nil
 }
 
 /*****************************************************************************/
@@ -547,11 +1170,56 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createReplicationAgreement(
 
 func (r *IBMSecurityVerifyDirectoryReconciler) deployReplica(
 			h       *RequestHandle,
-			pvcName string) (string, error) {
+			pvcName string) error {
 
 	r.Log.V(1).Info("Entering a function", 
 		r.createLogParams(h, "Function", "deployReplica", "PVC", pvcName)...)
 
+	rep := r.constructReplicaSet(h, pvcName)
+
+	/*
+	 * Create the pod.  The replica set will only be created if it doesn't
+	 * already exist.
+	 */
+
+	r.Log.V(1).Info("Creating a new pod", 
+						r.createLogParams(h, "Replica.Name", rep.Name)...)
+
+	r.Log.V(1).Info("Replica details", 
+				r.createLogParams(h, "Details", rep)...)
+
+	err := r.Create(h.ctx, rep)
+
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			return nil
+		}
+
+ 		r.Log.Error(err, "Failed to create the new pod",
+						r.createLogParams(h, "Replica.Name", rep.Name)...)
+
+		return err
+	}
+
+	r.Log.Info("Created a new pod", 
+						r.createLogParams(h, "Replica.Name", rep.Name)...)
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to construct the definition of the replica
+ * set for a replica.  A hash of the replica set specification is added as an
+ * annotation to both the replica set and the pod template so that we can 
+ * later determine whether the replica set, or its pod, is out of date.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) constructReplicaSet(
+			h       *RequestHandle,
+			pvcName string) *appsv1.ReplicaSet {
+
 	podName := r.getReplicaPodName(h.directory, pvcName)
 
 	imageName := fmt.Sprintf("%s/verify-directory-server:%s", 
@@ -609,6 +1277,29 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deployReplica(
 		},
 	}
 
+	/*
+	 * In the Online seed mode the seed volume of the replica is also
+	 * mounted, so that a backup can be taken from the running replica
+	 * without consuming the storage of its data volume.
+	 */
+
+	if h.directory.Spec.Replicas.SeedMode == ibmv1.SeedModeOnline {
+		volumes = append(volumes, corev1.Volume{
+			Name: "isvd-seed",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: r.getSeedPVCName(pvcName),
+					ReadOnly:  false,
+				},
+			},
+		})
+
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "isvd-seed",
+			MountPath: SeedVolumePath,
+		})
+	}
+
 	/*
 	 * Set up the environment variables.
 	 */
@@ -692,6 +1383,8 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deployReplica(
 					ImagePullSecrets:   h.directory.Spec.Pods.Image.ImagePullSecrets,
 					ServiceAccountName: h.directory.Spec.Pods.ServiceAccountName,
 					SecurityContext:    h.directory.Spec.Pods.SecurityContext,
+					Affinity:           r.getZoneAffinity(
+								h.directory.Spec.GetReplicaZone(pvcName)),
 					Hostname:           podName,
 					Containers:         []corev1.Container{{
 						Env:             env,
@@ -710,33 +1403,19 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deployReplica(
 		},
 	}
 
-	ctrl.SetControllerReference(h.directory, rep, r.Scheme)
-
-	/*
-	 * Create the pod.
-	 */
-
-	r.Log.Info("Creating a new pod", 
-						r.createLogParams(h, "Replica.Name", rep.Name)...)
-
-	r.Log.V(1).Info("Replica details", 
-				r.createLogParams(h, "Details", rep)...)
-
-	err := r.Create(h.ctx, rep)
+	hash := utils.GetSpecHash(rep.Spec)
 
-	if err != nil {
- 		r.Log.Error(err, "Failed to create the new pod",
-						r.createLogParams(h, "Replica.Name", rep.Name)...)
+	rep.ObjectMeta.Annotations = map[string]string{
+		utils.SpecHashKey: hash,
+	}
 
-		//return "", err
+	rep.Spec.Template.ObjectMeta.Annotations = map[string]string{
+		utils.SpecHashKey: hash,
 	}
 
-        // Get the pod name
-	var name string
-        
-    	name = r.getReplicaSetPodName(h, podName)
+	ctrl.SetControllerReference(h.directory, rep, r.Scheme)
 
-	return name, nil
+	return rep
 }
 
 /*****************************************************************************/
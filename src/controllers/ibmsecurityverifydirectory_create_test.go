@@ -0,0 +1,443 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the creation of the replication
+ * agreements and the seeding of the new replicas.
+ */
+
+/*****************************************************************************/
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"context"
+	"errors"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+
+	utilexec "k8s.io/client-go/util/exec"
+
+	"k8s.io/client-go/tools/record"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("createReplicationAgreement", func() {
+	var executor   *FakePodExecutor
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	BeforeEach(func() {
+		executor = &FakePodExecutor{}
+
+		reconciler, _ = newTestReconciler(executor, &FakePodResolver{
+			Pods: map[string]string{
+				"isvd-replica-1": "isvd-replica-1-pod",
+				"isvd-replica-2": "isvd-replica-2-pod",
+				"isvd-replica-3": "isvd-replica-3-pod",
+			},
+		})
+
+		h = newTestHandle("isvd", "default", 
+				[]string{"replica-1", "replica-2", "replica-3"})
+	})
+
+	It("creates a principal agreement on the principal", func() {
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-1", "replica-2")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executor.Commands()).To(Equal([]string{
+			"isvd-replica-1-pod: isvd_manage_replica -r -i isvd-replica-2",
+			"isvd-replica-1-pod: isvd_manage_replica -ap -h isvd-replica-2 " +
+				"-p 9389 -i isvd-replica-2 -ph isvd-replica-1 -pp 9389",
+		}))
+	})
+
+	It("creates a peer agreement on the other replicas", func() {
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-2", "replica-3")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executor.Commands()).To(Equal([]string{
+			"isvd-replica-2-pod: isvd_manage_replica -r -i isvd-replica-3",
+			"isvd-replica-2-pod: isvd_manage_replica -ar -h isvd-replica-3 " +
+				"-p 9389 -i isvd-replica-3 -s isvd-replica-1",
+		}))
+	})
+
+	It("uses a secure connection when the LDAP port is disabled", func() {
+		h.config.port   = 9636
+		h.config.secure = true
+
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-1", "replica-2")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executor.Commands()).To(HaveLen(2))
+		Expect(executor.Commands()[1]).To(HaveSuffix("-pp 9636 -z"))
+	})
+
+	It("fails when the pod for the source replica doesn't exist", func() {
+		h.directory.Name = "missing"
+
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-1", "replica-2")
+
+		Expect(err).To(HaveOccurred())
+		Expect(executor.Commands()).To(BeEmpty())
+	})
+
+	It("ignores a pre-existing agreement which doesn't exist", func() {
+		executor.Handler = func(pod string, command []string) (
+								string, string, error) {
+			if command[1] == "-r" {
+				return "", "ldap_delete: No such object (32)", 
+						utilexec.CodeExitError{
+							Err: errors.New("exit 1"), Code: 1}
+			}
+
+			return "", "", nil
+		}
+
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-2", "replica-3")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executor.Commands()).To(HaveLen(2))
+	})
+
+	It("fails when the pre-existing agreement cannot be removed", func() {
+		executor.Handler = func(pod string, command []string) (
+								string, string, error) {
+			if command[1] == "-r" {
+				return "", "ldap_delete: Insufficient access (50)", 
+						utilexec.CodeExitError{
+							Err: errors.New("exit 1"), Code: 1}
+			}
+
+			return "", "", nil
+		}
+
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-2", "replica-3")
+
+		Expect(err).To(HaveOccurred())
+		Expect(isCommandError(err, CommandErrorPermanent)).To(BeTrue())
+		Expect(executor.Commands()).To(HaveLen(1))
+	})
+
+	It("retries a command which fails with a transient error", func() {
+		attempts := 0
+
+		executor.Handler = func(pod string, command []string) (
+								string, string, error) {
+			if command[1] == "-ar" {
+				attempts++
+
+				if attempts == 1 {
+					return "", "ldap_bind: Can't contact LDAP server (81)", 
+						utilexec.CodeExitError{
+							Err: errors.New("exit 1"), Code: 1}
+				}
+			}
+
+			return "", "", nil
+		}
+
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-2", "replica-3")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attempts).To(Equal(2))
+
+		condition := meta.FindStatusCondition(
+			h.directory.Status.Conditions, ReplicationConfiguredCondition)
+
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("reports a permanent failure in the status", func() {
+		executor.Handler = func(pod string, command []string) (
+								string, string, error) {
+			if command[1] == "-ar" {
+				return "", "ldap_bind: Invalid credentials (49)", 
+						utilexec.CodeExitError{
+							Err: errors.New("exit 1"), Code: 1}
+			}
+
+			return "", "", nil
+		}
+
+		err := reconciler.createReplicationAgreement(
+						h, "replica-1", "replica-2", "replica-3")
+
+		Expect(err).To(HaveOccurred())
+		Expect(isCommandError(err, CommandErrorPermanent)).To(BeTrue())
+
+		/*
+		 * A permanent failure should not be retried.
+		 */
+
+		Expect(executor.Commands()).To(HaveLen(2))
+
+		condition := meta.FindStatusCondition(
+			h.directory.Status.Conditions, ReplicationConfiguredCondition)
+
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("InvalidCredentials"))
+		Expect(condition.Message).To(ContainSubstring("exit code 1"))
+	})
+
+	It("creates an agreement from every existing replica", func() {
+		err := reconciler.createReplicationAgreements(
+				h, "replica-1", "replica-3", h.directory.Spec.Replicas.PVCs)
+
+		Expect(err).NotTo(HaveOccurred())
+
+		var added []string
+
+		for _, command := range executor.Commands() {
+			if strings.Contains(command, " -ar ") {
+				added = append(added, command)
+			}
+		}
+
+		Expect(added).To(Equal([]string{
+			"isvd-replica-2-pod: isvd_manage_replica -ar -h isvd-replica-3 " +
+				"-p 9389 -i isvd-replica-3 -s isvd-replica-1",
+		}))
+	})
+})
+
+/*****************************************************************************/
+
+
+var _ = Describe("seedReplicas", func() {
+	const namespace = "default"
+	const jobName   = "isvd-replica-2-seed"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	getJob := func() (*batchv1.Job, error) {
+		job := &batchv1.Job{}
+
+		err := k8sClient.Get(context.Background(), types.NamespacedName{
+						Name: jobName, Namespace: namespace}, job)
+
+		return job, err
+	}
+
+	setJobStatus := func(status batchv1.JobStatus) {
+		job, err := getJob()
+
+		Expect(err).NotTo(HaveOccurred())
+
+		job.Status = status
+
+		Expect(k8sClient.Status().Update(
+						context.Background(), job)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace,
+				[]string{"replica-1", "replica-2"})
+
+		createTestDocument(h.directory)
+
+		h.directory.Status.Principal     = "replica-1"
+		h.directory.Status.ReplicasToAdd = []string{"replica-2"}
+
+		now := metav1.Now()
+
+		h.directory.Status.PhaseStartTime = &now
+	})
+
+	AfterEach(func() {
+		k8sClient.Delete(context.Background(), &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: namespace},
+		})
+	})
+
+	It("waits for a failed pod to be retried by the job", func() {
+		phase, err := reconciler.seedReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseSeedingReplicas))
+
+		job, err := getJob()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Spec.TTLSecondsAfterFinished).To(BeNil())
+
+		setJobStatus(batchv1.JobStatus{Failed: 1})
+
+		phase, err = reconciler.seedReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseSeedingReplicas))
+
+		setJobStatus(batchv1.JobStatus{
+			Failed:     2,
+			Conditions: []batchv1.JobCondition{{
+				Type:   batchv1.JobFailed,
+				Status: corev1.ConditionTrue,
+			}},
+		})
+
+		_, err = reconciler.seedReplicas(h)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("never recreates the job of a replica which has been seeded", func() {
+		_, err := reconciler.seedReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+
+		setJobStatus(batchv1.JobStatus{
+			Succeeded:  1,
+			Conditions: []batchv1.JobCondition{{
+				Type:   batchv1.JobComplete,
+				Status: corev1.ConditionTrue,
+			}},
+		})
+
+		/*
+		 * Once the job has completed the replica is recorded in the status
+		 * and the job is deleted.
+		 */
+
+		complete, err := reconciler.checkSeedJobs(
+						h, h.directory.Status.ReplicasToAdd)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(complete).To(BeTrue())
+		Expect(h.directory.Status.SeededReplicas).To(
+						Equal([]string{"replica-2"}))
+
+		Eventually(func() bool {
+			_, err := getJob()
+
+			return k8serrors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		/*
+		 * Processing the phase again doesn't recreate the job.
+		 */
+
+		phase, err := reconciler.seedReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseStartingReplicas))
+		Expect(h.directory.Status.SeededReplicas).To(BeNil())
+
+		_, err = getJob()
+
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+/*****************************************************************************/
+
+var _ = Describe("takeSeedBackup", func() {
+	const namespace = "default"
+	const podName   = "isvd-replica-1-pod"
+
+	var executor   *FakePodExecutor
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var recorder   *record.FakeRecorder
+	var h          *RequestHandle
+	var missing    string
+
+	BeforeEach(func() {
+		missing = ""
+
+		executor = &FakePodExecutor{
+			Handler: func(pod string, command []string) (string, string, error) {
+				switch {
+					case command[0] == "df":
+						return testDfOutput, "", nil
+
+					case strings.HasPrefix(command[len(command)-1], "[ -d "):
+						return missing, "", nil
+				}
+
+				return "", "", nil
+			},
+		}
+
+		reconciler, recorder = newTestReconciler(
+						executor, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace,
+				[]string{"replica-1", "replica-2"})
+	})
+
+	It("starts the backup within the seed volume", func() {
+		complete, err := reconciler.takeSeedBackup(
+						h, "replica-1", podName, SeedBackupDir)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(complete).To(BeFalse())
+
+		commands := executor.Commands()
+
+		Expect(commands).To(HaveLen(6))
+		Expect(commands[2]).To(Equal(podName + ": rm -rf " +
+				"/var/isvd/seed/seed-backup"))
+		Expect(commands[3]).To(Equal(podName + ": df -P -k /var/isvd/data"))
+		Expect(commands[4]).To(Equal(podName + ": df -P -k /var/isvd/seed"))
+		Expect(commands[5]).To(HavePrefix(podName + ": sh -c " +
+				"rm -rf /var/isvd/seed/seed-backup && "))
+		Expect(commands[5]).To(ContainSubstring(SeedBackupCommand +
+				" /var/isvd/seed/seed-backup/data"))
+	})
+
+	DescribeTable("refuses to start the backup",
+		func(output string, message string) {
+			missing = output
+
+			_, err := reconciler.takeSeedBackup(
+							h, "replica-1", podName, SeedBackupDir)
+
+			Expect(err).To(MatchError(ContainSubstring(message)))
+			Expect(executor.Commands()).To(HaveLen(2))
+			Expect(getRecordedEvents(recorder)).To(ConsistOf(
+				HavePrefix("Warning " + EventSeedBackupBlocked)))
+		},
+
+		Entry("when the seed volume is not mounted", "volume\n",
+				"replica-1-seed, is not mounted"),
+		Entry("when the backup command is not available", "command\n",
+				"command, which is used to take a backup"),
+	)
+})
+
+/*****************************************************************************/
+
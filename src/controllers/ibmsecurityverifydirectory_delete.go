@@ -18,61 +18,82 @@ import (
 	corev1  "k8s.io/api/core/v1"
 	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/ibm-security/verify-directory-operator/utils"
 
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
 )
 
 /*****************************************************************************/
 
 /*
- * Delete the replicas for this deployment which are no longer required.
+ * The following function is used to process the DeletingReplicas phase of
+ * the workflow.  It will delete the replicas for this deployment which are 
+ * no longer required, and then wait for the replicas to stop.
  */
 
 func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplicas(
-			h           *RequestHandle,
-			existing    map[string]string,
-			toBeDeleted []string) (err error) {
-
-	err = nil
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
 
 	r.Log.V(1).Info("Entering a function", 
 				r.createLogParams(h, "Function", "deleteReplicas")...)
 
-	/*
-	 * Create a map of the to-be-deleted PVCs.
-	 */
-
-	var toBeDeletedPvcs = make(map[string]bool)
-
-	for _, pvcName := range toBeDeleted {
-		toBeDeletedPvcs[pvcName] = true
-	}
+	toBeDeleted := h.directory.Status.ReplicasToDelete
 
 	/*
 	 * Process each of the replicas which are to be deleted.
 	 */
 
 	for idx, pvcName := range toBeDeleted {
+		/*
+		 * If the replica set has already been deleted we have already
+		 * processed this replica and just need to wait for it to stop.
+		 */
+
+		id := r.getReplicaPodName(h.directory, pvcName)
+
+		err := r.Get(h.ctx, types.NamespacedName{
+						Name:      id,
+						Namespace: h.directory.Namespace}, &appsv1.ReplicaSet{})
+
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+
+			return "", err
+		}
+
 		r.Log.Info("Deleting the replica", 
 			r.createLogParams(h, 
 				strconv.FormatInt(int64(idx), 10), pvcName)...)
 
 		/*
-		 * Remove the replication agreement from each of the existing
-		 * replicas.
+		 * Remove the replication agreement, and the supplier subentry of
+		 * the replica, from each of the remaining replicas.
 		 */
 
-		id := r.getReplicaPodName(h.directory, pvcName)
-		name := r.getReplicaSetPodName(h, id)
-		
-		for pvc, _ := range existing {
-			if _, ok := toBeDeletedPvcs[pvc]; !ok {
-				r.deleteReplicationAgreement(h, name, id)
+		for _, pvc := range h.directory.Spec.Replicas.PVCs {
+			name, err := r.getReplicaSetPodName(
+							h, r.getReplicaPodName(h.directory, pvc))
+
+			if err != nil {
+				continue
+			}
+
+			err = r.deleteReplicationAgreement(h, name, id)
+
+			if err == nil {
+				err = r.deleteSupplierSubentry(h, name, id)
+			}
+
+			if err != nil {
+				return "", err
 			}
 		}
 
@@ -83,17 +104,54 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplicas(
 		err = r.deleteReplica(h, pvcName)
 
 		if err != nil {
-			return
+			return "", err
+		}
+
+		r.recordEvent(h, EventReplicaDeleted, 
+				"The replica, %s, has been deleted.", pvcName)
+	}
+
+	/*
+	 * Wait for each of the deleted replicas to stop.
+	 */
+
+	for _, pvcName := range toBeDeleted {
+		stopped, err := r.isReplicaStopped(h, pvcName)
+
+		if err != nil || !stopped {
+			return ibmv1.PhaseDeletingReplicas, err
 		}
 	}
 
-	return
+	/*
+	 * Delete the PVCs of the deleted replicas, if the PVCs were created by
+	 * the operator and are not to be retained, along with the seed volumes
+	 * of the deleted replicas.
+	 */
+
+	for _, pvcName := range toBeDeleted {
+		err := r.deleteReplicaPVC(h, pvcName)
+
+		if err != nil {
+			return "", err
+		}
+
+		err = r.deleteSeedPVC(h, pvcName)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return ibmv1.PhaseReady, nil
 }
 
 /*****************************************************************************/
 
 /*
- * The following function is used to delete a replica.
+ * The following function is used to delete a replica.  The caller should
+ * use the isReplicaStopped function to determine when the replica has 
+ * actually stopped.
  */
 
 func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplica(
@@ -105,17 +163,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplica(
 						"PVC.Name", pvcName)...)
 
 	podName := r.getReplicaPodName(h.directory, pvcName)
-	name := r.getReplicaSetPodName(h, podName)
-
-	/*
-	 * Set the labels for the pod.
-	 */
 
-	/*labels := map[string]string{
-		"app.kubernetes.io/kind":    "IBMSecurityVerifyDirectory",
-		"app.kubernetes.io/cr-name": podName,
-	}*/
-		
 	/*
 	 * Delete the service.
 	 */
@@ -156,44 +204,107 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplica(
 		return
 	}
 
-	/*
-	 * Wait for the pod to stop.
-	 */
+	return nil
+}
 
-	r.Log.Info("Waiting for the pod to stop", 
-					r.createLogParams(h, "Pod.Name", name)...)
+/*****************************************************************************/
 
-	err = wait.PollImmediate(time.Second, time.Duration(300) * time.Second, 
-					r.isPodOpComplete(h, name, false))
+/*
+ * The following function is used to delete an existing replication agreement.
+ * An agreement which doesn't exist is treated as having been deleted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplicationAgreement(
+			h            *RequestHandle,
+			podName      string,
+			replicaId    string) error {
+
+	r.Log.Info(
+		"Deleting an existing replication agreement", 
+		r.createLogParams(h, "Pod.Name", podName, "Replica.Id", replicaId)...)
+
+	err := r.executeManageReplica(h, podName, "-r", "-i", replicaId)
 
 	if err != nil {
-		r.Log.Error(err, 
-			"The pod failed to stop within the allocated time.",
-			r.createLogParams(h, "Pod.Name", name)...)
+		if isCommandError(err, CommandErrorNotFound) {
+			return nil
+		}
 
-		return
+		return err
 	}
 
-	return
+	r.recordEvent(h, EventAgreementRemoved, 
+		"The replication agreement from %s to %s has been removed.",
+		podName, replicaId)
+
+	return nil
 }
 
 /*****************************************************************************/
 
 /*
- * The following function is used to delete an existing replication agreement.
+ * The following function is used to delete the supplier subentry of the
+ * specified replica, along with any agreements beneath it, from the
+ * replication topology which is held by the specified pod.  A subentry which
+ * doesn't exist is treated as having been deleted.
  */
 
-func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplicationAgreement(
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteSupplierSubentry(
 			h            *RequestHandle,
 			podName      string,
-			replicaId    string) {
+			replicaId    string) error {
 
 	r.Log.Info(
-		"Deleting an existing replication agreement", 
+		"Deleting the supplier subentry of a replica",
 		r.createLogParams(h, "Pod.Name", podName, "Replica.Id", replicaId)...)
 
-	r.executeCommand(h, podName, 
-		[]string{"isvd_manage_replica", "-r", "-i", replicaId})
+	adminDn, adminPwd, err := r.resolveAdminCredentials(h)
+
+	if err != nil {
+		return err
+	}
+
+	for _, suffix := range h.config.suffixes {
+		dn := fmt.Sprintf("ibm-replicaServerId=%s,%s,%s",
+						replicaId, ReplicaGroupRdn, suffix)
+
+		command := []string{
+			LdapDeleteCommand,
+			"-h", "localhost",
+			"-p", strconv.Itoa(int(h.config.port)),
+			"-D", adminDn,
+			"-w", adminPwd,
+		}
+
+		if h.config.secure {
+			command = append(command, "-Z")
+		}
+
+		command = append(command, "-s", dn)
+
+		result, err := r.executeCommandWithResult(h, podName, command)
+
+		if err != nil {
+			class, reason := classifyManageReplicaFailure(result)
+
+			if class == CommandErrorNotFound {
+				continue
+			}
+
+			return &CommandError{
+				Result: result,
+				Class:  class,
+				Reason: reason,
+				Err:    err,
+			}
+		}
+
+		r.recordEvent(h, EventSubentryRemoved,
+			"The supplier subentry of %s has been removed from %s for " +
+			"the suffix, %s.", replicaId, podName, suffix)
+	}
+
+	return nil
 }
 
 /*****************************************************************************/
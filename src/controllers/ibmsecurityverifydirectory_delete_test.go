@@ -0,0 +1,326 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the deletion of replicas.
+ */
+
+/*****************************************************************************/
+
+import (
+	appsv1  "k8s.io/api/apps/v1"
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"context"
+	"errors"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	utilexec "k8s.io/client-go/util/exec"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("deleteReplicas", func() {
+	const namespace = "default"
+	const replica   = "isvd-replica-3"
+
+	var executor   *FakePodExecutor
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		executor = &FakePodExecutor{}
+
+		reconciler, _ = newTestReconciler(executor, &FakePodResolver{
+			Pods: map[string]string{
+				"isvd-replica-1": "isvd-replica-1-pod",
+				"isvd-replica-2": "isvd-replica-2-pod",
+			},
+		})
+
+		h = newTestHandle("isvd", namespace, 
+				[]string{"replica-1", "replica-2"})
+
+		h.directory.Status.ReplicasToDelete = []string{"replica-3"}
+
+		/*
+		 * Create the replica set and service of the replica which is to be
+		 * deleted.
+		 */
+
+		labels := map[string]string{"app": replica}
+
+		Expect(k8sClient.Create(context.Background(), &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      replica,
+				Namespace: namespace,
+			},
+			Spec: appsv1.ReplicaSetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:  replica,
+							Image: "icr.io/isvd/verify-directory-server",
+						}},
+					},
+				},
+			},
+		})).To(Succeed())
+
+		Expect(k8sClient.Create(context.Background(), &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      replica,
+				Namespace: namespace,
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports:    []corev1.ServicePort{{Port: 9389}},
+			},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		k8sClient.Delete(context.Background(), &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: replica, Namespace: namespace},
+		})
+		k8sClient.Delete(context.Background(), &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: replica, Namespace: namespace},
+		})
+	})
+
+	It("removes the agreements and deletes the replica", func() {
+		h.config.adminPwd = "passw0rd"
+
+		phase, err := reconciler.deleteReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseReady))
+
+		subentry := "idsldapdelete -h localhost -p 9389 -D cn=root " +
+			"-w passw0rd -s ibm-replicaServerId=isvd-replica-3," +
+			"ibm-replicaGroup=default,o=sample"
+
+		Expect(executor.Commands()).To(Equal([]string{
+			"isvd-replica-1-pod: isvd_manage_replica -r -i isvd-replica-3",
+			"isvd-replica-1-pod: " + subentry,
+			"isvd-replica-2-pod: isvd_manage_replica -r -i isvd-replica-3",
+			"isvd-replica-2-pod: " + subentry,
+		}))
+
+		key := types.NamespacedName{Name: replica, Namespace: namespace}
+
+		Eventually(func() bool {
+			err := k8sClient.Get(
+						context.Background(), key, &appsv1.ReplicaSet{})
+
+			return k8serrors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		Eventually(func() bool {
+			err := k8sClient.Get(
+						context.Background(), key, &corev1.Service{})
+
+			return k8serrors.IsNotFound(err)
+		}).Should(BeTrue())
+	})
+
+	It("does not process a replica which has already been deleted", func() {
+		_, err := reconciler.deleteReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() bool {
+			err := k8sClient.Get(context.Background(), 
+					types.NamespacedName{Name: replica, Namespace: namespace},
+					&appsv1.ReplicaSet{})
+
+			return k8serrors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		executor = &FakePodExecutor{}
+		reconciler.Executor = executor
+
+		phase, err := reconciler.deleteReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseReady))
+		Expect(executor.Commands()).To(BeEmpty())
+	})
+
+	It("treats an agreement which doesn't exist as removed", func() {
+		executor.Handler = func(pod string, command []string) (
+								string, string, error) {
+			return "", "ldap_delete: No such object (32)", 
+						utilexec.CodeExitError{
+							Err: errors.New("exit 1"), Code: 1}
+		}
+
+		phase, err := reconciler.deleteReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseReady))
+	})
+
+	It("doesn't delete the replica if an agreement cannot be removed", func() {
+		executor.Handler = func(pod string, command []string) (
+								string, string, error) {
+			return "", "ldap_delete: Insufficient access (50)", 
+						utilexec.CodeExitError{
+							Err: errors.New("exit 1"), Code: 1}
+		}
+
+		_, err := reconciler.deleteReplicas(h)
+
+		Expect(err).To(HaveOccurred())
+		Expect(isCommandError(err, CommandErrorPermanent)).To(BeTrue())
+
+		Expect(k8sClient.Get(context.Background(), 
+				types.NamespacedName{Name: replica, Namespace: namespace},
+				&appsv1.ReplicaSet{})).To(Succeed())
+	})
+
+	It("records an event for each step", func() {
+		var recorder = reconciler.Recorder
+
+		_, err := reconciler.deleteReplicas(h)
+
+		Expect(err).NotTo(HaveOccurred())
+
+		events := getRecordedEvents(recorder.(*record.FakeRecorder))
+
+		Expect(events).To(ContainElement(ContainSubstring(
+											EventAgreementRemoved)))
+		Expect(events).To(ContainElement(ContainSubstring(
+											EventReplicaDeleted)))
+	})
+})
+
+/*****************************************************************************/
+
+var _ = Describe("deleteSupplierSubentry", func() {
+	const namespace = "default"
+	const pod       = "isvd-replica-1-pod"
+
+	var executor   *FakePodExecutor
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+	var subentries map[string]bool
+
+	BeforeEach(func() {
+		/*
+		 * The executor maintains the supplier subentries which are held
+		 * by the pod, and removes the subentry which is named by a subtree
+		 * delete.
+		 */
+
+		subentries = map[string]bool{
+			"ibm-replicaServerId=isvd-replica-1,ibm-replicaGroup=default," +
+				"o=sample": true,
+			"ibm-replicaServerId=isvd-replica-2,ibm-replicaGroup=default," +
+				"o=sample": true,
+			"ibm-replicaServerId=isvd-replica-3,ibm-replicaGroup=default," +
+				"o=sample": true,
+		}
+
+		executor = &FakePodExecutor{
+			Handler: func(pod string, command []string) (
+								string, string, error) {
+				dn := command[len(command) - 1]
+
+				if command[0] != LdapDeleteCommand ||
+							command[len(command) - 2] != "-s" {
+					return "", "", nil
+				}
+
+				if !subentries[dn] {
+					return "", "ldap_delete: No such object (32)",
+								utilexec.CodeExitError{
+									Err: errors.New("exit 32"), Code: 32}
+				}
+
+				delete(subentries, dn)
+
+				return "", "", nil
+			},
+		}
+
+		reconciler, _ = newTestReconciler(executor, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace,
+				[]string{"replica-1", "replica-2"})
+
+		h.config.adminPwd = "passw0rd"
+	})
+
+	It("removes the subentry of the deleted server", func() {
+		Expect(reconciler.deleteSupplierSubentry(
+						h, pod, "isvd-replica-3")).To(Succeed())
+
+		Expect(subentries).To(Equal(map[string]bool{
+			"ibm-replicaServerId=isvd-replica-1,ibm-replicaGroup=default," +
+				"o=sample": true,
+			"ibm-replicaServerId=isvd-replica-2,ibm-replicaGroup=default," +
+				"o=sample": true,
+		}))
+	})
+
+	It("removes the subentry for each of the suffixes", func() {
+		h.config.suffixes = []string{"o=sample", "o=other"}
+
+		subentries["ibm-replicaServerId=isvd-replica-3," +
+				"ibm-replicaGroup=default,o=other"] = true
+
+		Expect(reconciler.deleteSupplierSubentry(
+						h, pod, "isvd-replica-3")).To(Succeed())
+
+		Expect(subentries).NotTo(HaveKey(ContainSubstring("isvd-replica-3")))
+		Expect(executor.Commands()).To(HaveLen(2))
+	})
+
+	It("treats a subentry which doesn't exist as removed", func() {
+		Expect(reconciler.deleteSupplierSubentry(
+						h, pod, "isvd-replica-3")).To(Succeed())
+		Expect(reconciler.deleteSupplierSubentry(
+						h, pod, "isvd-replica-3")).To(Succeed())
+
+		Expect(subentries).To(HaveLen(2))
+	})
+
+	It("does not report the password if the subentry cannot be removed",
+				func() {
+		executor.Handler = func(pod string, command []string) (
+								string, string, error) {
+			return "", "ldap_delete: Insufficient access (50)",
+						utilexec.CodeExitError{
+							Err: errors.New("exit 50"), Code: 50}
+		}
+
+		err := reconciler.deleteSupplierSubentry(h, pod, "isvd-replica-3")
+
+		Expect(err).To(HaveOccurred())
+		Expect(isCommandError(err, CommandErrorPermanent)).To(BeTrue())
+		Expect(err.Error()).NotTo(ContainSubstring("passw0rd"))
+		Expect(err.Error()).To(ContainSubstring("-w " + RedactedValue))
+	})
+})
+
+/*****************************************************************************/
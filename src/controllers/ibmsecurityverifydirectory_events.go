@@ -0,0 +1,101 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * record Kubernetes events against the document, so that the progress of
+ * the deployment can be followed using 'kubectl describe'.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1  "k8s.io/api/core/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The reasons which are used for the events.
+ */
+
+const (
+	EventPhaseStarted        = "PhaseStarted"
+	EventPhaseFailed         = "PhaseFailed"
+	EventReconciled          = "Reconciled"
+	EventPrincipalCreated    = "PrincipalCreated"
+	EventSeedJobStarted      = "SeedJobStarted"
+	EventSeedJobSucceeded    = "SeedJobSucceeded"
+	EventSeedJobFailed       = "SeedJobFailed"
+	EventAgreementCreated    = "AgreementCreated"
+	EventAgreementRemoved    = "AgreementRemoved"
+	EventSubentryRemoved     = "SubentryRemoved"
+	EventProxyConfigChanged  = "ProxyConfigChanged"
+	EventProxyRestarted      = "ProxyRestarted"
+	EventReplicaDeleted      = "ReplicaDeleted"
+	EventTopologyDrift       = "TopologyDrift"
+	EventBackupSucceeded     = "BackupSucceeded"
+	EventBackupFailed        = "BackupFailed"
+	EventRestoreStarted      = "RestoreStarted"
+	EventRestoreSucceeded    = "RestoreSucceeded"
+	EventRestoreFailed       = "RestoreFailed"
+	EventCloned              = "Cloned"
+	EventPVCCreated          = "PVCCreated"
+	EventPVCDeleted          = "PVCDeleted"
+	EventVolumeExpanding     = "VolumeExpanding"
+	EventVolumeExpanded      = "VolumeExpanded"
+	EventStorageLow          = "StorageLow"
+	EventStorageInsufficient = "StorageInsufficient"
+	EventSupplierUnavailable = "SupplierUnavailable"
+	EventSeedBackupBlocked   = "SeedBackupBlocked"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to record a Normal event against the 
+ * document.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) recordEvent(
+			h       *RequestHandle,
+			reason  string,
+			message string,
+			args    ...interface{}) {
+
+	if r.Recorder == nil {
+		return
+	}
+
+	r.Recorder.Eventf(h.directory, corev1.EventTypeNormal, reason, 
+						message, args...)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to record a Warning event against the 
+ * document.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) recordWarning(
+			h       *RequestHandle,
+			reason  string,
+			message string,
+			args    ...interface{}) {
+
+	if r.Recorder == nil {
+		return
+	}
+
+	r.Recorder.Eventf(h.directory, corev1.EventTypeWarning, reason, 
+						message, args...)
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,515 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * expand the PVCs of the replicas, and the PVC of the proxy, when the storage
+ * size of the document is increased.  Each PVC which is smaller than the
+ * storage size is patched with the new size.  If the file system of a volume
+ * can only be resized when the volume is mounted, which is indicated by the
+ * FileSystemResizePending condition of the PVC, the pod which uses the PVC
+ * is restarted.  The replicas are restarted one at a time so that the proxy
+ * always has a working replica to route requests to.
+ */
+
+/*****************************************************************************/
+
+import (
+	appsv1    "k8s.io/api/apps/v1"
+	corev1    "k8s.io/api/core/v1"
+	metav1    "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"errors"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to work out which of the existing PVCs of
+ * the document are smaller than the storage size, and so need to be
+ * expanded.  PVCs which don't yet exist are ignored, as they will be created
+ * with the correct size.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getVolumesToExpand(
+			h *RequestHandle) (
+				[]ibmv1.IBMSecurityVerifyDirectoryExpansionStatus, error) {
+
+	var volumes []ibmv1.IBMSecurityVerifyDirectoryExpansionStatus
+
+	size := h.directory.Spec.StorageSize
+
+	if size == nil {
+		return nil, nil
+	}
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "getVolumesToExpand",
+						"Size", size.String())...)
+
+	pvcs := h.directory.Spec.Replicas.PVCs
+
+	if h.directory.Spec.Pods.Proxy.PVC != "" {
+		pvcs = append(append([]string{}, pvcs...),
+						h.directory.Spec.Pods.Proxy.PVC)
+	}
+
+	for _, pvcName := range pvcs {
+		pvc, err := r.getPVC(h, pvcName)
+
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if pvc.Spec.Resources.Requests.Storage().Cmp(*size) >= 0 {
+			continue
+		}
+
+		volumes = append(volumes,
+			ibmv1.IBMSecurityVerifyDirectoryExpansionStatus{
+				PVC:       pvcName,
+				Requested: size.DeepCopy(),
+				Capacity:  r.getPVCCapacity(pvc),
+				State:     ibmv1.ExpansionStatePending,
+			})
+	}
+
+	return volumes, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the ExpandingVolumes phase of
+ * the workflow.  Each of the PVCs is patched with the new size, and we then
+ * wait for each of the volumes to be resized, restarting the pods which use
+ * the PVCs, one at a time, if required.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) expandVolumes(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "expandVolumes")...)
+
+	original := h.directory.Status.DeepCopy()
+	volumes  := h.directory.Status.VolumesToExpand
+
+	/*
+	 * Only a single pod is restarted at a time.
+	 */
+
+	restarting := false
+
+	for _, volume := range volumes {
+		if volume.State == ibmv1.ExpansionStateRestarting {
+			restarting = true
+		}
+	}
+
+	complete := true
+
+	for idx := range volumes {
+		volume := &volumes[idx]
+
+		switch volume.State {
+			case ibmv1.ExpansionStatePending:
+				err := r.expandVolume(h, volume.PVC, volume.Requested)
+
+				if err != nil {
+					return "", err
+				}
+
+				volume.State = ibmv1.ExpansionStateResizing
+
+			case ibmv1.ExpansionStateResizing,
+					ibmv1.ExpansionStateRestarting:
+				pvc, err := r.getPVC(h, volume.PVC)
+
+				if err != nil {
+					return "", err
+				}
+
+				volume.Capacity = r.getPVCCapacity(pvc)
+
+				resized := volume.Capacity != nil &&
+							volume.Capacity.Cmp(volume.Requested) >= 0
+
+				if resized {
+					ready, err := r.isVolumeUserReady(h, volume.PVC)
+
+					if err != nil {
+						return "", err
+					}
+
+					if ready {
+						r.Log.Info("The PVC has been expanded",
+								r.createLogParams(h, "PVC.Name", volume.PVC,
+									"Capacity", volume.Capacity.String())...)
+
+						r.recordEvent(h, EventVolumeExpanded,
+							"The PVC, %s, has been expanded to %s.",
+							volume.PVC, volume.Capacity.String())
+
+						volume.State = ibmv1.ExpansionStateComplete
+					}
+
+					break
+				}
+
+				if volume.State == ibmv1.ExpansionStateResizing &&
+							!restarting && r.isFileSystemResizePending(pvc) {
+					err = r.restartVolumeUser(h, volume.PVC)
+
+					if err != nil {
+						return "", err
+					}
+
+					now := metav1.Now()
+
+					h.directory.Status.PhaseStartTime = &now
+
+					volume.State = ibmv1.ExpansionStateRestarting
+					restarting   = true
+				}
+		}
+
+		if volume.State != ibmv1.ExpansionStateComplete {
+			complete = false
+		}
+	}
+
+	if complete {
+		return r.getPostExpansionPhase(h), nil
+	}
+
+	/*
+	 * Save the progress of the expansion, as the status is only saved by
+	 * the workflow when we move on to the next phase.
+	 */
+
+	err := r.saveStatus(h, original)
+
+	if err != nil {
+		return "", err
+	}
+
+	return ibmv1.PhaseExpandingVolumes, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine the phase which follows the
+ * ExpandingVolumes phase.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getPostExpansionPhase(
+			h *RequestHandle) ibmv1.IBMSecurityVerifyDirectoryPhase {
+
+	if len(h.directory.Status.ReplicasToUpdate) > 0 {
+		return ibmv1.PhaseUpdatingReplicas
+	}
+
+	return r.getPostUpdatePhase(h)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to request a new size for a PVC.  An error
+ * will be returned if the storage class of the PVC does not allow volume
+ * expansion.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) expandVolume(
+			h       *RequestHandle,
+			pvcName string,
+			size    resource.Quantity) error {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "expandVolume",
+						"PVC.Name", pvcName, "Size", size.String())...)
+
+	pvc, err := r.getPVC(h, pvcName)
+
+	if err != nil {
+		return err
+	}
+
+	if pvc.Spec.Resources.Requests.Storage().Cmp(size) >= 0 {
+		return nil
+	}
+
+	err = r.checkVolumeExpansion(h, pvc)
+
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(pvc.DeepCopy())
+
+	if pvc.Spec.Resources.Requests == nil {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+
+	r.Log.Info("Expanding the PVC",
+				r.createLogParams(h, "PVC.Name", pvcName,
+						"Size", size.String())...)
+
+	err = r.Patch(h.ctx, pvc, patch)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to expand the PVC",
+					r.createLogParams(h, "PVC.Name", pvcName)...)
+
+		return err
+	}
+
+	r.recordEvent(h, EventVolumeExpanding,
+			"The PVC, %s, is being expanded to %s.", pvcName, size.String())
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to ensure that the storage class of a PVC
+ * allows the PVC to be expanded.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) checkVolumeExpansion(
+			h   *RequestHandle,
+			pvc *corev1.PersistentVolumeClaim) error {
+
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return errors.New(fmt.Sprintf("The PVC, %s, cannot be expanded as " +
+				"it does not have a storage class.", pvc.Name))
+	}
+
+	className := *pvc.Spec.StorageClassName
+	class     := &storagev1.StorageClass{}
+
+	err := r.Get(h.ctx, types.NamespacedName{Name: className}, class)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to retrieve the storage class",
+					r.createLogParams(h, "StorageClass.Name", className)...)
+
+		return err
+	}
+
+	if class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		return errors.New(fmt.Sprintf("The PVC, %s, cannot be expanded as " +
+				"the storage class, %s, does not allow volume expansion.",
+				pvc.Name, className))
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to restart the pods which use the
+ * specified PVC, so that the file system of the volume can be resized.  The
+ * proxy is given a rolling restart, and the pod of a replica is deleted so
+ * that it is recreated by its replica set.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) restartVolumeUser(
+			h       *RequestHandle,
+			pvcName string) error {
+
+	r.Log.Info("Restarting the pods which use the PVC",
+				r.createLogParams(h, "PVC.Name", pvcName)...)
+
+	if pvcName == h.directory.Spec.Pods.Proxy.PVC {
+		for _, name := range r.getProxyDeploymentNames(h) {
+			dep := &appsv1.Deployment{}
+
+			err := r.Get(h.ctx, types.NamespacedName{
+							Name:      name,
+							Namespace: h.directory.Namespace}, dep)
+
+			if err != nil {
+				if k8serrors.IsNotFound(err) {
+					continue
+				}
+
+				return err
+			}
+
+			err = r.restartProxyDeployment(h, dep)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	pods, err := r.getReplicaPods(h, pvcName)
+
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods {
+		if pod.ObjectMeta.DeletionTimestamp != nil {
+			continue
+		}
+
+		r.Log.Info("Restarting the pod for the replica",
+				r.createLogParams(h, "PVC.Name", pvcName, "Pod", pod.Name)...)
+
+		err = r.Delete(h.ctx, &pod)
+
+		if err != nil && ! k8serrors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to delete the pod",
+						r.createLogParams(h, "Pod", pod.Name)...)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the pods which use
+ * the specified PVC are ready following the expansion of the PVC.  We only
+ * wait for replicas, as the proxy has multiple pods.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isVolumeUserReady(
+			h       *RequestHandle,
+			pvcName string) (bool, error) {
+
+	if pvcName == h.directory.Spec.Pods.Proxy.PVC {
+		return true, nil
+	}
+
+	return r.isReplicaReady(h, pvcName)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the file system of the
+ * volume of a PVC can only be resized when the volume is next mounted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isFileSystemResizePending(
+			pvc *corev1.PersistentVolumeClaim) bool {
+
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Type == corev1.PersistentVolumeClaimFileSystemResizePending &&
+					condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the specified PVC.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getPVC(
+			h       *RequestHandle,
+			pvcName string) (*corev1.PersistentVolumeClaim, error) {
+
+	pvc := &corev1.PersistentVolumeClaim{}
+
+	err := r.Get(h.ctx, types.NamespacedName{
+					Name:      pvcName,
+					Namespace: h.directory.Namespace}, pvc)
+
+	if err != nil && ! k8serrors.IsNotFound(err) {
+		r.Log.Error(err, "Failed to retrieve the PVC",
+					r.createLogParams(h, "PVC.Name", pvcName)...)
+	}
+
+	return pvc, err
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the capacity of a PVC, as
+ * reported in the status of the PVC.  Nil is returned if the PVC has not
+ * yet been bound.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getPVCCapacity(
+			pvc *corev1.PersistentVolumeClaim) *resource.Quantity {
+
+	capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+
+	if !ok {
+		return nil
+	}
+
+	return &capacity
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the names of each of the proxy
+ * deployments of the document.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getProxyDeploymentNames(
+			h *RequestHandle) []string {
+
+	name  := utils.GetProxyDeploymentName(h.directory.Name)
+	zones := h.directory.Spec.GetZones()
+
+	if len(zones) == 0 {
+		return []string{name}
+	}
+
+	names := []string{}
+
+	for _, zone := range zones {
+		names = append(names, utils.GetProxyZoneName(name, zone))
+	}
+
+	return names
+}
+
+/*****************************************************************************/
+
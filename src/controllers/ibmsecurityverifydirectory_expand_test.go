@@ -0,0 +1,157 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the expansion of the PVCs.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1    "k8s.io/api/core/v1"
+	metav1    "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("expandVolumes", func() {
+	const namespace = "default"
+	const pvcName   = "isvd-proxy-pvc"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	createPVC := func(className string) {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: pvcName, Namespace: namespace},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteOnce,
+				},
+				StorageClassName: &className,
+				Resources:        corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("1Gi"),
+					},
+				},
+			},
+		}
+
+		Expect(k8sClient.Create(context.Background(), pvc)).To(Succeed())
+	}
+
+	createStorageClass := func(name string, expansion bool) {
+		Expect(k8sClient.Create(context.Background(), &storagev1.StorageClass{
+			ObjectMeta:           metav1.ObjectMeta{Name: name},
+			Provisioner:          "example.com/test",
+			AllowVolumeExpansion: &expansion,
+		})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		size := resource.MustParse("2Gi")
+
+		h = newTestHandle("expand", namespace, []string{"replica-1"})
+
+		h.directory.Spec.StorageSize    = &size
+		h.directory.Spec.Pods.Proxy.PVC = pvcName
+
+		createTestDocument(h.directory)
+	})
+
+	AfterEach(func() {
+		k8sClient.Delete(context.Background(), &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: pvcName, Namespace: namespace},
+		})
+
+		for _, name := range []string{"expandable", "fixed"} {
+			k8sClient.Delete(context.Background(), &storagev1.StorageClass{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+			})
+		}
+	})
+
+	It("expands a PVC which is smaller than the storage size", func() {
+		createStorageClass("expandable", true)
+		createPVC("expandable")
+
+		volumes, err := reconciler.getVolumesToExpand(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes).To(HaveLen(1))
+		Expect(volumes[0].PVC).To(Equal(pvcName))
+
+		h.directory.Status.VolumesToExpand = volumes
+
+		phase, err := reconciler.expandVolumes(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseExpandingVolumes))
+		Expect(h.directory.Status.VolumesToExpand[0].State).To(
+						Equal(ibmv1.ExpansionStateResizing))
+
+		pvc := &corev1.PersistentVolumeClaim{}
+
+		Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Name: pvcName, Namespace: namespace}, pvc)).To(Succeed())
+		Expect(pvc.Spec.Resources.Requests.Storage().String()).To(
+						Equal("2Gi"))
+
+		/*
+		 * Once the volume has been resized the expansion is complete.
+		 */
+
+		pvc.Status.Capacity = corev1.ResourceList{
+			corev1.ResourceStorage: resource.MustParse("2Gi"),
+		}
+
+		Expect(k8sClient.Status().Update(
+						context.Background(), pvc)).To(Succeed())
+
+		phase, err = reconciler.expandVolumes(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseDeployingProxy))
+		Expect(h.directory.Status.VolumesToExpand[0].State).To(
+						Equal(ibmv1.ExpansionStateComplete))
+	})
+
+	It("rejects a storage class which doesn't allow expansion", func() {
+		createStorageClass("fixed", false)
+		createPVC("fixed")
+
+		volumes, err := reconciler.getVolumesToExpand(h)
+
+		Expect(err).NotTo(HaveOccurred())
+
+		h.directory.Status.VolumesToExpand = volumes
+
+		_, err = reconciler.expandVolumes(h)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,265 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains in-memory implementations of the PodExecutor and
+ * PodResolver interfaces which are used when testing the controller.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * A command which has been executed by the FakePodExecutor.
+ */
+
+type FakeCommand struct {
+	Namespace string
+	Pod       string
+	Command   []string
+}
+
+/*****************************************************************************/
+
+/*
+ * The FakePodExecutor structure records each of the commands which are 
+ * executed.  By default each command succeeds with no output, but a 
+ * handler can be supplied to control the result of each command.
+ */
+
+type FakePodExecutor struct {
+	lock     sync.Mutex
+	commands []FakeCommand
+
+	Handler  func(pod string, command []string) (string, string, error)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to execute a command.
+ */
+
+func (e *FakePodExecutor) Execute(
+			ctx       context.Context,
+			namespace string,
+			pod       string,
+			command   []string) (string, string, error) {
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.commands = append(e.commands, FakeCommand{
+		Namespace: namespace,
+		Pod:       pod,
+		Command:   append([]string{}, command...),
+	})
+
+	if e.Handler != nil {
+		return e.Handler(pod, command)
+	}
+
+	return "", "", nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve each of the commands which
+ * have been executed, in the format: <pod>: <command>.
+ */
+
+func (e *FakePodExecutor) Commands() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	var commands []string
+
+	for _, command := range e.commands {
+		commands = append(commands, fmt.Sprintf("%s: %s", 
+					command.Pod, strings.Join(command.Command, " ")))
+	}
+
+	return commands
+}
+
+/*****************************************************************************/
+
+/*
+ * The FakePodResolver structure resolves the pod of a replica set from a
+ * map of replica set names to pod names.
+ */
+
+type FakePodResolver struct {
+	Pods map[string]string
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to get the name of the pod which is being
+ * managed by the specified replica set.
+ */
+
+func (p *FakePodResolver) GetReplicaSetPod(
+			ctx        context.Context,
+			namespace  string,
+			replicaSet string) (string, error) {
+
+	pod, ok := p.Pods[replicaSet]
+
+	if !ok {
+		return "", errors.New(fmt.Sprintf(
+				"The pod for the replica, %s, does not exist.", replicaSet))
+	}
+
+	return pod, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to skip the current test if the test API
+ * server has not been started, which is the case when the control plane
+ * binaries are not available.
+ */
+
+func requireTestEnvironment() {
+	if k8sClient == nil {
+		Skip("KUBEBUILDER_ASSETS is not set; run the tests with 'make test'")
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create a reconciler which uses the
+ * test client, along with the fake executor, resolver and event recorder.
+ */
+
+func newTestReconciler(
+			executor *FakePodExecutor,
+			resolver *FakePodResolver) (
+				*IBMSecurityVerifyDirectoryReconciler, *record.FakeRecorder) {
+
+	recorder := record.NewFakeRecorder(100)
+
+	return &IBMSecurityVerifyDirectoryReconciler{
+		Client:   k8sClient,
+		Log:      logf.Log.WithName("test"),
+		Scheme:   scheme.Scheme,
+		Recorder: recorder,
+		Executor: executor,
+		Resolver: resolver,
+	}, recorder
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create a request handle for a document
+ * which contains the specified replicas.  The document references the
+ * default server and proxy ConfigMaps so that it can also be created in the
+ * test API server.
+ */
+
+func newTestHandle(
+			name      string,
+			namespace string,
+			pvcs      []string) *RequestHandle {
+
+	return &RequestHandle{
+		ctx:       context.Background(),
+		directory: &ibmv1.IBMSecurityVerifyDirectory{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: ibmv1.IBMSecurityVerifyDirectorySpec{
+				Replicas: ibmv1.IBMSecurityVerifyDirectoryReplica{
+					PVCs: pvcs,
+				},
+				Pods: ibmv1.IBMSecurityVerifyDirectoryPods{
+					ConfigMap: ibmv1.IBMSecurityVerifyDirectoryConfigMap{
+						Proxy:  ibmv1.IBMSecurityVerifyDirectoryConfigMapEntry{
+							Name: "isvd-proxy", Key: ConfigMapKey,
+						},
+						Server: ibmv1.IBMSecurityVerifyDirectoryConfigMapEntry{
+							Name: "isvd-server", Key: ConfigMapKey,
+						},
+					},
+				},
+			},
+		},
+		config: ServerConfig{
+			port:     9389,
+			adminDn:  "cn=root",
+			suffixes: []string{"o=sample"},
+		},
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create a document in the test API
+ * server.  The document is deleted once the current test has completed.
+ */
+
+func createTestDocument(directory *ibmv1.IBMSecurityVerifyDirectory) {
+	Expect(k8sClient.Create(context.Background(), directory)).To(Succeed())
+
+	DeferCleanup(func() {
+		k8sClient.Delete(context.Background(), directory)
+	})
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to drain the events which have been
+ * recorded by the fake event recorder.
+ */
+
+func getRecordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+
+	for {
+		select {
+			case event := <-recorder.Events:
+				events = append(events, event)
+
+			default:
+				return events
+		}
+	}
+}
+
+/*****************************************************************************/
+
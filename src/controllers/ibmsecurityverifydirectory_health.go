@@ -0,0 +1,177 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * monitor the health of the replication agreements between the replicas.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The name of the condition which reports the health of the replication
+ * agreements.
+ */
+
+const ReplicationHealthyCondition = "ReplicationHealthy"
+
+/*
+ * The states of a replication agreement which indicate that the agreement
+ * is no longer able to replicate changes to its consumer.
+ */
+
+var UnhealthyAgreementStates = []string{
+	"retrying",
+	"on hold",
+	"error log full",
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to check the health of the replication
+ * agreements of each of the replicas.  The state of each agreement is saved
+ * in the status of the replica, the ReplicationHealthy condition is set and
+ * the replication metrics are published.  The status is not saved by this
+ * function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) checkReplicationHealth(
+			h *RequestHandle) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "checkReplicationHealth")...)
+
+	var problems []string
+
+	published := make(
+			map[string][]ibmv1.IBMSecurityVerifyDirectoryAgreementStatus)
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		status := r.getReplicaStatus(h, pvcName)
+
+		/*
+		 * We can only query a replica which is currently running.
+		 */
+
+		healthy, err := r.isReplicaHealthy(h, pvcName)
+
+		if err != nil || !healthy {
+			problems = append(problems,
+				fmt.Sprintf("The replica, %s, is not available.", pvcName))
+
+			continue
+		}
+
+		agreements, err := r.getReplicationAgreements(h, pvcName)
+
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Failed to retrieve the " +
+				"replication agreements of the replica, %s: %s",
+				pvcName, err.Error()))
+
+			continue
+		}
+
+		/*
+		 * Work out the health of each agreement.  The time of the last
+		 * successful replication is retained from the previous check if
+		 * the most recent replication attempt has failed.
+		 */
+
+		for idx := range agreements {
+			agreement := &agreements[idx]
+
+			agreement.Healthy = r.isAgreementHealthy(agreement)
+
+			if agreement.LastSuccessTime == nil {
+				for _, previous := range status.Agreements {
+					if previous.Consumer == agreement.Consumer &&
+								previous.Suffix == agreement.Suffix {
+						agreement.LastSuccessTime = previous.LastSuccessTime
+					}
+				}
+			}
+
+			if !agreement.Healthy {
+				problems = append(problems, fmt.Sprintf("The replication " +
+					"agreement from %s to %s for %s is %s (%s).",
+					pvcName, agreement.Consumer, agreement.Suffix,
+					agreement.State, agreement.LastResult))
+			}
+		}
+
+		status.Agreements  = agreements
+		published[pvcName] = agreements
+	}
+
+	r.setAgreementMetrics(h.directory.Namespace, h.directory.Name, published)
+
+	/*
+	 * Set the condition.
+	 */
+
+	condition := metav1.Condition{
+		Type:               ReplicationHealthyCondition,
+		ObservedGeneration: h.directory.Generation,
+	}
+
+	if len(problems) == 0 {
+		condition.Status  = metav1.ConditionTrue
+		condition.Reason  = "AgreementsHealthy"
+		condition.Message = "All of the replication agreements are healthy."
+	} else {
+		condition.Status  = metav1.ConditionFalse
+		condition.Reason  = "AgreementsUnhealthy"
+		condition.Message = strings.Join(problems, " ")
+
+		r.Log.Info("The replication agreements are not healthy",
+				r.createLogParams(h, "Problems", problems)...)
+	}
+
+	meta.SetStatusCondition(&h.directory.Status.Conditions, condition)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the specified
+ * replication agreement is healthy.  An agreement is unhealthy if the server
+ * reports that the agreement is unable to replicate changes, or if the most
+ * recent replication attempt failed.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isAgreementHealthy(
+			agreement *ibmv1.IBMSecurityVerifyDirectoryAgreementStatus) bool {
+
+	for _, state := range UnhealthyAgreementStates {
+		if agreement.State == state {
+			return false
+		}
+	}
+
+	fields := strings.Fields(agreement.LastResult)
+
+	return len(fields) < 3 || fields[2] == "0"
+}
+
+/*****************************************************************************/
+
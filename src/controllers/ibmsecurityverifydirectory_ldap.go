@@ -0,0 +1,372 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * query the directory server replicas over LDAP.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+/*****************************************************************************/
+
+/*
+ * The format of the time values which are returned by the server.
+ */
+
+const LdapTimeFormat = "20060102150405Z"
+
+/*
+ * The maximum amount of time which we will wait for a replica to accept a
+ * connection, or to respond to a request, so that a replica which is not
+ * responding cannot block the worker.
+ */
+
+const LdapTimeout = 30 * time.Second
+
+/*
+ * The name of the replication group, beneath each suffix, which holds the
+ * replication topology of the suffix.
+ */
+
+const ReplicaGroupRdn = "ibm-replicaGroup=default"
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to connect, and bind, to the specified
+ * replica.  The connection is made using the cluster service for the replica.
+ * The caller is responsible for closing the returned connection.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) connectToReplica(
+			h       *RequestHandle,
+			pvcName string) (l *ldap.Conn, err error) {
+
+	address := fmt.Sprintf("%s.%s.svc",
+					r.getReplicaPodName(h.directory, pvcName),
+					h.directory.Namespace)
+
+	r.Log.V(1).Info("Connecting to the LDAP server",
+			r.createLogParams(h, "Address", address,
+						"Port", h.config.port)...)
+
+	dialer := ldap.DialWithDialer(&net.Dialer{Timeout: LdapTimeout})
+
+	if h.config.secure {
+		l, err = ldap.DialURL(
+				fmt.Sprintf("ldaps://%s:%d", address, h.config.port),
+				ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+				dialer)
+	} else {
+		l, err = ldap.DialURL(
+				fmt.Sprintf("ldap://%s:%d", address, h.config.port), dialer)
+	}
+
+	if err != nil {
+		r.Log.Error(err, "Failed to connect to the LDAP server",
+					r.createLogParams(h, "Address", address)...)
+
+		return
+	}
+
+	/*
+	 * Bind to the server.  The administrator credentials may reference a
+	 * secret, and so they need to be resolved first.
+	 */
+
+	l.SetTimeout(LdapTimeout)
+
+	adminDn, adminPwd, err := r.resolveAdminCredentials(h)
+
+	if err != nil {
+		l.Close()
+
+		return nil, err
+	}
+
+	err = l.Bind(adminDn, adminPwd)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to bind to the LDAP server",
+					r.createLogParams(h, "Address", address)...)
+
+		l.Close()
+
+		return nil, err
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to resolve the DN and password of the
+ * administrator.  Either of the values may reference a secret (i.e.
+ * secret:<name>/<key>), in which case the value is retrieved from the
+ * secret.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) resolveAdminCredentials(
+			h *RequestHandle) (adminDn string, adminPwd string, err error) {
+
+	adminDn,  dnOk  := utils.ResolveEntry(
+						h.config.adminDn, h.directory.Namespace).(string)
+	adminPwd, pwdOk := utils.ResolveEntry(
+						h.config.adminPwd, h.directory.Namespace).(string)
+
+	if !dnOk || !pwdOk {
+		err = errors.New("Failed to resolve the administrator credentials " +
+				"from the server configuration.")
+
+		r.Log.Error(err, "Failed to resolve the administrator credentials",
+					r.createLogParams(h)...)
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the replication
+ * agreement with the specified DN belongs to the specified supplier.  The
+ * supplier of an agreement is identified by the ibm-replicaServerId RDN of
+ * the parent of the agreement entry.  An agreement whose DN does not 
+ * identify the supplier is assumed to belong to the supplier.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isSupplierAgreement(
+			dn         string,
+			supplierId string) bool {
+
+	parsed, err := ldap.ParseDN(dn)
+
+	if err != nil {
+		return true
+	}
+
+	for _, rdn := range parsed.RDNs {
+		for _, attribute := range rdn.Attributes {
+			if strings.EqualFold(attribute.Type, "ibm-replicaServerId") {
+				return strings.EqualFold(attribute.Value, supplierId)
+			}
+		}
+	}
+
+	return true
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the state of each of the
+ * replication agreements of the specified supplier replica.  The state is
+ * held in the operational attributes of the replication agreement entries
+ * of the supplier, and the consumer of each agreement is identified by the
+ * replica identifier which was used when the agreement was created.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getReplicationAgreements(
+			h           *RequestHandle,
+			supplierPvc string) (
+				agreements []ibmv1.IBMSecurityVerifyDirectoryAgreementStatus,
+				err        error) {
+
+	r.Log.V(1).Info("Entering a function",
+			r.createLogParams(h, "Function", "getReplicationAgreements",
+				"Supplier.PVC", supplierPvc)...)
+
+	l, err := r.connectToReplica(h, supplierPvc)
+
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	/*
+	 * The replica identifier of each consumer is the pod name of the 
+	 * consumer, and so we need to be able to map the identifier back to 
+	 * the PVC of the consumer.
+	 */
+
+	consumers  := make(map[string]string)
+	supplierId := r.getReplicaPodName(h.directory, supplierPvc)
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		consumers[r.getReplicaPodName(h.directory, pvcName)] = pvcName
+	}
+
+	attributes := []string{
+		"ibm-replicaConsumerId",
+		"ibm-replicationState",
+		"ibm-replicationPendingChangeCount",
+		"ibm-replicationLastResult",
+		"ibm-replicationLastFinishTime",
+	}
+
+	/*
+	 * The agreements are held beneath the replication group of each suffix,
+	 * and so we only search the replication group rather than the data of
+	 * the whole suffix.
+	 */
+
+	for _, suffix := range h.config.suffixes {
+		searchRequest := ldap.NewSearchRequest(
+			fmt.Sprintf("%s,%s", ReplicaGroupRdn, suffix),
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 
+			int(LdapTimeout.Seconds()), false,
+			"(objectclass=ibm-replicationAgreement)",
+			attributes,
+			nil,
+		)
+
+		sr, err := l.Search(searchRequest)
+
+		if err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+				continue
+			}
+
+			r.Log.Error(err, "Failed to search for the replication agreements",
+				r.createLogParams(h, "Supplier.PVC", supplierPvc,
+							"Suffix", suffix)...)
+
+			return nil, err
+		}
+
+		for _, entry := range sr.Entries {
+			/*
+			 * The agreements of the whole topology are replicated to each
+			 * replica, and so we only want the agreements of this supplier.
+			 */
+
+			if !r.isSupplierAgreement(entry.DN, supplierId) {
+				continue
+			}
+
+			consumer := entry.GetAttributeValue("ibm-replicaConsumerId")
+
+			if pvcName, ok := consumers[consumer]; ok {
+				consumer = pvcName
+			}
+
+			agreement := ibmv1.IBMSecurityVerifyDirectoryAgreementStatus{
+				Consumer:   consumer,
+				Suffix:     suffix,
+				State:      strings.ToLower(
+							entry.GetAttributeValue("ibm-replicationState")),
+				LastResult: entry.GetAttributeValue(
+											"ibm-replicationLastResult"),
+			}
+
+			value := entry.GetAttributeValue(
+								"ibm-replicationPendingChangeCount")
+
+			if value != "" {
+				pending, err := strconv.Atoi(value)
+
+				if err != nil {
+					return nil, err
+				}
+
+				agreement.PendingChanges = int32(pending)
+			}
+
+			/*
+			 * The last result is of the format:
+			 *   <time> <change-id> <result-code> <operation> <dn>
+			 * A result code of 0 indicates that the change was 
+			 * successfully replicated.
+			 */
+
+			fields := strings.Fields(agreement.LastResult)
+
+			if len(fields) >= 3 && fields[2] == "0" {
+				finished := entry.GetAttributeValue(
+								"ibm-replicationLastFinishTime")
+
+				if finished == "" {
+					finished = fields[0]
+				}
+
+				if t, err := time.Parse(LdapTimeFormat, finished); err == nil {
+					success := metav1.NewTime(t)
+
+					agreement.LastSuccessTime = &success
+				}
+			}
+
+			agreements = append(agreements, agreement)
+		}
+	}
+
+	r.Log.V(1).Info("Retrieved the replication agreements",
+			r.createLogParams(h, "Supplier.PVC", supplierPvc,
+				"Agreements", agreements)...)
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine the number of changes which
+ * the specified supplier replica still needs to replicate to the specified
+ * consumer replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getPendingChangeCount(
+			h           *RequestHandle,
+			supplierPvc string,
+			consumerPvc string) (count int, err error) {
+
+	r.Log.V(1).Info("Entering a function",
+			r.createLogParams(h, "Function", "getPendingChangeCount",
+				"Supplier.PVC", supplierPvc, "Consumer.PVC", consumerPvc)...)
+
+	agreements, err := r.getReplicationAgreements(h, supplierPvc)
+
+	if err != nil {
+		return
+	}
+
+	for _, agreement := range agreements {
+		if agreement.Consumer == consumerPvc {
+			count += int(agreement.PendingChanges)
+		}
+	}
+
+	r.Log.V(1).Info("Retrieved the pending change count",
+			r.createLogParams(h, "Supplier.PVC", supplierPvc,
+				"Consumer.PVC", consumerPvc, "Count", count)...)
+
+	return
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,444 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the Prometheus metrics which are published by the
+ * controller.  The metrics are registered with the controller-runtime
+ * registry and so they are served from the metrics address of the manager.
+ */
+
+/*****************************************************************************/
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The prefix which is used for each of the metrics.
+ */
+
+const MetricsNamespace = "isvd_operator"
+
+/*****************************************************************************/
+
+/*
+ * The metrics which are published by the controller.
+ */
+
+var (
+	/*
+	 * The amount of time taken to complete each phase of the workflow.  This
+	 * includes the time spent waiting for the seed jobs to complete, for the
+	 * pods to become ready and for the replication agreements to be created.
+	 */
+
+	phaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "phase_duration_seconds",
+			Help:      "The amount of time taken to complete a workflow phase.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"phase"},
+	)
+
+	/*
+	 * The number of times that each phase of the workflow has failed.
+	 */
+
+	phaseFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "phase_failures_total",
+			Help:      "The number of times that a workflow phase has failed.",
+		},
+		[]string{"phase"},
+	)
+
+	/*
+	 * The number of replicas, and the number of ready replicas, for each
+	 * document.
+	 */
+
+	replicaCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replicas",
+			Help:      "The number of replicas which are defined by a document.",
+		},
+		[]string{"namespace", "name"},
+	)
+
+	readyReplicaCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "ready_replicas",
+			Help:      "The number of replicas of a document which are ready.",
+		},
+		[]string{"namespace", "name"},
+	)
+
+	/*
+	 * The number of times that the proxy has been restarted because the
+	 * generated proxy configuration has changed.
+	 */
+
+	proxyRestarts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "proxy_restarts_total",
+			Help:      "The number of times that the proxy has been " +
+							"restarted due to a configuration change.",
+		},
+		[]string{"namespace", "name"},
+	)
+
+	/*
+	 * The latency, and number of failures, of the commands which are
+	 * executed within the pods.  The commands are labelled with the name of
+	 * the executable so that the number of label values remains small.
+	 */
+
+	commandDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "command_duration_seconds",
+			Help:      "The amount of time taken to execute a command in a pod.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		},
+		[]string{"command"},
+	)
+
+	commandErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "command_errors_total",
+			Help:      "The number of commands executed in a pod which failed.",
+		},
+		[]string{"command"},
+	)
+
+	/*
+	 * The state of each replication agreement, as observed by the most
+	 * recent replication health check.
+	 */
+
+	agreementLabels = []string{
+		"namespace", "name", "supplier", "consumer", "suffix",
+	}
+
+	agreementPendingChanges = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replication_pending_changes",
+			Help:      "The number of changes which are still to be " +
+							"replicated by a replication agreement.",
+		},
+		agreementLabels,
+	)
+
+	agreementHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replication_agreement_healthy",
+			Help:      "Whether a replication agreement is healthy (1) or " +
+							"not (0).",
+		},
+		agreementLabels,
+	)
+
+	agreementLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replication_last_success_timestamp_seconds",
+			Help:      "The time at which a change was last successfully " +
+							"replicated by a replication agreement.",
+		},
+		agreementLabels,
+	)
+
+	/*
+	 * The number of replication agreements which differed from the 
+	 * full-mesh topology when the topology was last checked, and the number
+	 * of agreements which have been repaired.
+	 */
+
+	topologyDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "topology_drift_agreements",
+			Help:      "The number of replication agreements which differ " +
+							"from the full-mesh topology.",
+		},
+		[]string{"namespace", "name", "type"},
+	)
+
+	topologyRepairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "topology_repairs_total",
+			Help:      "The number of replication agreements which have been " +
+							"repaired.",
+		},
+		[]string{"namespace", "name", "type"},
+	)
+
+	/*
+	 * The usage of the file system of each replica, as observed by the most
+	 * recent storage check.
+	 */
+
+	storageLabels = []string{"namespace", "name", "pvc"}
+
+	storageCapacity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replica_storage_capacity_bytes",
+			Help:      "The size of the file system of a replica.",
+		},
+		storageLabels,
+	)
+
+	storageUsed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replica_storage_used_bytes",
+			Help:      "The number of bytes in use on the file system of a " +
+							"replica.",
+		},
+		storageLabels,
+	)
+
+	storageAvailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "replica_storage_available_bytes",
+			Help:      "The number of bytes available on the file system of " +
+							"a replica.",
+		},
+		storageLabels,
+	)
+
+	/*
+	 * The label values of the agreement metrics which have been published
+	 * for each document, indexed by <namespace>/<name>.  This allows us to
+	 * remove the metrics for agreements which no longer exist.
+	 */
+
+	agreementMetricsLock  sync.Mutex
+	agreementMetricValues = make(map[string][][]string)
+
+	/*
+	 * The label values of the storage metrics which have been published
+	 * for each document, indexed by <namespace>/<name>.
+	 */
+
+	storageMetricsLock  sync.Mutex
+	storageMetricValues = make(map[string][][]string)
+)
+
+/*****************************************************************************/
+
+/*
+ * Register the metrics with the controller-runtime registry.
+ */
+
+func init() {
+	metrics.Registry.MustRegister(
+		phaseDuration,
+		phaseFailures,
+		replicaCount,
+		readyReplicaCount,
+		proxyRestarts,
+		commandDuration,
+		commandErrors,
+		agreementPendingChanges,
+		agreementHealthy,
+		agreementLastSuccess,
+		topologyDrift,
+		topologyRepairs,
+		storageCapacity,
+		storageUsed,
+		storageAvailable,
+	)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to record the completion of the current
+ * phase of the workflow.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) observePhaseDuration(
+			h *RequestHandle) {
+
+	start := h.directory.Status.PhaseStartTime
+
+	if start == nil {
+		return
+	}
+
+	phaseDuration.WithLabelValues(string(h.directory.Status.Phase)).Observe(
+						time.Since(start.Time).Seconds())
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to record the execution of a command.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) observeCommand(
+			command []string,
+			start   time.Time,
+			err     error) {
+
+	name := ""
+
+	if len(command) > 0 {
+		name = command[0]
+	}
+
+	commandDuration.WithLabelValues(name).Observe(
+						time.Since(start).Seconds())
+
+	if err != nil {
+		commandErrors.WithLabelValues(name).Inc()
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to remove the metrics for a document
+ * which has been deleted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteDocumentMetrics(
+			namespace string,
+			name      string) {
+
+	replicaCount.DeleteLabelValues(namespace, name)
+	readyReplicaCount.DeleteLabelValues(namespace, name)
+	proxyRestarts.DeleteLabelValues(namespace, name)
+
+	for _, driftType := range []ibmv1.IBMSecurityVerifyDirectoryDriftType{
+							ibmv1.DriftTypeMissing, ibmv1.DriftTypeStale} {
+		topologyDrift.DeleteLabelValues(namespace, name, string(driftType))
+		topologyRepairs.DeleteLabelValues(namespace, name, string(driftType))
+	}
+
+	r.setAgreementMetrics(namespace, name, nil)
+	r.setStorageMetrics(namespace, name, nil)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to publish the metrics for the replication
+ * agreements of a document.  The agreements are indexed by the PVC of the 
+ * supplier replica.  Any metrics which were previously published for the
+ * document, and which are no longer current, are removed.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) setAgreementMetrics(
+			namespace  string,
+			name       string,
+			agreements map[string][]ibmv1.IBMSecurityVerifyDirectoryAgreementStatus) {
+
+	agreementMetricsLock.Lock()
+	defer agreementMetricsLock.Unlock()
+
+	key := namespace + "/" + name
+
+	for _, values := range agreementMetricValues[key] {
+		agreementPendingChanges.DeleteLabelValues(values...)
+		agreementHealthy.DeleteLabelValues(values...)
+		agreementLastSuccess.DeleteLabelValues(values...)
+	}
+
+	delete(agreementMetricValues, key)
+
+	for supplier, entries := range agreements {
+		for _, agreement := range entries {
+			values := []string{
+				namespace, name, supplier, agreement.Consumer, agreement.Suffix,
+			}
+
+			healthy := 0.0
+
+			if agreement.Healthy {
+				healthy = 1.0
+			}
+
+			agreementPendingChanges.WithLabelValues(values...).Set(
+						float64(agreement.PendingChanges))
+			agreementHealthy.WithLabelValues(values...).Set(healthy)
+
+			if agreement.LastSuccessTime != nil {
+				agreementLastSuccess.WithLabelValues(values...).Set(
+						float64(agreement.LastSuccessTime.Unix()))
+			}
+
+			agreementMetricValues[key] = 
+						append(agreementMetricValues[key], values)
+		}
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to publish the storage metrics of a 
+ * document.  The usage is indexed by the PVC of the replica.  Any metrics 
+ * which were previously published for the document, and which are no longer
+ * current, are removed.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) setStorageMetrics(
+			namespace string,
+			name      string,
+			usage     map[string]*ibmv1.IBMSecurityVerifyDirectoryStorageUsage) {
+
+	storageMetricsLock.Lock()
+	defer storageMetricsLock.Unlock()
+
+	key := namespace + "/" + name
+
+	for _, values := range storageMetricValues[key] {
+		storageCapacity.DeleteLabelValues(values...)
+		storageUsed.DeleteLabelValues(values...)
+		storageAvailable.DeleteLabelValues(values...)
+	}
+
+	delete(storageMetricValues, key)
+
+	for pvcName, entry := range usage {
+		values := []string{namespace, name, pvcName}
+
+		storageCapacity.WithLabelValues(values...).Set(float64(entry.Capacity))
+		storageUsed.WithLabelValues(values...).Set(float64(entry.Used))
+		storageAvailable.WithLabelValues(values...).Set(
+						float64(entry.Available))
+
+		storageMetricValues[key] = append(storageMetricValues[key], values)
+	}
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,281 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the interfaces which are used by the controller to
+ * execute commands within the replica pods, and to locate the pod which is
+ * managed by a replica set, along with the implementations of these
+ * interfaces which are used when running within a cluster.  The interfaces
+ * are injected into the controller so that alternative implementations can
+ * be used when testing the controller.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1  "k8s.io/api/core/v1"
+	appsv1  "k8s.io/api/apps/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/kubectl/pkg/scheme"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/*****************************************************************************/
+
+/*
+ * The maximum amount of time which a command is allowed to run within a
+ * pod.
+ */
+
+const CommandTimeout = 120 * time.Second
+
+/*****************************************************************************/
+
+/*
+ * The PodExecutor interface is used to execute a command within a pod.  The
+ * standard output and standard error of the command are returned.
+ */
+
+type PodExecutor interface {
+	Execute(ctx       context.Context,
+			namespace string,
+			pod       string,
+			command   []string) (stdout string, stderr string, err error)
+}
+
+/*
+ * The PodResolver interface is used to locate the name of the pod which is
+ * currently being managed by a replica set.  An error is returned if the
+ * pod does not currently exist.
+ */
+
+type PodResolver interface {
+	GetReplicaSetPod(ctx        context.Context,
+			namespace  string,
+			replicaSet string) (string, error)
+}
+
+/*****************************************************************************/
+
+/*
+ * The ClusterPodExecutor structure implements the PodExecutor interface
+ * using the exec sub-resource of the pod.
+ */
+
+type ClusterPodExecutor struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create a new ClusterPodExecutor for the
+ * specified cluster configuration.
+ */
+
+func NewClusterPodExecutor(config *rest.Config) (*ClusterPodExecutor, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClusterPodExecutor{
+		config:    config,
+		clientset: clientset,
+	}, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to execute a command within the specified
+ * pod.
+ */
+
+func (e *ClusterPodExecutor) Execute(
+			ctx       context.Context,
+			namespace string,
+			pod       string,
+			command   []string) (string, string, error) {
+
+	/*
+	 * Construct the request.
+	 */
+
+	option := &corev1.PodExecOptions{
+		Command:   command,
+		Stdout:    true,
+		Stderr:    true,
+		TTY:       false,
+	}
+
+	request := e.clientset.
+		CoreV1().
+		RESTClient().
+		Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(option, scheme.ParameterCodec)
+
+	/*
+	 * Execute the command.
+	 */
+
+	exec, err := remotecommand.NewSPDYExecutor(
+								e.config, "POST", request.URL())
+	if err != nil {
+		return "", "", err
+	}
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	err = streamWithContext(ctx, func() error {
+		return exec.Stream(remotecommand.StreamOptions{
+					Stdout: &stdout, Stderr: &stderr})
+	})
+
+	if err != nil && ctx.Err() != nil {
+		return "", "", errors.New(fmt.Sprintf("The command, %s, did not " +
+			"complete within %s on the pod, %s.",
+			strings.Join(redactCommand(command), " "),
+			CommandTimeout, pod))
+	}
+
+	return stdout.String(), stderr.String(), err
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to run the specified stream until it
+ * completes or the context is done, whichever happens first.  The stream of
+ * this version of the client cannot be cancelled, and so a stream which is
+ * abandoned is left to complete in the background.  The output of an 
+ * abandoned stream must not be used.
+ */
+
+func streamWithContext(ctx context.Context, stream func() error) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- stream()
+	}()
+
+	select {
+		case err := <-done:
+			return err
+
+		case <-ctx.Done():
+			return ctx.Err()
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The ClusterPodResolver structure implements the PodResolver interface
+ * using a controller-runtime client.
+ */
+
+type ClusterPodResolver struct {
+	client client.Client
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create a new ClusterPodResolver which
+ * uses the specified client.
+ */
+
+func NewClusterPodResolver(client client.Client) *ClusterPodResolver {
+	return &ClusterPodResolver{
+		client: client,
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to get the name of the pod which is being
+ * managed by the specified replica set.
+ */
+
+func (p *ClusterPodResolver) GetReplicaSetPod(
+			ctx        context.Context,
+			namespace  string,
+			replicaSet string) (string, error) {
+
+	/*
+	 * Retrieve the replica set.
+	 */
+
+	rep := &appsv1.ReplicaSet{}
+	err := p.client.Get(ctx,
+				types.NamespacedName{
+					Name:      replicaSet,
+					Namespace: namespace}, rep)
+
+	if err != nil {
+		return "", err
+	}
+
+	/*
+	 * Retrieve the pods which match the selector of the replica set.
+	 */
+
+	selector, err := metav1.LabelSelectorAsSelector(rep.Spec.Selector)
+
+	if err != nil {
+		return "", err
+	}
+
+	podList := &corev1.PodList{}
+
+	err = p.client.List(ctx, podList,
+				client.InNamespace(namespace),
+				client.MatchingLabelsSelector{Selector: selector})
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, pod := range podList.Items {
+		if pod.ObjectMeta.DeletionTimestamp == nil {
+			return pod.Name, nil
+		}
+	}
+
+	return "", errors.New(fmt.Sprintf(
+				"The pod for the replica, %s, does not exist.", replicaSet))
+}
+
+/*****************************************************************************/
+
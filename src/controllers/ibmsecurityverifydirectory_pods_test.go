@@ -0,0 +1,55 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the execution of commands within the
+ * pods.
+ */
+
+/*****************************************************************************/
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("streamWithContext", func() {
+	It("returns the result of a stream which completes", func() {
+		err := streamWithContext(context.Background(), func() error {
+			return errors.New("failed")
+		})
+
+		Expect(err).To(MatchError("failed"))
+	})
+
+	It("abandons a stream which does not complete in time", func() {
+		ctx, cancel := context.WithTimeout(
+						context.Background(), 10 * time.Millisecond)
+		defer cancel()
+
+		release := make(chan struct{})
+		defer close(release)
+
+		err := streamWithContext(ctx, func() error {
+			<-release
+
+			return nil
+		})
+
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+})
+
+/*****************************************************************************/
+
@@ -18,14 +18,12 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"bytes"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 	"time"
 
-	"github.com/go-yaml/yaml"
 	"github.com/ibm-security/verify-directory-operator/utils"
 
 	k8syaml "sigs.k8s.io/yaml"
@@ -41,6 +39,17 @@ import (
 
 /*****************************************************************************/
 
+/*
+ * The preference values which are given to the server groups in the local
+ * zone of a proxy, and to the server groups in the other zones.  The proxy
+ * will send requests to the available groups with the lowest value.
+ */
+
+const LocalGroupPreference  = 1
+const RemoteGroupPreference = 2
+
+/*****************************************************************************/
+
 /*
  * The following function is used to deploy/redeploy the proxy.
  */
@@ -49,67 +58,124 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deployProxy(
 			h *RequestHandle) error {
 
 	r.Log.V(1).Info("Entering a function", 
-				r.createLogParams(h, "Function", "deleteProxy")...)
+				r.createLogParams(h, "Function", "deployProxy")...)
 
 	/*
-	 * Retrieve the ConfigMap which contains the server configuration.  We
-	 * convert the YAML representation into JSON as it is easier to process
-	 * the raw JSON.  Ideally we would use native GoLang packages to process
-	 * the data, but all of these packages require schemas to be defined and
-	 * this would be a pain.
+	 * Retrieve the base configuration for the proxy, as supplied by the
+	 * user.
 	 */
 
-	json, port, err := r.getProxyJson(h)
+	base, port, err := r.getProxyBaseConfig(h)
 
 	if err != nil {
 		return err
 	}
 
 	/*
-	 * Construct the full YAML configuration for the proxy.
+	 * If the replica groups have been placed in zones we create a proxy
+	 * deployment, with its own configuration, in each zone so that each 
+	 * proxy can prefer the replicas in its own zone.  Otherwise a single
+	 * proxy deployment is used.
 	 */
 
-	yaml, err := r.constructProxyYaml(h, json)
+	name        := utils.GetProxyDeploymentName(h.directory.Name)
+	zones       := h.directory.Spec.GetZones()
+	deployments := []string{}
 
-	if err != nil {
-		return err
+	if len(zones) == 0 {
+		deployments = append(deployments, name)
+	}
+
+	for _, zone := range zones {
+		deployments = append(deployments, utils.GetProxyZoneName(name, zone))
 	}
 
 	/*
-	 * Save the proxy configuration map.
+	 * Remove any proxy deployments which are no longer required (e.g. for
+	 * a zone which is no longer used).  This is done before the required
+	 * deployments are created as the selector of the proxy deployment 
+	 * without a zone also matches the proxy pods of each zone, and so the 
+	 * two kinds of deployment must never exist at the same time.
 	 */
 
-	updated, err := r.saveProxyConfig(h, yaml)
+	err = r.deleteStaleProxies(h, deployments)
 
 	if err != nil {
 		return err
 	}
 
 	/*
-	 * We now want to create/restart the proxy.
+	 * Construct the full YAML configuration for the proxy, save the 
+	 * configuration, and then create/restart the proxy.
 	 */
 
-	err = r.createProxyDeployment(h, port, updated)
+	if len(zones) == 0 {
+		yaml, err := r.constructProxyYaml(h, base, "")
 
-	if err != nil {
-		return err
+		if err != nil {
+			return err
+		}
+
+		updated, err := r.saveProxyConfig(h, 
+						utils.GetProxyConfigName(h.directory.Name), yaml)
+
+		if err != nil {
+			return err
+		}
+
+		err = r.createProxyDeployment(h, port, updated, "")
+
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	for _, zone := range zones {
+		yaml, err := r.constructProxyYaml(h, base, zone)
+
+		if err != nil {
+			return err
+		}
+
+		updated, err := r.saveProxyConfig(h, 
+			utils.GetProxyZoneName(
+				utils.GetProxyConfigName(h.directory.Name), zone), yaml)
+
+		if err != nil {
+			return err
+		}
+
+		err = r.createProxyDeployment(h, port, updated, zone)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	/*
+	 * Create the cluster service for the proxy.  This is done independently
+	 * of the deployments so that the service will be recreated if it has
+	 * been deleted.  The service selects the proxy pods of every zone.
+	 */
+
+	return r.createProxyService(h, name, port, r.getProxyLabels(h, ""))
 }
 
 /*****************************************************************************/
 
 /*
  * The following function is used to retrieve the base proxy configuration data
- * as a JSON string.
+ * as a generic map.  The configuration is unmarshalled via JSON so that all
+ * of the nested maps are keyed by strings, which allows the configuration to
+ * be marshalled again once the generated entries have been added.
  */
 
-func (r *IBMSecurityVerifyDirectoryReconciler) getProxyJson(
-			h *RequestHandle) (json string, port int32, err error) {
+func (r *IBMSecurityVerifyDirectoryReconciler) getProxyBaseConfig(
+			h *RequestHandle) (base map[string]interface{}, 
+					port int32, err error) {
 
 	r.Log.V(1).Info("Entering a function", 
-				r.createLogParams(h, "Function", "getProxyJson")...)
+				r.createLogParams(h, "Function", "getProxyBaseConfig")...)
 
 	/*
 	 * Retrieve the ConfigMap for the proxy.
@@ -134,10 +200,12 @@ func (r *IBMSecurityVerifyDirectoryReconciler) getProxyJson(
 				r.createLogParams(h, "Name", name, "Data", config)...)
 
 	/*
-	 * Convert the convert map data to JSON.
+	 * Unmarshal the ConfigMap data.
 	 */
 
-	data, err := k8syaml.YAMLToJSON([]byte(config.Data[key]))
+	base = make(map[string]interface{})
+
+	err = k8syaml.Unmarshal([]byte(config.Data[key]), &base)
 
 	if err != nil {
  		r.Log.Error(err, "Failed to load the ConfigMap data",
@@ -146,27 +214,16 @@ func (r *IBMSecurityVerifyDirectoryReconciler) getProxyJson(
 		return
 	}
 
-	json = string(data)
-
 	r.Log.V(1).Info("Retrieved the proxy base data.", 
-				r.createLogParams(h, "Name", name, "Key", key, "Data", json)...)
+				r.createLogParams(h, "Name", name, "Key", key, "Data", base)...)
 
 	/*
 	 * Determine the port which will be used by the proxy.
 	 */
 
-	port = 9389
+	proxyConfig, err := utils.ParseConfig(config.Data[key])
 
-	/*
-	 * Parse the YAML configuration into a map.  Unfortunately it is not
-	 * easy to parse YAML into a generic structure, and so after we have
-	 * unmarshalled the data we want to iteratively convert the data into
-	 * a map of strings.
-	 */
-
-	var body interface{}
-
-	if err = yaml.Unmarshal([]byte(config.Data[key]), &body); err != nil {
+	if err != nil {
  		r.Log.Error(err, "Failed to load the ConfigMap data",
 						r.createLogParams(h, "ConfigMap.Name", name,
 								"ConfigMap.Key", key)...)
@@ -174,62 +231,18 @@ func (r *IBMSecurityVerifyDirectoryReconciler) getProxyJson(
 		return
 	}
 
-	body      = utils.ConvertYaml(body)
-	body, ok := body.(map[string]interface{})
+	port, _, err = proxyConfig.GetPort(h.directory.Namespace)
 
-	if ! ok {
-		err = errors.New("The server configuration cannot be parsed.")
+	if err != nil {
+ 		r.Log.Error(err, "Failed to process the ConfigMap data",
+						r.createLogParams(h, "ConfigMap.Name", name,
+								"ConfigMap.Key", key)...)
 
 		return
 	}
 
-	ldap := utils.GetYamlValue(body, []string{"general", "ports", "ldap"}, 
-						true, h.directory.Namespace)
-
-	r.Log.V(1).Info("Retrieved the proxy LDAP port configuration.", 
-				r.createLogParams(h, "Port", ldap)...)
-
-	if ldap != nil {
-		iport, ok := ldap.(int)
-
-		if ! ok {
-			err = errors.New(
-						"The general.ports.ldap configuration is incorrect.")
-
-			return
-		}
-
-		port = int32(iport)
-
-		if port == 0 {
-			/*
-			 * If the port is 0 it means that it has not been activated and
-			 * so we need to use the ldaps port.
-			 */
-
-			port = 9636
-
-			ldaps := utils.GetYamlValue(
-							body, []string{"general", "ports", "ldaps"}, 
-							true, h.directory.Namespace)
-
-			r.Log.V(1).Info("Retrieved the proxy LDAPS port configuration.", 
-				r.createLogParams(h, "Port", ldaps)...)
-
-			if ldaps != nil {
-				iport, ok := ldaps.(int)
-
-				if ! ok {
-					err = errors.New(
-						"The general.ports.ldaps configuration is incorrect.")
-
-					return
-				}
-
-				port = int32(iport)
-			}
-		}
-	}
+	r.Log.V(1).Info("Retrieved the proxy port configuration.", 
+				r.createLogParams(h, "Port", port)...)
 
 	return
 }
@@ -238,104 +251,119 @@ func (r *IBMSecurityVerifyDirectoryReconciler) getProxyJson(
 
 /*
  * The following function is used to construct the proxy configuration YAML.
+ * The generated server-groups and suffixes entries are added to the proxy
+ * section of the base configuration.  The keys of a map are always
+ * marshalled in sorted order, and so the same configuration will always
+ * produce the same YAML.  If a zone is specified the server groups in the
+ * zone will be preferred over the server groups in the other zones.
  */
 
 func (r *IBMSecurityVerifyDirectoryReconciler) constructProxyYaml(
 			h    *RequestHandle,
-			json string) (yamlConfig string, err error) {
+			base map[string]interface{},
+			zone string) (yamlConfig string, err error) {
 
 	r.Log.V(1).Info("Entering a function", 
 				r.createLogParams(h, "Function", "constructProxyYaml",
-						"JSON", json)...)
+						"Base", base, "Zone", zone)...)
 
 	/*
-	 * Remove the closing '}' from the json string.
+	 * Locate the proxy section of the base configuration, creating the 
+	 * section if it doesn't already exist.
 	 */
 
-	closingIdx := strings.LastIndex(json, "}")
+	var proxy map[string]interface{}
 
-	if closingIdx == -1 {
- 		r.Log.Error(err, "Failed to parse the proxy ConfigMap data",
-			r.createLogParams(h, 
-				"ConfigMap.Name", h.directory.Spec.Pods.ConfigMap.Proxy.Name,
-				"ConfigMap.Key", h.directory.Spec.Pods.ConfigMap.Proxy.Key)...)
+	switch entry := base["proxy"].(type) {
+		case nil:
+			proxy = make(map[string]interface{})
 
-		return
-	}
+		case map[string]interface{}:
+			proxy = entry
 
-	json = json[0:closingIdx]
+		default:
+			err = errors.New(fmt.Sprintf("The proxy configuration entry in " +
+					"the proxy ConfigMap must be a map, but a value of type " +
+					"%T was found.", entry))
 
-	/*
-	 * Create a slice which contains each of the replica names.
-	 */
-
-	var names []string
+ 			r.Log.Error(err, "Failed to parse the proxy ConfigMap data",
+				r.createLogParams(h, 
+				"ConfigMap.Name", h.directory.Spec.Pods.ConfigMap.Proxy.Name,
+				"ConfigMap.Key", h.directory.Spec.Pods.ConfigMap.Proxy.Key)...)
 
-	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
-		names = append(names, r.getReplicaPodName(h.directory, pvcName))
+			return
 	}
-	
-	/*
-	 * Suffixes......
-	 */
 
 	/*
-	 * Construct the list of servers which will be used in the suffixes
-	 * configuration.  The server configuration will be an
-	 * array of entries which look like the following:
-	 *    { "name": <pod> }
+	 * Suffixes......
+	 *
+	 * If the suffixes have not been partitioned each suffix is split across
+	 * all of the replicas, otherwise each split of a suffix is served by the
+	 * replicas of the groups of the split.
 	 */
 
-	var servers bytes.Buffer
+	var suffixes []utils.ProxySuffix
 
-	servers.WriteString("[")
+	for idx, suffix := range h.config.suffixes {
+		r.Log.V(1).Info("Adding a suffix to the proxy configuration.", 
+				r.createLogParams(h, "Suffix", suffix)...)
 
-	for idx, pod := range names {
-		if idx != 0 {
-			servers.WriteString(",")
+		entry := utils.ProxySuffix{
+			Base:    suffix,
+			Name:    fmt.Sprintf("split_%d", idx),
 		}
 
-		servers.WriteString(fmt.Sprintf("{ \"name\": \"%s\" }", pod))
-	}
+		partition := h.directory.Spec.GetPartition(suffix)
 
-	servers.WriteString("]")
+		if partition == nil {
+			if len(h.directory.Spec.Partitions) > 0 {
+				err = errors.New(fmt.Sprintf("The suffix, %s, is not " +
+						"included in spec.partitions.", suffix))
 
-	/*
-	 * Create the suffixes entry.  It will look something like the
-	 * following:
-	 *   [ { "base": "<suffix>", "name": "split_x", "servers": <servers> } ]
-	 */
+				r.Log.Error(err, "Failed to construct the proxy configuration",
+						r.createLogParams(h, "Suffix", suffix)...)
 
-	var suffixes bytes.Buffer
+				return
+			}
 
-	suffixes.WriteString("[")
+			for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+				entry.Servers = append(entry.Servers, utils.ProxySuffixServer{ 
+					Name: r.getReplicaPodName(h.directory, pvcName),
+				})
+			}
+		} else {
+			if len(partition.Splits) > 1 {
+				entry.NumPartitions = len(partition.Splits)
+			}
 
-	for idx, suffix := range h.config.suffixes {
-		r.Log.V(1).Info("Adding a suffix to the proxy configuration.", 
-				r.createLogParams(h, "Suffix", suffix)...)
+			for splitIdx, split := range partition.Splits {
+				for _, group := range split.Groups {
+					for _, pvcName := range 
+								h.directory.Spec.GetGroupPVCs(group) {
+						server := utils.ProxySuffixServer{ 
+							Name: r.getReplicaPodName(h.directory, pvcName),
+						}
 
-		if idx != 0 {
-			suffixes.WriteString(",")
-		}
+						if entry.NumPartitions > 0 {
+							server.PartitionIndex = splitIdx + 1
+						}
 
-		entry := fmt.Sprintf(
-			"{ \"base\": \"%s\", \"name\": \"split_%d\", \"servers\": %s }", 
-			suffix, idx, servers.String())
+						entry.Servers = append(entry.Servers, server)
+					}
+				}
+			}
+		}
 
-		suffixes.WriteString(entry)
+		suffixes = append(suffixes, entry)
 	}
 
-	suffixes.WriteString("]")
-
 	/*
 	 * Server-Groups....
 	 *
-	 * We will have a single server group which looks like the following:
-	 *  [ { "name": "proxy", "servers": [ <server> ] } ]
-	 *
-	 * Each server in the server group will look like the following:
-	 *  { "name": <pod>, "id": <pod>, "target": <pod-addr>, \
-	 *    "user" : { "dn": <dn>, "password": <pwd> } }
+	 * If no replica groups have been defined we will have a single server 
+	 * group which contains each of the replicas, otherwise we will have a
+	 * server group for each of the replica groups.  The proxy will send
+	 * requests to the available groups with the lowest preference value.
 	 */
 
 	var prefix string
@@ -346,42 +374,69 @@ func (r *IBMSecurityVerifyDirectoryReconciler) constructProxyYaml(
 		prefix = "ldap"
 	}
 
-	var serverGroups bytes.Buffer
+	var groups []utils.ProxyServerGroup
+
+	if len(h.directory.Spec.Replicas.Groups) == 0 {
+		groups = append(groups, utils.ProxyServerGroup{
+			Name: "proxy",
+		})
+	} else {
+		for _, group := range h.directory.Spec.Replicas.Groups {
+			entry := utils.ProxyServerGroup{
+				Name:   group.Name,
+				Weight: int(group.Weight),
+			}
+
+			if zone != "" {
+				if strings.EqualFold(group.Zone, zone) {
+					entry.Preference = LocalGroupPreference
+				} else {
+					entry.Preference = RemoteGroupPreference
+				}
+			}
+
+			groups = append(groups, entry)
+		}
+	}
 
-	serverGroups.WriteString("[ { \"name\": \"proxy\", \"servers\": [")
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		pod := r.getReplicaPodName(h.directory, pvcName)
 
-	for idx, pod := range names {
 		r.Log.V(1).Info("Adding a server to the proxy configuration.", 
 				r.createLogParams(h, "Pod", pod)...)
 
-		if idx != 0 {
-			serverGroups.WriteString(",")
-		}
+		idx := 0
 
-		entry := fmt.Sprintf(
-			"{ \"name\": \"%s\", \"id\": \"%s\", \"target\": \"%s://%s:%d\", " +
-			"\"user\": { \"dn\": \"%s\", \"password\": \"%s\" } }", 
-			pod, pod, prefix, pod, h.config.port, 
-			h.config.adminDn, h.config.adminPwd)
+		for gidx := range groups {
+			if groups[gidx].Name == h.directory.Spec.GetReplicaGroup(pvcName) {
+				idx = gidx
+			}
+		}
 
-		serverGroups.WriteString(entry)
+		groups[idx].Servers = append(groups[idx].Servers, utils.ProxyServer{
+			Name:   pod,
+			Id:     pod,
+			Target: fmt.Sprintf("%s://%s:%d", prefix, pod, h.config.port),
+			User:   utils.ProxyUser{
+				Dn:       h.config.adminDn,
+				Password: h.config.adminPwd,
+			},
+		})
 	}
 
-	serverGroups.WriteString("] } ]")
-
 	/*
-	 * Now we can construct the entire JSON document.
+	 * Now we can construct the entire configuration document.
 	 */
 
-	config := fmt.Sprintf(
-				"%s, \"proxy\": { \"server-groups\": %s, \"suffixes\": %s } }",
-				json, serverGroups.String(), suffixes.String())
+	proxy["server-groups"] = groups
+	proxy["suffixes"]      = suffixes
+	base["proxy"]          = proxy
 
 	/*
-	 * Convert the JSON document to YAML.
+	 * Convert the configuration to YAML.
 	 */
 
-	yamlBytes, err := k8syaml.JSONToYAML([]byte(config))
+	yamlBytes, err := k8syaml.Marshal(base)
 
 	if err != nil {
  		r.Log.Error(err, "Failed to construct the proxy ConfigMap data",
@@ -395,7 +450,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) constructProxyYaml(
 	yamlConfig = string(yamlBytes)
 
 	r.Log.V(1).Info("Constructed the proxy configuration.", 
-				r.createLogParams(h, "YAML", yamlConfig)...)
+				r.createLogParams(h)...)
 
 	return
 }
@@ -404,73 +459,127 @@ func (r *IBMSecurityVerifyDirectoryReconciler) constructProxyYaml(
 /*****************************************************************************/
 
 /*
- * The following function is used to save the proxy configuration map.
+ * The following function is used to save the proxy configuration.  The
+ * generated configuration contains the credentials which the proxy uses to
+ * bind to the replicas, and so it is stored in a Secret rather than a 
+ * ConfigMap.
  */
 
 func (r *IBMSecurityVerifyDirectoryReconciler) saveProxyConfig(
 			h    *RequestHandle,
+			name string,
 			yaml string) (updated bool, err error) {
 
 	r.Log.V(1).Info("Entering a function", 
 				r.createLogParams(h, "Function", "saveProxyConfig",
-						"YAML", yaml)...)
-
-	name := utils.GetProxyConfigMapName(h.directory.Name)
+						"Secret.Name", name)...)
 
 	/*
-	 * Check to see if the ConfigMap already exists.
+	 * Check to see if the Secret already exists.
 	 */
 
-	configMap := &corev1.ConfigMap{}
-	err        = r.Get(h.ctx, 
+	secret := &corev1.Secret{}
+	err     = r.Get(h.ctx, 
 					types.NamespacedName{
 						Name:	   name,
-						Namespace: h.directory.Namespace}, configMap)
+						Namespace: h.directory.Namespace}, secret)
 
 	if err != nil && ! k8serrors.IsNotFound(err) {
  		r.Log.Error(err, "Failed to retrieve the proxy configuration",
-			r.createLogParams(h, "ConfigMap.Name", name)...)
+			r.createLogParams(h, "Secret.Name", name)...)
 
 		return
 	}
 
-	r.Log.V(1).Info("Retrieved the existing proxy configuration.", 
-				r.createLogParams(h, "ConfigMap", configMap)...)
-
 	/*
-	 * If the ConfigMap already exists we now need to see whether the
+	 * If the Secret already exists we now need to see whether the
 	 * configuration data has changed or not.
 	 */
 
 	if err == nil {
-		if yaml == configMap.Data[utils.ProxyCMKey] {
+		if yaml == string(secret.Data[utils.ProxyCMKey]) {
 			r.Log.V(1).Info("The proxy configuration has not changed.", 
 				r.createLogParams(h)...)
 
 			updated = false
 
-			return
+			return false, r.deleteProxyConfigMap(h)
 		}
 	}
 
 	/*
 	 * If we get this far we know that we need to create/update the
-	 * configmap.
+	 * secret.
 	 */
 
 	updated = true
 
-	err = r.createConfigMap(h, name, utils.ProxyCMKey, yaml)
+	err = r.createSecret(h, name, utils.ProxyCMKey, yaml)
 
 	if err != nil {
 		return
 	}
 
+	r.recordEvent(h, EventProxyConfigChanged, 
+				"The proxy configuration, %s, has been updated.", name)
+
+	err = r.deleteProxyConfigMap(h)
+
 	return
 }
 
 /*****************************************************************************/
 
+/*
+ * Earlier versions of the operator stored the generated proxy configuration,
+ * including the administrator password, in a ConfigMap.  The following 
+ * function is used to delete this ConfigMap, if it exists and is owned by
+ * the document, now that the configuration is stored in a Secret.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteProxyConfigMap(
+			h *RequestHandle) (err error) {
+
+	name := utils.GetProxyConfigName(h.directory.Name)
+
+	configMap := &corev1.ConfigMap{}
+	err        = r.Get(h.ctx, 
+					types.NamespacedName{
+						Name:	   name,
+						Namespace: h.directory.Namespace}, configMap)
+
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+
+ 		r.Log.Error(err, "Failed to retrieve the proxy ConfigMap",
+			r.createLogParams(h, "ConfigMap.Name", name)...)
+
+		return
+	}
+
+	if ! metav1.IsControlledBy(configMap, h.directory) {
+		return nil
+	}
+
+	r.Log.Info("Deleting the obsolete proxy ConfigMap", 
+				r.createLogParams(h, "ConfigMap.Name", name)...)
+
+	err = r.Delete(h.ctx, configMap)
+
+	if err != nil && ! k8serrors.IsNotFound(err) {
+ 		r.Log.Error(err, "Failed to delete the proxy ConfigMap",
+			r.createLogParams(h, "ConfigMap.Name", name)...)
+
+		return
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
 /*
  * The following function will create the proxy deployment if it has not already
  * been created, otherwise it will restart the deployment.
@@ -479,13 +588,20 @@ func (r *IBMSecurityVerifyDirectoryReconciler) saveProxyConfig(
 func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 			h       *RequestHandle,
 			port    int32,
-			updated bool) (err error) {
+			updated bool,
+			zone    string) (err error) {
 
 	r.Log.V(1).Info("Entering a function", 
 				r.createLogParams(h, "Function", "createProxyDeployment",
-						"Port", port, "Updated", updated)...)
+						"Port", port, "Updated", updated, "Zone", zone)...)
 
-	name := utils.GetProxyDeploymentName(h.directory.Name)
+	name       := utils.GetProxyDeploymentName(h.directory.Name)
+	secretName := utils.GetProxyConfigName(h.directory.Name)
+
+	if zone != "" {
+		name       = utils.GetProxyZoneName(name, zone)
+		secretName = utils.GetProxyZoneName(secretName, zone)
+	}
 
 	/*
 	 * Check to see whether the pod already exists.
@@ -511,8 +627,6 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 	 * Construct the new pod definition.
 	 */
 
-	configMapName := utils.GetProxyConfigMapName(h.directory.Name)
-	
 	imageName := fmt.Sprintf("%s/verify-directory-proxy:%s", 
 					h.directory.Spec.Pods.Image.Repo, 
 					h.directory.Spec.Pods.Image.Label)
@@ -535,10 +649,8 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 		{
 			Name: "isvd-proxy-config",
 			VolumeSource: corev1.VolumeSource{
-				ConfigMap: &corev1.ConfigMapVolumeSource{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: configMapName,
-					},
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secretName,
 					Items: []corev1.KeyToPath{{
 						Key:  utils.ProxyCMKey,
 						Path: utils.ProxyCMKey,
@@ -621,10 +733,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 	 * Set the labels for the pod.
 	 */
 
-	labels := map[string]string{
-		"app.kubernetes.io/kind":    "IBMSecurityVerifyDirectory",
-		"app.kubernetes.io/cr-name": name,
-	}
+	labels := r.getProxyLabels(h, zone)
 
 	/*
 	 * Finalise the deployment definition.
@@ -656,6 +765,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 					ImagePullSecrets:   h.directory.Spec.Pods.Image.ImagePullSecrets,
 					ServiceAccountName: h.directory.Spec.Pods.ServiceAccountName,
 					SecurityContext:    h.directory.Spec.Pods.SecurityContext,
+					Affinity:           r.getZoneAffinity(zone),
 					Hostname:           name,
 					Containers:         []corev1.Container{{
 						Env:             env,
@@ -674,30 +784,53 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 		},
 	}
 
+	/*
+	 * Kubernetes will add default values to the deployment specification and
+	 * so we can't simply compare the specification of the existing 
+	 * deployment with our new specification.  Instead we store a hash of
+	 * our specification as an annotation and compare the hash values.
+	 */
+
+	hash := utils.GetSpecHash(dep.Spec)
+
+	dep.ObjectMeta.Annotations = map[string]string{
+		utils.SpecHashKey: hash,
+	}
+
 	/*
 	 * Create or restart the deployment.
 	 */
 
 	if err == nil {
-		if ! reflect.DeepEqual(olddep.Spec, dep.Spec) {
+		if olddep.ObjectMeta.Annotations[utils.SpecHashKey] != hash {
 			/*
 			 * The deployment already exists, but the pod specification has
-			 * changed.  We want to update the pod now.
+			 * changed.  We want to update the pod now.  We update the existing
+			 * object so that we retain the resource version.
 			 */
 
-			ctrl.SetControllerReference(h.directory, dep, r.Scheme)
+			olddep.ObjectMeta.Labels = dep.ObjectMeta.Labels
+			olddep.Spec              = dep.Spec
+
+			if olddep.ObjectMeta.Annotations == nil {
+				olddep.ObjectMeta.Annotations = make(map[string]string)
+			}
+
+			olddep.ObjectMeta.Annotations[utils.SpecHashKey] = hash
+
+			ctrl.SetControllerReference(h.directory, olddep, r.Scheme)
 
 			r.Log.Info("Updating a proxy deployment", 
-						r.createLogParams(h, "Deployment.Name", dep.Name)...)
+						r.createLogParams(h, "Deployment.Name", name)...)
 
 			r.Log.V(1).Info("Proxy deployment details.", 
-				r.createLogParams(h, "Deployment", dep)...)
+				r.createLogParams(h, "Deployment", olddep)...)
 
-			err = r.Update(h.ctx, dep)
+			err = r.Update(h.ctx, olddep)
 
 			if err != nil {
 				r.Log.Error(err, "Failed to update the proxy deployment",
-						r.createLogParams(h, "Deployment.Name", dep.Name)...)
+						r.createLogParams(h, "Deployment.Name", name)...)
 
 				return
 			}
@@ -706,30 +839,18 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 		if updated {
 			/*
 			 * The deployment already exists and so we just need to perform a
-			 * rolling restart.
+			 * rolling restart.  Only the restarts which are caused by a 
+			 * change to the configuration are counted.
 			 */
 
-			patch      := client.MergeFrom(dep.DeepCopy())
-			annotation := "kubectl.kubernetes.io/restartedAt"
-
-			if dep.Spec.Template.ObjectMeta.Annotations == nil {
-				dep.Spec.Template.ObjectMeta.Annotations = make(map[string]string)
-			}
-
-			dep.Spec.Template.ObjectMeta.Annotations[annotation] = 
-							time.Now().Format("20060102150405")
-
-			r.Log.V(1).Info("Restarting the proxy deployment.", 
-				r.createLogParams(h, "Deployment", dep)...)
-
-			err = r.Patch(h.ctx, dep, patch)
+			err = r.restartProxyDeployment(h, olddep)
 
 			if err != nil {
-				r.Log.Error(err, "Failed to restart the proxy deployment",
-					r.createLogParams(h, "Deployment.Name", name)...)
-
 				return
 			}
+
+			proxyRestarts.WithLabelValues(
+						h.directory.Namespace, h.directory.Name).Inc()
 		}
 
 	} else {
@@ -753,52 +874,269 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createProxyDeployment(
 
 			return
 		}
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to perform a rolling restart of an existing
+ * proxy deployment.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) restartProxyDeployment(
+			h   *RequestHandle,
+			dep *appsv1.Deployment) error {
+
+	patch      := client.MergeFrom(dep.DeepCopy())
+	annotation := "kubectl.kubernetes.io/restartedAt"
+
+	if dep.Spec.Template.ObjectMeta.Annotations == nil {
+		dep.Spec.Template.ObjectMeta.Annotations = make(map[string]string)
+	}
+
+	dep.Spec.Template.ObjectMeta.Annotations[annotation] = 
+					time.Now().Format("20060102150405")
+
+	r.Log.V(1).Info("Restarting the proxy deployment.", 
+		r.createLogParams(h, "Deployment", dep)...)
+
+	err := r.Patch(h.ctx, dep, patch)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to restart the proxy deployment",
+			r.createLogParams(h, "Deployment.Name", dep.Name)...)
+
+		return err
+	}
+
+	r.recordEvent(h, EventProxyRestarted, 
+		"The proxy deployment, %s, has been restarted.", dep.Name)
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to construct the labels for the proxy pods
+ * in the specified zone.  The labels which are used when no zone is 
+ * specified select the proxy pods of every zone.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getProxyLabels(
+			h    *RequestHandle,
+			zone string) map[string]string {
+
+	labels := map[string]string{
+		"app.kubernetes.io/kind":    "IBMSecurityVerifyDirectory",
+		"app.kubernetes.io/cr-name": 
+						utils.GetProxyDeploymentName(h.directory.Name),
+	}
+
+	if zone != "" {
+		labels[utils.ProxyZoneLabel] = zone
+	}
+
+	return labels
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to delete any proxy deployments, owned by
+ * the document, which are not in the specified list of deployments.  The
+ * configuration Secret of a deleted zone deployment is also deleted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteStaleProxies(
+			h    *RequestHandle,
+			keep []string) (err error) {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "deleteStaleProxies",
+						"Keep", keep)...)
+
+	deployments := &appsv1.DeploymentList{}
+
+	err = r.List(h.ctx, deployments, 
+				client.InNamespace(h.directory.Namespace),
+				client.MatchingLabels(
+						utils.LabelsForApp(h.directory.Name, "")))
+
+	if err != nil {
+ 		r.Log.Error(err, "Failed to retrieve the proxy deployments",
+			r.createLogParams(h)...)
+
+		return
+	}
+
+	for idx := range deployments.Items {
+		dep := &deployments.Items[idx]
+
+		if utils.Contains(keep, dep.Name) || 
+						! metav1.IsControlledBy(dep, h.directory) {
+			continue
+		}
+
+		r.Log.Info("Deleting a proxy deployment which is no longer required", 
+				r.createLogParams(h, "Deployment.Name", dep.Name)...)
+
+		err = r.Delete(h.ctx, dep)
+
+		if err != nil && ! k8serrors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to delete the proxy deployment",
+				r.createLogParams(h, "Deployment.Name", dep.Name)...)
+
+			return
+		}
 
 		/*
-		 * Create the cluster service for the proxy.
+		 * The configuration for the proxy without zones is always retained
+		 * as it is used when validating an update to the document which
+		 * adds the zones.  The configuration of a zone deployment is named
+		 * after the zone, which is taken from the selector of the 
+		 * deployment.
 		 */
 
-		service := &corev1.Service{
+		zone := ""
+
+		if dep.Spec.Selector != nil {
+			zone = dep.Spec.Selector.MatchLabels[utils.ProxyZoneLabel]
+		}
+
+		if dep.Name == utils.GetProxyDeploymentName(h.directory.Name) || 
+						zone == "" {
+			continue
+		}
+
+		secretName := utils.GetProxyZoneName(
+						utils.GetProxyConfigName(h.directory.Name), zone)
+
+		err = r.Delete(h.ctx, &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      name,
+				Name:      secretName,
 				Namespace: h.directory.Namespace,
-				Labels:    labels,
-			},
-			Spec: corev1.ServiceSpec{
-				Type:     corev1.ServiceTypeClusterIP,
-				Selector: labels,
-				Ports:    []corev1.ServicePort{{
-					Name:       name,
-					Protocol:   corev1.ProtocolTCP,
-					Port:       port,
-					TargetPort: intstr.IntOrString{
-						Type:   intstr.Int,
-						IntVal: port,
-					},
-				}},
 			},
+		})
+
+		if err != nil && ! k8serrors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to delete the proxy configuration",
+				r.createLogParams(h, "Secret.Name", secretName)...)
+
+			return
 		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function will create the cluster service for the proxy if it
+ * does not already exist, or update the service if the port has changed.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) createProxyService(
+			h      *RequestHandle,
+			name   string,
+			port   int32,
+			labels map[string]string) (err error) {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "createProxyService",
+						"Name", name, "Port", port)...)
+
+	servicePorts := []corev1.ServicePort{{
+		Name:       name,
+		Protocol:   corev1.ProtocolTCP,
+		Port:       port,
+		TargetPort: intstr.IntOrString{
+			Type:   intstr.Int,
+			IntVal: port,
+		},
+	}}
 
-		ctrl.SetControllerReference(h.directory, service, r.Scheme)
+	/*
+	 * Check to see whether the service already exists.
+	 */
+
+	existing := &corev1.Service{}
+	err       = r.Get(h.ctx, 
+					types.NamespacedName{
+						Name:	   name,
+						Namespace: h.directory.Namespace}, existing)
+
+	if err == nil {
+		if len(existing.Spec.Ports) == 1 && 
+						existing.Spec.Ports[0].Port == port &&
+						reflect.DeepEqual(existing.Spec.Selector, labels) {
+			return
+		}
 
 		/*
-		 * Create the service.
+		 * The service already exists but the port has changed, so we need
+		 * to update the service.
 		 */
 
-		r.Log.Info("Creating a new service for the proxy", 
-				r.createLogParams(h, "Deployment.Name", name)...)
+		existing.Spec.Ports    = servicePorts
+		existing.Spec.Selector = labels
 
-		r.Log.V(1).Info("Proxy service details.", 
-				r.createLogParams(h, "Service", service)...)
+		r.Log.Info("Updating the service for the proxy", 
+				r.createLogParams(h, "Service.Name", name, "Port", port)...)
 
-		err := r.Create(h.ctx, service)
+		err = r.Update(h.ctx, existing)
 
 		if err != nil {
-			r.Log.Error(err, "Failed to create the service for the proxy",
-				r.createLogParams(h, "Deployment.Name", name)...)
-
-			return err
+			r.Log.Error(err, "Failed to update the service for the proxy",
+				r.createLogParams(h, "Service.Name", name)...)
 		}
+
+		return
+	}
+
+	if ! k8serrors.IsNotFound(err) {
+ 		r.Log.Error(err, "Failed to retrieve the service information",
+			r.createLogParams(h, "Service.Name", name)...)
+
+		return
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: h.directory.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: labels,
+			Ports:    servicePorts,
+		},
+	}
+
+	ctrl.SetControllerReference(h.directory, service, r.Scheme)
+
+	/*
+	 * Create the service.
+	 */
+
+	r.Log.Info("Creating a new service for the proxy", 
+			r.createLogParams(h, "Deployment.Name", name)...)
+
+	r.Log.V(1).Info("Proxy service details.", 
+			r.createLogParams(h, "Service", service)...)
+
+	err = r.Create(h.ctx, service)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to create the service for the proxy",
+			r.createLogParams(h, "Deployment.Name", name)...)
+
+		return
 	}
 
 	return
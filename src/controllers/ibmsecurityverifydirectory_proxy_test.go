@@ -0,0 +1,284 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the construction of the proxy
+ * configuration.
+ */
+
+/*****************************************************************************/
+
+import (
+	appsv1  "k8s.io/api/apps/v1"
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8syaml "sigs.k8s.io/yaml"
+
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("constructProxyYaml", func() {
+	const namespace = "default"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	BeforeEach(func() {
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace, []string{"replica-1", "replica-2"})
+	})
+
+	/*
+	 * The following function is used to construct the configuration from
+	 * the specified base configuration and parse the result back into a map.
+	 */
+
+	construct := func(base map[string]interface{},
+					zone string) (string, map[string]interface{}) {
+		yamlConfig, err := reconciler.constructProxyYaml(h, base, zone)
+
+		Expect(err).NotTo(HaveOccurred())
+
+		parsed := map[string]interface{}{}
+
+		Expect(k8syaml.Unmarshal([]byte(yamlConfig), &parsed)).To(Succeed())
+
+		return yamlConfig, parsed
+	}
+
+	DescribeTable("does not allow the values to alter the structure",
+		func(adminDn string, adminPwd string, suffix string) {
+			h.config.adminDn  = adminDn
+			h.config.adminPwd = adminPwd
+			h.config.suffixes = []string{suffix}
+
+			_, parsed := construct(map[string]interface{}{}, "")
+
+			Expect(parsed).To(HaveLen(1))
+
+			proxy := parsed["proxy"].(map[string]interface{})
+
+			Expect(proxy).To(HaveLen(2))
+
+			groups  := proxy["server-groups"].([]interface{})
+			servers := groups[0].(map[string]interface{})["servers"].([]interface{})
+
+			for _, server := range servers {
+				user := server.(map[string]interface{})["user"]
+
+				Expect(user).To(Equal(map[string]interface{}{
+					"dn":       adminDn,
+					"password": adminPwd,
+				}))
+			}
+
+			suffixes := proxy["suffixes"].([]interface{})
+
+			Expect(suffixes).To(HaveLen(1))
+			Expect(suffixes[0].(map[string]interface{})["base"]).To(
+							Equal(suffix))
+		},
+
+		Entry("plain values", "cn=root", "passw0rd", "o=sample"),
+		Entry("a password which contains a YAML document",
+				"cn=root", "x\nproxy:\n  injected: true", "o=sample"),
+		Entry("a password which contains YAML flow syntax",
+				"cn=root", "{injected: true}, [1, 2]", "o=sample"),
+		Entry("a DN which contains quotes and a comment",
+				"cn=\"root\" # comment", "'pwd'", "o=sample"),
+		Entry("a suffix which contains a new line and a colon",
+				"cn=root", "passw0rd", "o=sample\nsuffixes: []"),
+	)
+
+	It("retains the other entries of the base configuration", func() {
+		base := map[string]interface{}{
+			"general": map[string]interface{}{"key": "value"},
+			"proxy":   map[string]interface{}{"enabled": true},
+		}
+
+		_, parsed := construct(base, "")
+
+		Expect(parsed["general"]).To(Equal(
+						map[string]interface{}{"key": "value"}))
+		Expect(parsed["proxy"]).To(HaveKeyWithValue("enabled", true))
+	})
+
+	It("rejects a proxy entry which is not a map", func() {
+		_, err := reconciler.constructProxyYaml(h,
+						map[string]interface{}{"proxy": "value"}, "")
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("always produces the same configuration", func() {
+		h.directory.Spec.Replicas.Groups =
+					[]ibmv1.IBMSecurityVerifyDirectoryReplicaGroup{
+			{Name: "zone-b", PVCs: []string{"replica-2"}, Zone: "zone-b"},
+			{Name: "zone-a", PVCs: []string{"replica-1"}, Zone: "zone-a"},
+		}
+
+		h.config.suffixes = []string{"o=sample", "o=other", "c=us"}
+
+		newBase := func() map[string]interface{} {
+			return map[string]interface{}{
+				"zeta":  map[string]interface{}{"b": 1, "a": 2, "c": 3},
+				"alpha": []interface{}{"x", "y"},
+				"proxy": map[string]interface{}{"z": 1, "a": 2},
+			}
+		}
+
+		first, _ := construct(newBase(), "zone-a")
+
+		for i := 0; i < 20; i++ {
+			next, _ := construct(newBase(), "zone-a")
+
+			Expect(next).To(Equal(first))
+		}
+
+		/*
+		 * The suffixes and server groups retain the order of the document.
+		 */
+
+		_, parsed := construct(newBase(), "zone-a")
+
+		proxy    := parsed["proxy"].(map[string]interface{})
+		groups   := proxy["server-groups"].([]interface{})
+		suffixes := proxy["suffixes"].([]interface{})
+
+		Expect(groups[0]).To(HaveKeyWithValue("name", "zone-b"))
+		Expect(groups[0]).To(HaveKeyWithValue("preference",
+						float64(RemoteGroupPreference)))
+		Expect(groups[1]).To(HaveKeyWithValue("name", "zone-a"))
+		Expect(groups[1]).To(HaveKeyWithValue("preference",
+						float64(LocalGroupPreference)))
+
+		Expect(suffixes[0]).To(HaveKeyWithValue("base", "o=sample"))
+		Expect(suffixes[1]).To(HaveKeyWithValue("base", "o=other"))
+		Expect(suffixes[2]).To(HaveKeyWithValue("base", "c=us"))
+	})
+})
+
+/*****************************************************************************/
+
+var _ = Describe("deployProxy", func() {
+	const namespace = "default"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	/*
+	 * The following function is used to determine whether the named
+	 * object exists, and is not being deleted.
+	 */
+
+	exists := func(name string, obj client.Object) bool {
+		err := k8sClient.Get(context.Background(), types.NamespacedName{
+						Name: name, Namespace: namespace}, obj)
+
+		if k8serrors.IsNotFound(err) {
+			return false
+		}
+
+		Expect(err).NotTo(HaveOccurred())
+
+		return obj.GetDeletionTimestamp() == nil
+	}
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace,
+				[]string{"replica-1", "replica-2"})
+
+		createTestDocument(h.directory)
+
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "isvd-proxy", Namespace: namespace},
+			Data: map[string]string{ConfigMapKey: "general: {}\n"},
+		}
+
+		Expect(k8sClient.Create(context.Background(), configMap)).To(
+						Succeed())
+
+		DeferCleanup(func() {
+			ctx := context.Background()
+
+			k8sClient.Delete(ctx, configMap)
+
+			for _, name := range []string{"isvd-proxy", "isvd-proxy-zone-a",
+						"isvd-proxy-zone-b"} {
+				objMeta := metav1.ObjectMeta{Name: name, Namespace: namespace}
+
+				k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: objMeta})
+				k8sClient.Delete(ctx, &corev1.Secret{ObjectMeta: objMeta})
+				k8sClient.Delete(ctx, &corev1.Service{ObjectMeta: objMeta})
+			}
+		})
+	})
+
+	It("replaces the proxy without a zone with the proxy of each zone", func() {
+		Expect(reconciler.deployProxy(h)).To(Succeed())
+
+		name := utils.GetProxyDeploymentName("isvd")
+
+		Expect(exists(name, &appsv1.Deployment{})).To(BeTrue())
+
+		secret := &corev1.Secret{}
+
+		Expect(exists(utils.GetProxyConfigName("isvd"), secret)).To(BeTrue())
+
+		/*
+		 * Once the replica groups are placed in zones the proxy without a
+		 * zone is deleted, and its configuration is no longer updated.
+		 */
+
+		h.directory.Spec.Replicas.Groups =
+					[]ibmv1.IBMSecurityVerifyDirectoryReplicaGroup{
+			{Name: "zone-a", PVCs: []string{"replica-1"}, Zone: "zone-a"},
+			{Name: "zone-b", PVCs: []string{"replica-2"}, Zone: "zone-b"},
+		}
+
+		Expect(reconciler.deployProxy(h)).To(Succeed())
+
+		Expect(exists(name, &appsv1.Deployment{})).To(BeFalse())
+		Expect(exists(utils.GetProxyZoneName(name, "zone-a"),
+						&appsv1.Deployment{})).To(BeTrue())
+		Expect(exists(utils.GetProxyZoneName(name, "zone-b"),
+						&appsv1.Deployment{})).To(BeTrue())
+
+		unchanged := &corev1.Secret{}
+
+		Expect(exists(utils.GetProxyConfigName("isvd"), unchanged)).To(
+						BeTrue())
+		Expect(unchanged.ResourceVersion).To(Equal(secret.ResourceVersion))
+	})
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,331 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * bootstrap a new deployment from an existing backup.  The principal is
+ * first created, so that the directory instance is created within its PVC,
+ * and is then stopped while the backup is imported into the instance by a
+ * job.  The other replicas are then seeded from the principal in the usual
+ * way.
+ */
+
+/*****************************************************************************/
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"fmt"
+	"path"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	ctrl  "sigs.k8s.io/controller-runtime"
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The directory at which the backup is mounted within the restore job, and
+ * the command which is used to import each of the LDIF files of the backup.
+ */
+
+const RestoreMountPath     = "/var/isvd/restore"
+const RestoreImportCommand = "idsldif2db"
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the RestoringPrincipal phase of
+ * the workflow.  The principal, which has been created with an empty 
+ * directory instance, is stopped and the restore job is then started, if it
+ * hasn't already been started.  Once the job has completed the time of the
+ * restore is saved in the status before the job is deleted, so that the 
+ * backup is never restored a second time, and we move back to the creation
+ * of the principal.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) restorePrincipal(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	principal := h.directory.Status.Principal
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "restorePrincipal",
+						"Principal", principal)...)
+
+	/*
+	 * If the document no longer contains a restore section, or the backup
+	 * has already been restored, we simply start the principal.
+	 */
+
+	if h.directory.Spec.Restore == nil || 
+				h.directory.Status.RestoreTime != nil {
+		return ibmv1.PhaseCreatingPrincipal, nil
+	}
+
+	/*
+	 * The principal must be stopped before the backup can be imported into
+	 * its PVC.
+	 */
+
+	err := r.deleteReplica(h, principal)
+
+	if err != nil {
+		return "", err
+	}
+
+	stopped, err := r.isReplicaStopped(h, principal)
+
+	if err != nil || !stopped {
+		return ibmv1.PhaseRestoringPrincipal, err
+	}
+
+	err = r.restoreReplica(h, principal)
+
+	if err != nil {
+		return "", err
+	}
+
+	jobName := r.getRestoreJobName(h.directory, principal)
+
+	complete, err := r.isJobComplete(h, jobName)
+
+	if err != nil {
+		r.recordWarning(h, EventRestoreFailed,
+			"The restore of the backup, %s, into the principal, %s, " +
+			"failed: %s", h.directory.Spec.Restore.Path, principal,
+			err.Error())
+
+		return "", err
+	}
+
+	if !complete {
+		return ibmv1.PhaseRestoringPrincipal, nil
+	}
+
+	r.Log.Info("The backup has been restored into the principal",
+			r.createLogParams(h, "Principal", principal,
+				"Restore.PVC", h.directory.Spec.Restore.PVC,
+				"Restore.Path", h.directory.Spec.Restore.Path)...)
+
+	now := metav1.Now()
+
+	h.directory.Status.RestoreTime = &now
+
+	if err := r.Status().Update(h.ctx, h.directory); err != nil {
+		r.Log.Error(err, "Failed to update the restore time for the resource",
+					r.createLogParams(h, "Principal", principal)...)
+
+		return "", err
+	}
+
+	r.recordEvent(h, EventRestoreSucceeded,
+			"The backup, %s, has been restored into the principal, %s.",
+			h.directory.Spec.Restore.Path, principal)
+
+	err = r.deleteJob(h, jobName)
+
+	if err != nil {
+		return "", err
+	}
+
+	return ibmv1.PhaseCreatingPrincipal, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create the job which restores the
+ * backup into the PVC of the specified replica.  The job will only be
+ * created if it doesn't already exist.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) restoreReplica(
+			h       *RequestHandle,
+			pvcName string) (err error) {
+
+	r.Log.V(1).Info("Entering a function",
+			r.createLogParams(h, "Function", "restoreReplica",
+				"PVC", pvcName)...)
+
+	restore := h.directory.Spec.Restore
+	jobName := r.getRestoreJobName(h.directory, pvcName)
+
+	imageName := fmt.Sprintf("%s/verify-directory-server:%s",
+					h.directory.Spec.Pods.Image.Repo,
+					h.directory.Spec.Pods.Image.Label)
+
+	/*
+	 * The volume configuration.  The server configuration is mounted, as it
+	 * is in the pod of the replica, so that the data is imported into the
+	 * directory instance which was created within the PVC when the principal
+	 * was first started.
+	 */
+
+	volumes := []corev1.Volume{
+		{
+			Name: "isvd-server-config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: h.directory.Spec.Pods.ConfigMap.Server.Name,
+					},
+					Items: []corev1.KeyToPath{{
+						Key:  h.directory.Spec.Pods.ConfigMap.Server.Key,
+						Path: ConfigMapKey,
+					}},
+				},
+			},
+		},
+		{
+			Name: "isvd-data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvcName,
+					ReadOnly:  false,
+				},
+			},
+		},
+		{
+			Name: "isvd-restore",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: restore.PVC,
+					ReadOnly:  true,
+				},
+			},
+		},
+	}
+
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "isvd-server-config",
+			MountPath: "/var/isvd/config",
+		},
+		{
+			Name:      "isvd-data",
+			MountPath: "/var/isvd/data",
+		},
+		{
+			Name:      "isvd-restore",
+			MountPath: RestoreMountPath,
+			SubPath:   path.Clean(restore.Path),
+			ReadOnly:  true,
+		},
+	}
+
+	/*
+	 * Set up the environment variables.
+	 */
+
+	env := append(append([]corev1.EnvVar{}, h.directory.Spec.Pods.Env...),
+		corev1.EnvVar{
+			Name:  "general.license.accept",
+			Value: "limited",
+		},
+		corev1.EnvVar{
+			Name:  "general.license.key",
+			Value: h.config.licenseKey,
+		},
+		corev1.EnvVar{
+			Name:  "YAML_CONFIG_FILE",
+			Value: fmt.Sprintf("/var/isvd/config/%s", ConfigMapKey),
+		},
+	)
+
+	/*
+	 * The job fails if the backup does not contain any LDIF files.
+	 */
+
+	script := fmt.Sprintf("set -e\n" +
+			"ls %[1]s/*.ldif > /dev/null\n" +
+			"for file in %[1]s/*.ldif; do %[2]s -i \"$file\"; done",
+			RestoreMountPath, RestoreImportCommand)
+
+	/*
+	 * Create the job.  The job is deleted by the workflow once it has
+	 * completed.
+	 */
+
+	var completions  int32 = 1
+	var backOffLimit int32 = 1
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: h.directory.Namespace,
+			Labels:    utils.LabelsForApp(h.directory.Name, pvcName),
+		},
+		Spec: batchv1.JobSpec{
+			Completions:  &completions,
+			BackoffLimit: &backOffLimit,
+			Template:     corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes:            volumes,
+					ImagePullSecrets:   h.directory.Spec.Pods.Image.ImagePullSecrets,
+					ServiceAccountName: h.directory.Spec.Pods.ServiceAccountName,
+					SecurityContext:    h.directory.Spec.Pods.SecurityContext,
+					Affinity:           r.getZoneAffinity(
+							h.directory.Spec.GetReplicaZone(pvcName)),
+					RestartPolicy:      corev1.RestartPolicyNever,
+					Containers:         []corev1.Container{{
+						Command:         []string{"sh", "-c", script},
+						Env:             env,
+						EnvFrom:         h.directory.Spec.Pods.EnvFrom,
+						Image:           imageName,
+						Name:            jobName,
+						ImagePullPolicy: h.directory.Spec.Pods.Image.ImagePullPolicy,
+						VolumeMounts:    volumeMounts,
+					}},
+				},
+			},
+		},
+	}
+
+	ctrl.SetControllerReference(h.directory, job, r.Scheme)
+
+	r.Log.V(1).Info("Creating a new restore job",
+						r.createLogParams(h, "Job.Name", job.Name)...)
+
+	r.Log.V(1).Info("Restore job details",
+				r.createLogParams(h, "Details", job)...)
+
+	err = r.Create(h.ctx, job)
+
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			r.Log.V(1).Info("The restore job already exists",
+						r.createLogParams(h, "Job.Name", job.Name)...)
+
+			err = nil
+		} else {
+			r.Log.Error(err, "Failed to create the new job",
+						r.createLogParams(h, "Job.Name", job.Name)...)
+		}
+
+		return
+	}
+
+	r.Log.Info("Created a new restore job",
+						r.createLogParams(h, "Job.Name", job.Name)...)
+
+	r.recordEvent(h, EventRestoreStarted,
+				"The restore job, %s, for the replica, %s, has been started.",
+				job.Name, pvcName)
+
+	return
+}
+
+/*****************************************************************************/
+
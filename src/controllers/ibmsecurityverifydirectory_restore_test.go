@@ -0,0 +1,138 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the restore of a new deployment from an
+ * existing backup.
+ */
+
+/*****************************************************************************/
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("restorePrincipal", func() {
+	const namespace = "default"
+	const jobName   = "isvd-replica-1-restore"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace,
+				[]string{"replica-1", "replica-2"})
+
+		h.directory.Spec.Restore = &ibmv1.IBMSecurityVerifyDirectoryRestore{
+			PVC:  "backup-pvc",
+			Path: "isvd/20260101020000/",
+		}
+
+		createTestDocument(h.directory)
+
+		h.directory.Status.Principal = "replica-1"
+	})
+
+	AfterEach(func() {
+		k8sClient.Delete(context.Background(), &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: namespace},
+		})
+	})
+
+	It("restores the backup into the principal", func() {
+		phase, err := reconciler.restorePrincipal(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseRestoringPrincipal))
+
+		job := &batchv1.Job{}
+
+		Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Name: jobName, Namespace: namespace}, job)).To(Succeed())
+
+		pod := job.Spec.Template.Spec
+
+		Expect(pod.Volumes[1].PersistentVolumeClaim.ClaimName).To(
+						Equal("replica-1"))
+		Expect(pod.Volumes[2].PersistentVolumeClaim.ClaimName).To(
+						Equal("backup-pvc"))
+		Expect(pod.Containers[0].VolumeMounts[2].SubPath).To(
+						Equal("isvd/20260101020000"))
+		Expect(pod.Containers[0].Command).To(Equal([]string{"sh", "-c",
+			"set -e\n" +
+			"ls /var/isvd/restore/*.ldif > /dev/null\n" +
+			"for file in /var/isvd/restore/*.ldif; " +
+				"do idsldif2db -i \"$file\"; done",
+		}))
+		Expect(job.Spec.TTLSecondsAfterFinished).To(BeNil())
+
+		/*
+		 * Once the job has completed the restore is recorded, the job is
+		 * deleted and we move back to the creation of the principal.
+		 */
+
+		job.Status.Succeeded  = 1
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:   batchv1.JobComplete,
+			Status: corev1.ConditionTrue,
+		}}
+
+		Expect(k8sClient.Status().Update(
+						context.Background(), job)).To(Succeed())
+
+		phase, err = reconciler.restorePrincipal(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseCreatingPrincipal))
+		Expect(h.directory.Status.RestoreTime).NotTo(BeNil())
+
+		Eventually(func() bool {
+			err := k8sClient.Get(context.Background(), types.NamespacedName{
+					Name: jobName, Namespace: namespace}, job)
+
+			return k8serrors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		/*
+		 * The backup is never restored a second time.
+		 */
+
+		phase, err = reconciler.restorePrincipal(h)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ibmv1.PhaseCreatingPrincipal))
+
+		err = k8sClient.Get(context.Background(), types.NamespacedName{
+				Name: jobName, Namespace: namespace}, job)
+
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,220 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * maintain the observed state of the deployment within the status of the
+ * document.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"fmt"
+	"reflect"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to refresh the observed state of the
+ * replicas and the proxy within the status of the document.  The status is
+ * not saved by this function, and so it is up to the caller to save the
+ * status.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) refreshStatus(
+			h *RequestHandle) error {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "refreshStatus")...)
+
+	/*
+	 * Index the existing replica entries so that we can retain the
+	 * information which is not observed directly (e.g. the last agreement
+	 * time).
+	 */
+
+	previous := make(map[string]ibmv1.IBMSecurityVerifyDirectoryReplicaStatus)
+
+	for _, entry := range h.directory.Status.Replicas {
+		previous[entry.PVC] = entry
+	}
+
+	/*
+	 * Work out the state of each replica in the document.
+	 */
+
+	var replicas []ibmv1.IBMSecurityVerifyDirectoryReplicaStatus
+	var ready    int32
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		entry := ibmv1.IBMSecurityVerifyDirectoryReplicaStatus{
+			PVC:               pvcName,
+			ServiceName:       r.getReplicaPodName(h.directory, pvcName),
+			Role:              ibmv1.ReplicaRolePeer,
+			LastAgreementTime: previous[pvcName].LastAgreementTime,
+			Agreements:        previous[pvcName].Agreements,
+		}
+
+		if pvcName == h.directory.Status.Principal {
+			entry.Role = ibmv1.ReplicaRolePrincipal
+		}
+
+		pods, err := r.getReplicaPods(h, pvcName)
+
+		if err != nil {
+			return err
+		}
+
+		for _, pod := range pods {
+			if pod.ObjectMeta.DeletionTimestamp != nil {
+				continue
+			}
+
+			entry.PodName = pod.Name
+			entry.Ready   = pod.Status.Phase == corev1.PodRunning &&
+							len(pod.Status.ContainerStatuses) > 0 &&
+							pod.Status.ContainerStatuses[0].Ready
+
+			if entry.Ready {
+				ready++
+
+				break
+			}
+		}
+
+		replicas = append(replicas, entry)
+	}
+
+	h.directory.Status.Replicas      = replicas
+	h.directory.Status.ReadyReplicas = ready
+	h.directory.Status.Port          = h.config.port
+	h.directory.Status.Secure        = h.config.secure
+
+	replicaCount.WithLabelValues(
+				h.directory.Namespace, h.directory.Name).Set(
+						float64(len(replicas)))
+	readyReplicaCount.WithLabelValues(
+				h.directory.Namespace, h.directory.Name).Set(float64(ready))
+
+	/*
+	 * Work out the endpoint of the proxy from the proxy service.
+	 */
+
+	name    := utils.GetProxyDeploymentName(h.directory.Name)
+	service := &corev1.Service{}
+
+	err := r.Get(h.ctx,
+				types.NamespacedName{
+					Name:      name,
+					Namespace: h.directory.Namespace}, service)
+
+	if err != nil {
+		if ! k8serrors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to retrieve the service for the proxy",
+					r.createLogParams(h, "Service.Name", name)...)
+
+			return err
+		}
+
+		h.directory.Status.ProxyEndpoint = ""
+	} else if len(service.Spec.Ports) > 0 {
+		h.directory.Status.ProxyEndpoint = fmt.Sprintf("%s.%s.svc:%d",
+				name, h.directory.Namespace, service.Spec.Ports[0].Port)
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to refresh the observed state within the
+ * status of the document, saving the status if it has changed from the 
+ * specified original status.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) saveStatus(
+			h        *RequestHandle,
+			original *ibmv1.IBMSecurityVerifyDirectoryStatus) error {
+
+	if err := r.refreshStatus(h); err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(original, &h.directory.Status) {
+		return nil
+	}
+
+	if err := r.Status().Update(h.ctx, h.directory); err != nil {
+		r.Log.Error(err, "Failed to update the status for the resource",
+						r.createLogParams(h)...)
+
+		return err
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the status entry for the 
+ * specified replica, adding a new entry if one doesn't already exist.  The
+ * returned entry is only valid until the next entry is added.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getReplicaStatus(
+			h       *RequestHandle,
+			pvcName string) *ibmv1.IBMSecurityVerifyDirectoryReplicaStatus {
+
+	for idx := range h.directory.Status.Replicas {
+		if h.directory.Status.Replicas[idx].PVC == pvcName {
+			return &h.directory.Status.Replicas[idx]
+		}
+	}
+
+	h.directory.Status.Replicas = append(h.directory.Status.Replicas,
+		ibmv1.IBMSecurityVerifyDirectoryReplicaStatus{
+			PVC: pvcName,
+		})
+
+	return &h.directory.Status.Replicas[len(h.directory.Status.Replicas)-1]
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to record the time at which the
+ * replication agreements for the specified replica were set up.  The status
+ * is not saved by this function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) setAgreementTime(
+			h       *RequestHandle,
+			pvcName string) {
+
+	now := metav1.Now()
+
+	r.getReplicaStatus(h, pvcName).LastAgreementTime = &now
+}
+
+/*****************************************************************************/
+
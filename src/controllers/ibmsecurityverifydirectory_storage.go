@@ -0,0 +1,464 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * manage the PVCs which are created by the operator, from the volume claim
+ * template, when a count of replicas is specified in the document.  The
+ * retention policy of the document determines whether these PVCs are
+ * deleted along with the document, which is achieved by making the document
+ * the owner of the PVCs, and whether the PVC of a replica is deleted when
+ * the replica is removed.  The seed volumes, which hold the backup that is
+ * used when seeding replicas in the Online mode, are also managed here.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	ctrl  "sigs.k8s.io/controller-runtime"
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create each of the PVCs of the replicas
+ * which is to be created by the operator but does not yet exist.  The
+ * ownership of the existing PVCs is also updated to match the current
+ * retention policy.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deployReplicaPVCs(
+			h *RequestHandle) error {
+
+	if h.directory.Spec.Replicas.Count == 0 {
+		return nil
+	}
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "deployReplicaPVCs")...)
+
+	owned := h.directory.Spec.GetPVCRetentionPolicy().WhenDeleted ==
+						ibmv1.PVCRetentionPolicyDelete
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		pvc := &corev1.PersistentVolumeClaim{}
+
+		err := r.Get(h.ctx, types.NamespacedName{
+						Name:      pvcName,
+						Namespace: h.directory.Namespace}, pvc)
+
+		if err == nil {
+			err = r.updatePVCOwnership(h, pvc, owned)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !errors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to retrieve the PVC",
+						r.createLogParams(h, "PVC.Name", pvcName)...)
+
+			return err
+		}
+
+		pvc = r.constructReplicaPVC(h, pvcName)
+
+		if owned {
+			ctrl.SetControllerReference(h.directory, pvc, r.Scheme)
+		}
+
+		r.Log.Info("Creating a new PVC",
+						r.createLogParams(h, "PVC.Name", pvcName)...)
+
+		err = r.Create(h.ctx, pvc)
+
+		if err != nil {
+			r.Log.Error(err, "Failed to create the new PVC",
+						r.createLogParams(h, "PVC.Name", pvcName)...)
+
+			return err
+		}
+
+		r.recordEvent(h, EventPVCCreated,
+					"The PVC, %s, has been created.", pvcName)
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to construct a PVC from the volume claim
+ * template of the document.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) constructReplicaPVC(
+			h       *RequestHandle,
+			pvcName string) *corev1.PersistentVolumeClaim {
+
+	template    := h.directory.Spec.Replicas.VolumeClaimTemplate
+	accessModes := template.AccessModes
+
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{
+			corev1.ReadWriteOnce,
+		}
+	}
+
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcName,
+			Namespace: h.directory.Namespace,
+			Labels:    utils.LabelsForApp(h.directory.Name, pvcName),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      accessModes,
+			StorageClassName: template.StorageClassName,
+			Resources:        corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage:
+							h.directory.Spec.GetVolumeClaimSize(),
+				},
+			},
+		},
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to make the document the owner of a PVC
+ * which was created by the operator, or to remove the ownership, so that
+ * the PVC is only garbage collected along with the document if the
+ * retention policy requires it.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) updatePVCOwnership(
+			h     *RequestHandle,
+			pvc   *corev1.PersistentVolumeClaim,
+			owned bool) error {
+
+	if ! r.isManagedPVC(h, pvc) {
+		return nil
+	}
+
+	var references []metav1.OwnerReference
+
+	for _, reference := range pvc.OwnerReferences {
+		if reference.UID != h.directory.UID {
+			references = append(references, reference)
+		}
+	}
+
+	isOwned := len(references) != len(pvc.OwnerReferences)
+
+	if isOwned == owned {
+		return nil
+	}
+
+	pvc.OwnerReferences = references
+
+	if owned {
+		ctrl.SetControllerReference(h.directory, pvc, r.Scheme)
+	}
+
+	r.Log.Info("Updating the ownership of the PVC",
+				r.createLogParams(h, "PVC.Name", pvc.Name, "Owned", owned)...)
+
+	err := r.Update(h.ctx, pvc)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to update the PVC",
+					r.createLogParams(h, "PVC.Name", pvc.Name)...)
+	}
+
+	return err
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to delete the PVC of a replica which has
+ * been removed, if the PVC was created by the operator and the retention
+ * policy does not require the PVC to be retained.  It is not an error if
+ * the PVC does not exist.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteReplicaPVC(
+			h       *RequestHandle,
+			pvcName string) error {
+
+	if ! h.directory.IsManagedPVC(pvcName) ||
+			h.directory.Spec.GetPVCRetentionPolicy().WhenScaled !=
+							ibmv1.PVCRetentionPolicyDelete {
+		return nil
+	}
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "deleteReplicaPVC",
+						"PVC.Name", pvcName)...)
+
+	pvc := &corev1.PersistentVolumeClaim{}
+
+	err := r.Get(h.ctx, types.NamespacedName{
+					Name:      pvcName,
+					Namespace: h.directory.Namespace}, pvc)
+
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if ! r.isManagedPVC(h, pvc) {
+		return nil
+	}
+
+	r.Log.Info("Deleting the PVC",
+				r.createLogParams(h, "PVC.Name", pvcName)...)
+
+	err = r.Delete(h.ctx, pvc)
+
+	if err != nil && !errors.IsNotFound(err) {
+		r.Log.Error(err, "Failed to delete the PVC",
+					r.createLogParams(h, "PVC.Name", pvcName)...)
+
+		return err
+	}
+
+	r.recordEvent(h, EventPVCDeleted,
+				"The PVC, %s, has been deleted.", pvcName)
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the specified PVC was
+ * created by the operator for this document.  A PVC which has been
+ * pre-created with one of the generated names is never modified or deleted
+ * by the operator.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isManagedPVC(
+			h   *RequestHandle,
+			pvc *corev1.PersistentVolumeClaim) bool {
+
+	for key, value := range utils.LabelsForApp(h.directory.Name, pvc.Name) {
+		if pvc.Labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*****************************************************************************/
+
+
+/*
+ * The following function is used to generate the name of the seed volume of
+ * the specified replica.  The seed volume is used to hold the backup which
+ * is taken from the replica when seeding other replicas in the Online mode.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getSeedPVCName(
+			pvcName string) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s", pvcName, SeedPVCSuffix))
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to create the seed volume of each of the
+ * replicas, in the Online seed mode, if it does not yet exist.  The seed
+ * volumes are always owned by the document.  In the Offline seed mode any
+ * seed volumes which were previously created are deleted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deploySeedPVCs(
+			h *RequestHandle) error {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "deploySeedPVCs")...)
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		if h.directory.Spec.Replicas.SeedMode != ibmv1.SeedModeOnline {
+			err := r.deleteSeedPVC(h, pvcName)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		seedPvcName := r.getSeedPVCName(pvcName)
+
+		pvc := &corev1.PersistentVolumeClaim{}
+
+		err := r.Get(h.ctx, types.NamespacedName{
+						Name:      seedPvcName,
+						Namespace: h.directory.Namespace}, pvc)
+
+		if err == nil {
+			continue
+		}
+
+		if !errors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to retrieve the PVC",
+						r.createLogParams(h, "PVC.Name", seedPvcName)...)
+
+			return err
+		}
+
+		/*
+		 * The seed volume is created with the same storage class, access
+		 * modes and size as the data volume of the replica, so that it is
+		 * able to hold a backup of all of the data of the replica.
+		 */
+
+		dataPvc := &corev1.PersistentVolumeClaim{}
+
+		err = r.Get(h.ctx, types.NamespacedName{
+						Name:      pvcName,
+						Namespace: h.directory.Namespace}, dataPvc)
+
+		if err != nil {
+			r.Log.Error(err, "Failed to retrieve the PVC",
+						r.createLogParams(h, "PVC.Name", pvcName)...)
+
+			return err
+		}
+
+		pvc = r.constructSeedPVC(h, dataPvc)
+
+		ctrl.SetControllerReference(h.directory, pvc, r.Scheme)
+
+		r.Log.Info("Creating a new PVC",
+						r.createLogParams(h, "PVC.Name", seedPvcName)...)
+
+		err = r.Create(h.ctx, pvc)
+
+		if err != nil {
+			r.Log.Error(err, "Failed to create the new PVC",
+						r.createLogParams(h, "PVC.Name", seedPvcName)...)
+
+			return err
+		}
+
+		r.recordEvent(h, EventPVCCreated,
+					"The PVC, %s, has been created.", seedPvcName)
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to construct the seed volume of a replica
+ * from the data volume of the replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) constructSeedPVC(
+			h       *RequestHandle,
+			dataPvc *corev1.PersistentVolumeClaim) *corev1.PersistentVolumeClaim {
+
+	seedPvcName := r.getSeedPVCName(dataPvc.Name)
+
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      seedPvcName,
+			Namespace: h.directory.Namespace,
+			Labels:    utils.LabelsForApp(h.directory.Name, seedPvcName),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      dataPvc.Spec.AccessModes,
+			StorageClassName: dataPvc.Spec.StorageClassName,
+			Resources:        corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage:
+							*dataPvc.Spec.Resources.Requests.Storage(),
+				},
+			},
+		},
+	}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to delete the seed volume of a replica.
+ * It is not an error if the seed volume does not exist, and a PVC which
+ * has been pre-created with the name of the seed volume is never deleted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteSeedPVC(
+			h       *RequestHandle,
+			pvcName string) error {
+
+	seedPvcName := r.getSeedPVCName(pvcName)
+
+	pvc := &corev1.PersistentVolumeClaim{}
+
+	err := r.Get(h.ctx, types.NamespacedName{
+					Name:      seedPvcName,
+					Namespace: h.directory.Namespace}, pvc)
+
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if ! r.isManagedPVC(h, pvc) || pvc.DeletionTimestamp != nil {
+		return nil
+	}
+
+	r.Log.Info("Deleting the PVC",
+				r.createLogParams(h, "PVC.Name", seedPvcName)...)
+
+	err = r.Delete(h.ctx, pvc)
+
+	if err != nil && !errors.IsNotFound(err) {
+		r.Log.Error(err, "Failed to delete the PVC",
+					r.createLogParams(h, "PVC.Name", seedPvcName)...)
+
+		return err
+	}
+
+	r.recordEvent(h, EventPVCDeleted,
+				"The PVC, %s, has been deleted.", seedPvcName)
+
+	return nil
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,182 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the management of the PVCs which are
+ * created by the operator.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("deployReplicaPVCs", func() {
+	const namespace = "default"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+
+	getPVC := func(name string) (*corev1.PersistentVolumeClaim, error) {
+		pvc := &corev1.PersistentVolumeClaim{}
+
+		err := k8sClient.Get(context.Background(), types.NamespacedName{
+						Name: name, Namespace: namespace}, pvc)
+
+		return pvc, err
+	}
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		h = newTestHandle("managed", namespace, nil)
+
+		h.directory.Spec.Replicas.Count               = 2
+		h.directory.Spec.Replicas.VolumeClaimTemplate =
+				&ibmv1.IBMSecurityVerifyDirectoryVolumeClaimTemplate{
+					Size: resource.MustParse("1Gi"),
+				}
+		h.directory.Spec.Replicas.PVCRetentionPolicy  =
+				&ibmv1.IBMSecurityVerifyDirectoryPVCRetentionPolicy{
+					WhenDeleted: ibmv1.PVCRetentionPolicyDelete,
+					WhenScaled:  ibmv1.PVCRetentionPolicyDelete,
+				}
+
+		createTestDocument(h.directory)
+
+		h.directory.ResolveReplicaPVCs()
+	})
+
+	AfterEach(func() {
+		for _, pvcName := range []string{
+						"managed-replica-1", "managed-replica-2",
+						"managed-replica-1-seed", "managed-replica-2-seed"} {
+			k8sClient.Delete(context.Background(),
+				&corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: pvcName, Namespace: namespace},
+				})
+		}
+	})
+
+	It("creates the PVCs from the template", func() {
+		Expect(h.directory.Spec.Replicas.PVCs).To(Equal(
+					[]string{"managed-replica-1", "managed-replica-2"}))
+
+		Expect(reconciler.deployReplicaPVCs(h)).To(Succeed())
+
+		pvc, err := getPVC("managed-replica-2")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pvc.Spec.AccessModes).To(Equal(
+				[]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}))
+		Expect(pvc.Spec.Resources.Requests.Storage().String()).To(
+				Equal("1Gi"))
+		Expect(pvc.OwnerReferences).To(HaveLen(1))
+
+		/*
+		 * The ownership is removed if the PVCs are to be retained when the
+		 * document is deleted.
+		 */
+
+		h.directory.Spec.Replicas.PVCRetentionPolicy.WhenDeleted =
+						ibmv1.PVCRetentionPolicyRetain
+
+		Expect(reconciler.deployReplicaPVCs(h)).To(Succeed())
+
+		pvc, err = getPVC("managed-replica-2")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pvc.OwnerReferences).To(BeEmpty())
+	})
+
+	It("creates the seed volumes in the Online seed mode", func() {
+		Expect(reconciler.deployReplicaPVCs(h)).To(Succeed())
+		Expect(reconciler.deploySeedPVCs(h)).To(Succeed())
+
+		_, err := getPVC("managed-replica-2-seed")
+
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		h.directory.Spec.Replicas.SeedMode = ibmv1.SeedModeOnline
+
+		Expect(reconciler.deploySeedPVCs(h)).To(Succeed())
+
+		pvc, err := getPVC("managed-replica-2-seed")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pvc.Spec.AccessModes).To(Equal(
+				[]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}))
+		Expect(pvc.Spec.Resources.Requests.Storage().String()).To(
+				Equal("1Gi"))
+		Expect(pvc.OwnerReferences).To(HaveLen(1))
+
+		/*
+		 * The seed volumes are deleted when the Offline seed mode is
+		 * selected.
+		 */
+
+		h.directory.Spec.Replicas.SeedMode = ibmv1.SeedModeOffline
+
+		Expect(reconciler.deploySeedPVCs(h)).To(Succeed())
+
+		pvc, err = getPVC("managed-replica-2-seed")
+
+		if err == nil {
+			Expect(pvc.DeletionTimestamp).NotTo(BeNil())
+		}
+	})
+
+	It("deletes the PVC of a removed replica", func() {
+		Expect(reconciler.deployReplicaPVCs(h)).To(Succeed())
+
+		h.directory.Spec.Replicas.PVCRetentionPolicy.WhenScaled =
+						ibmv1.PVCRetentionPolicyRetain
+
+		Expect(reconciler.deleteReplicaPVC(h, "managed-replica-2")).To(
+						Succeed())
+
+		_, err := getPVC("managed-replica-2")
+
+		Expect(err).NotTo(HaveOccurred())
+
+		h.directory.Spec.Replicas.PVCRetentionPolicy.WhenScaled =
+						ibmv1.PVCRetentionPolicyDelete
+
+		Expect(reconciler.deleteReplicaPVC(h, "managed-replica-2")).To(
+						Succeed())
+
+		pvc, err := getPVC("managed-replica-2")
+
+		if err == nil {
+			Expect(pvc.DeletionTimestamp).NotTo(BeNil())
+		}
+	})
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,333 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * validate, and repair, the replication topology of the deployment.  The
+ * replicas are deployed in a full-mesh topology, and so each replica should
+ * have a replication agreement, for each suffix, to every other replica of
+ * its replication domain.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The name of the condition which reports whether the replication agreements
+ * match the full-mesh topology.
+ */
+
+const TopologyConsistentCondition = "TopologyConsistent"
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to compare the replication agreements of
+ * each replica against the full-mesh topology which is required by the
+ * document.  Any missing agreement is created, and any stale agreement is
+ * removed.  The drift is reported in the status of the document, and the
+ * TopologyConsistent condition is set.  The status is not saved by this
+ * function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) checkTopology(
+				h *RequestHandle) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "checkTopology")...)
+
+	var drift    []ibmv1.IBMSecurityVerifyDirectoryAgreementDrift
+	var problems []string
+
+	pvcs := h.directory.Spec.Replicas.PVCs
+
+	/*
+	 * Work out which of the replicas are currently available.  We can only
+	 * query, or create an agreement to, a replica which is running.
+	 */
+
+	available := make(map[string]bool)
+
+	for _, pvcName := range pvcs {
+		healthy, err := r.isReplicaHealthy(h, pvcName)
+
+		available[pvcName] = err == nil && healthy
+	}
+
+	for _, supplier := range pvcs {
+		if !available[supplier] {
+			problems = append(problems, fmt.Sprintf("The topology of the " +
+				"replica, %s, could not be checked as the replica is not " +
+				"available.", supplier))
+
+			continue
+		}
+
+		agreements, err := r.getReplicationAgreements(h, supplier)
+
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Failed to retrieve the " +
+				"replication agreements of the replica, %s: %s",
+				supplier, err.Error()))
+
+			continue
+		}
+
+		/*
+		 * The supplier should only have agreements with the other replicas
+		 * of its replication domain.
+		 */
+
+		domain    := h.directory.Spec.GetReplicationDomain(supplier)
+		principal := r.getDomainPrincipal(h, supplier)
+
+		/*
+		 * Index the existing agreements on the consumer and suffix.
+		 */
+
+		existing := make(map[string]map[string]bool)
+
+		for _, agreement := range agreements {
+			if existing[agreement.Consumer] == nil {
+				existing[agreement.Consumer] = make(map[string]bool)
+			}
+
+			existing[agreement.Consumer][agreement.Suffix] = true
+		}
+
+		/*
+		 * Add any missing agreements.  The agreement is recreated for all
+		 * suffixes if any of the suffixes is missing.
+		 */
+
+		for _, consumer := range domain {
+			if consumer == supplier {
+				continue
+			}
+
+			var missing []string
+
+			for _, suffix := range h.config.suffixes {
+				if !existing[consumer][suffix] {
+					missing = append(missing, suffix)
+				}
+			}
+
+			if len(missing) == 0 {
+				continue
+			}
+
+			repaired := false
+
+			if !available[consumer] {
+				problems = append(problems, fmt.Sprintf("The replication " +
+					"agreement from %s to %s is missing and cannot be " +
+					"repaired as the consumer is not available.",
+					supplier, consumer))
+			} else {
+				err = r.createReplicationAgreement(
+							h, principal, supplier, consumer)
+
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("Failed to " +
+						"repair the replication agreement from %s to %s: %s",
+						supplier, consumer, err.Error()))
+				} else {
+					repaired = true
+				}
+			}
+
+			for _, suffix := range missing {
+				drift = append(drift,
+					ibmv1.IBMSecurityVerifyDirectoryAgreementDrift{
+						Supplier: supplier,
+						Consumer: consumer,
+						Suffix:   suffix,
+						Type:     ibmv1.DriftTypeMissing,
+						Repaired: repaired,
+					})
+			}
+		}
+
+		/*
+		 * Remove any stale agreements.  A consumer which is not one of our
+		 * replicas is reported using its replica identifier, which is the
+		 * identifier which is needed to remove the agreement.  The supplier
+		 * subentry of a server which is no longer one of our replicas is
+		 * removed along with the agreement.
+		 */
+
+		var stale []string
+
+		for consumer := range existing {
+			if consumer == supplier || !utils.Contains(domain, consumer) {
+				stale = append(stale, consumer)
+			}
+		}
+
+		sort.Strings(stale)
+
+		for _, consumer := range stale {
+			replicaId := consumer
+
+			if utils.Contains(pvcs, consumer) {
+				replicaId = r.getReplicaPodName(h.directory, consumer)
+			}
+
+			repaired := false
+
+			podName, err := r.getReplicaSetPodName(
+							h, r.getReplicaPodName(h.directory, supplier))
+
+			if err == nil {
+				err = r.deleteReplicationAgreement(h, podName, replicaId)
+			}
+
+			if err == nil && !utils.Contains(pvcs, consumer) {
+				err = r.deleteSupplierSubentry(h, podName, replicaId)
+			}
+
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Failed to remove " +
+					"the stale replication agreement from %s to %s: %s",
+					supplier, consumer, err.Error()))
+			} else {
+				repaired = true
+			}
+
+			suffixes := make([]string, 0, len(existing[consumer]))
+
+			for suffix := range existing[consumer] {
+				suffixes = append(suffixes, suffix)
+			}
+
+			sort.Strings(suffixes)
+
+			for _, suffix := range suffixes {
+				drift = append(drift,
+					ibmv1.IBMSecurityVerifyDirectoryAgreementDrift{
+						Supplier: supplier,
+						Consumer: consumer,
+						Suffix:   suffix,
+						Type:     ibmv1.DriftTypeStale,
+						Repaired: repaired,
+					})
+			}
+		}
+	}
+
+	r.setTopologyStatus(h, drift, problems)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to save the result of a topology check in
+ * the status of the document, and to publish the topology metrics.  The
+ * status is not saved by this function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) setTopologyStatus(
+				h        *RequestHandle,
+				drift    []ibmv1.IBMSecurityVerifyDirectoryAgreementDrift,
+				problems []string) {
+
+	now := metav1.Now()
+
+	h.directory.Status.TopologyDrift         = drift
+	h.directory.Status.LastTopologyCheckTime = &now
+
+	/*
+	 * Publish the metrics.
+	 */
+
+	counts := map[ibmv1.IBMSecurityVerifyDirectoryDriftType]int{
+		ibmv1.DriftTypeMissing: 0,
+		ibmv1.DriftTypeStale:   0,
+	}
+
+	var repairs []string
+
+	for _, entry := range drift {
+		counts[entry.Type]++
+
+		if entry.Repaired {
+			topologyRepairs.WithLabelValues(h.directory.Namespace,
+				h.directory.Name, string(entry.Type)).Inc()
+
+			repairs = append(repairs, fmt.Sprintf("%s (%s -> %s, %s)",
+				strings.ToLower(string(entry.Type)), entry.Supplier,
+				entry.Consumer, entry.Suffix))
+		}
+	}
+
+	for driftType, count := range counts {
+		topologyDrift.WithLabelValues(h.directory.Namespace,
+				h.directory.Name, string(driftType)).Set(float64(count))
+	}
+
+	if len(drift) > 0 {
+		r.recordWarning(h, EventTopologyDrift, "%d replication agreements " +
+			"differed from the full-mesh topology, and %d have been " +
+			"repaired.", len(drift), len(repairs))
+	}
+
+	/*
+	 * Set the condition.
+	 */
+
+	condition := metav1.Condition{
+		Type:               TopologyConsistentCondition,
+		ObservedGeneration: h.directory.Generation,
+	}
+
+	switch {
+		case len(problems) > 0:
+			condition.Status  = metav1.ConditionFalse
+			condition.Reason  = "TopologyDrift"
+			condition.Message = strings.Join(problems, " ")
+
+			r.Log.Info("The replication topology is not consistent",
+					r.createLogParams(h, "Problems", problems)...)
+
+		case len(repairs) > 0:
+			condition.Status  = metav1.ConditionTrue
+			condition.Reason  = "TopologyRepaired"
+			condition.Message = fmt.Sprintf("The replication agreements " +
+				"have been repaired: %s.", strings.Join(repairs, ", "))
+
+			r.Log.Info("The replication topology has been repaired",
+					r.createLogParams(h, "Repairs", repairs)...)
+
+		default:
+			condition.Status  = metav1.ConditionTrue
+			condition.Reason  = "TopologyConsistent"
+			condition.Message = "The replication agreements match the " +
+				"full-mesh topology."
+	}
+
+	meta.SetStatusCondition(&h.directory.Status.Conditions, condition)
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,419 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to handle
+ * the update of existing replicas (e.g. a rolling upgrade to a new image).
+ */
+
+/*****************************************************************************/
+
+import (
+	appsv1  "k8s.io/api/apps/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"errors"
+	"fmt"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to work out which of the existing replicas
+ * need to be updated.  A replica needs to be updated if the specification of
+ * its replica set no longer matches the specification which would be
+ * generated from the current document.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getReplicasToUpdate(
+			h        *RequestHandle,
+			existing map[string]string) (toBeUpdated []string, err error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "getReplicasToUpdate")...)
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		if _, ok := existing[pvcName]; !ok {
+			continue
+		}
+
+		current, err := r.isReplicaSetCurrent(h, pvcName)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !current {
+			toBeUpdated = append(toBeUpdated, pvcName)
+		}
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the replica set for
+ * the specified replica matches the current document.  A replica set which
+ * doesn't exist is regarded as current as it will be created from the
+ * current document.  A replica set which was created by an earlier version
+ * of the operator doesn't have a hash of its specification, and so its pod
+ * template is compared with the template which would be generated from the
+ * current document.  If the templates match the hash is added to the replica
+ * set, rather than restarting the replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isReplicaSetCurrent(
+			h       *RequestHandle,
+			pvcName string) (bool, error) {
+
+	desired := r.constructReplicaSet(h, pvcName)
+	rep     := &appsv1.ReplicaSet{}
+
+	err := r.Get(h.ctx,
+				types.NamespacedName{
+					Name:      desired.Name,
+					Namespace: h.directory.Namespace}, rep)
+
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+
+ 		r.Log.Error(err, "Failed to retrieve the replica set",
+						r.createLogParams(h, "Replica.Name", desired.Name)...)
+
+		return false, err
+	}
+
+	hash := desired.ObjectMeta.Annotations[utils.SpecHashKey]
+
+	if existing, ok := rep.ObjectMeta.Annotations[utils.SpecHashKey]; ok {
+		return existing == hash, nil
+	}
+
+	/*
+	 * The API server adds default values to the pod template, and so we 
+	 * only compare the fields which are set in the generated template.  
+	 * The generated template also contains the hash, which is not present
+	 * in the existing template.
+	 */
+
+	template := desired.Spec.Template.DeepCopy()
+
+	delete(template.ObjectMeta.Annotations, utils.SpecHashKey)
+
+	if ! equality.Semantic.DeepDerivative(*template, rep.Spec.Template) {
+		return false, nil
+	}
+
+	r.Log.Info("Adding the specification hash to the replica set",
+				r.createLogParams(h, "Replica.Name", rep.Name)...)
+
+	patch := client.MergeFrom(rep.DeepCopy())
+
+	if rep.ObjectMeta.Annotations == nil {
+		rep.ObjectMeta.Annotations = make(map[string]string)
+	}
+
+	rep.ObjectMeta.Annotations[utils.SpecHashKey] = hash
+
+	err = r.Patch(h.ctx, rep, patch)
+
+	if err != nil {
+		r.Log.Error(err, "Failed to add the specification hash to the " +
+				"replica set", r.createLogParams(h, "Replica.Name", rep.Name)...)
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the UpdatingReplicas phase of
+ * the workflow.  The replicas are updated one at a time, and we wait for
+ * each updated replica to become ready, and for replication to catch up,
+ * before we move on to the next replica.  This ensures that the proxy
+ * always has a working replica to route requests to.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) updateReplicas(
+			h *RequestHandle) (ibmv1.IBMSecurityVerifyDirectoryPhase, error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "updateReplicas",
+						"Replicas", h.directory.Status.ReplicasToUpdate)...)
+
+	if len(h.directory.Status.ReplicasToUpdate) == 0 {
+		return r.getPostUpdatePhase(h), nil
+	}
+
+	pvcName := h.directory.Status.ReplicasToUpdate[0]
+
+	updated, err := r.updateReplica(h, pvcName)
+
+	if err != nil || !updated {
+		return ibmv1.PhaseUpdatingReplicas, err
+	}
+
+	r.Log.Info("Updated a replica",
+				r.createLogParams(h, "PVC.Name", pvcName)...)
+
+	/*
+	 * Remove the replica from the list of replicas to be updated.  If
+	 * there are more replicas to be updated we save the list, and reset the
+	 * start time of the phase so that each replica is given the full amount
+	 * of time to update.
+	 */
+
+	h.directory.Status.ReplicasToUpdate =
+					h.directory.Status.ReplicasToUpdate[1:]
+
+	if len(h.directory.Status.ReplicasToUpdate) == 0 {
+		return r.getPostUpdatePhase(h), nil
+	}
+
+	now := metav1.Now()
+
+	h.directory.Status.PhaseStartTime = &now
+
+	if err := r.Status().Update(h.ctx, h.directory); err != nil {
+		r.Log.Error(err, "Failed to update the status for the resource",
+						r.createLogParams(h)...)
+
+		return ibmv1.PhaseUpdatingReplicas, err
+	}
+
+	return ibmv1.PhaseUpdatingReplicas, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine the phase which follows the
+ * UpdatingReplicas phase.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getPostUpdatePhase(
+			h *RequestHandle) ibmv1.IBMSecurityVerifyDirectoryPhase {
+
+	if len(h.directory.Status.ReplicasToAdd) > 0 {
+		return ibmv1.PhaseCreatingAgreements
+	}
+
+	return ibmv1.PhaseDeployingProxy
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to update a single replica.  The replica
+ * set is updated with the new pod template, and the existing pod is then
+ * deleted so that it is recreated from the new template.  The update has
+ * completed once the new pod is ready and all changes which were made while
+ * the replica was unavailable have been replicated to the replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) updateReplica(
+			h       *RequestHandle,
+			pvcName string) (bool, error) {
+
+	r.Log.V(1).Info("Entering a function",
+		r.createLogParams(h, "Function", "updateReplica", "PVC", pvcName)...)
+
+	desired := r.constructReplicaSet(h, pvcName)
+	hash    := desired.ObjectMeta.Annotations[utils.SpecHashKey]
+
+	/*
+	 * Retrieve the existing replica set.  If the replica set no longer
+	 * exists we simply create it from the current document.
+	 */
+
+	rep := &appsv1.ReplicaSet{}
+	err := r.Get(h.ctx,
+				types.NamespacedName{
+					Name:      desired.Name,
+					Namespace: h.directory.Namespace}, rep)
+
+	if err != nil {
+		if ! k8serrors.IsNotFound(err) {
+ 			r.Log.Error(err, "Failed to retrieve the replica set",
+						r.createLogParams(h, "Replica.Name", desired.Name)...)
+
+			return false, err
+		}
+
+		return false, r.startReplica(h, pvcName)
+	}
+
+	/*
+	 * Update the replica set if it doesn't match the current document.  The
+	 * selector of a replica set cannot be changed, and so we only update
+	 * the pod template.
+	 */
+
+	if rep.ObjectMeta.Annotations[utils.SpecHashKey] != hash {
+		r.Log.Info("Updating the replica set",
+					r.createLogParams(h, "Replica.Name", rep.Name)...)
+
+		if rep.ObjectMeta.Annotations == nil {
+			rep.ObjectMeta.Annotations = make(map[string]string)
+		}
+
+		rep.ObjectMeta.Labels                         = desired.ObjectMeta.Labels
+		rep.ObjectMeta.Annotations[utils.SpecHashKey] = hash
+		rep.Spec.Template                             = desired.Spec.Template
+
+		err = r.Update(h.ctx, rep)
+
+		if err != nil {
+ 			r.Log.Error(err, "Failed to update the replica set",
+						r.createLogParams(h, "Replica.Name", rep.Name)...)
+		}
+
+		return false, err
+	}
+
+	/*
+	 * A replica set will not replace its existing pods when the pod
+	 * template is changed, and so we need to delete any pod which was
+	 * created from the old template.
+	 */
+
+	pods, err := r.getReplicaPods(h, pvcName)
+
+	if err != nil {
+		return false, err
+	}
+
+	stale := false
+
+	for _, pod := range pods {
+		if pod.ObjectMeta.Annotations[utils.SpecHashKey] == hash {
+			continue
+		}
+
+		stale = true
+
+		if pod.ObjectMeta.DeletionTimestamp != nil {
+			continue
+		}
+
+		r.Log.Info("Restarting the pod for the replica",
+				r.createLogParams(h, "PVC.Name", pvcName, "Pod", pod.Name)...)
+
+		err = r.Delete(h.ctx, &pod)
+
+		if err != nil && ! k8serrors.IsNotFound(err) {
+ 			r.Log.Error(err, "Failed to delete the pod",
+						r.createLogParams(h, "Pod", pod.Name)...)
+
+			return false, err
+		}
+	}
+
+	if stale {
+		return false, nil
+	}
+
+	/*
+	 * Wait for the new pod to become ready, and for the replica to catch up
+	 * with the changes which were made while it was being updated.
+	 */
+
+	ready, err := r.isReplicaReady(h, pvcName)
+
+	if err != nil || !ready {
+		return false, err
+	}
+
+	return r.isReplicaSynchronised(h, pvcName)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether all of the changes
+ * which have been made on the other replicas have been replicated to the
+ * specified replica.  A supplier whose agreements cannot be retrieved (e.g.
+ * the supplier is not available) is skipped, and a warning event is 
+ * recorded, so that a single unavailable supplier doesn't block the update.
+ * An error will be returned if the replica has not caught up within the
+ * allocated time.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isReplicaSynchronised(
+			h       *RequestHandle,
+			pvcName string) (bool, error) {
+
+	r.Log.V(1).Info("Entering a function",
+		r.createLogParams(h, "Function", "isReplicaSynchronised",
+					"PVC", pvcName)...)
+
+	synchronised := true
+
+	for _, supplier := range h.directory.Spec.Replicas.PVCs {
+		if supplier == pvcName ||
+				utils.Contains(h.directory.Status.ReplicasToAdd, supplier) {
+			continue
+		}
+
+		count, err := r.getPendingChangeCount(h, supplier, pvcName)
+
+		if err != nil {
+			r.recordWarning(h, EventSupplierUnavailable,
+				"The replication agreements of the replica, %s, could not " +
+				"be retrieved, and so the replica was skipped while " +
+				"waiting for the replica, %s, to synchronise: %s", supplier,
+				pvcName, err.Error())
+
+			continue
+		}
+
+		if count > 0 {
+			r.Log.Info("Waiting for replication to complete",
+				r.createLogParams(h, "Supplier.PVC", supplier,
+						"Consumer.PVC", pvcName, "Pending", count)...)
+
+			synchronised = false
+
+			break
+		}
+	}
+
+	if !synchronised && r.hasPhaseTimedOut(h, ReplicationTimeout) {
+		err := errors.New(fmt.Sprintf("The replica, %s, failed to " +
+				"synchronise with the other replicas within the allocated " +
+				"time.", pvcName))
+
+ 		r.Log.Error(err,
+				"The replica failed to synchronise within the allocated time.",
+				r.createLogParams(h, "PVC.Name", pvcName)...)
+
+		return false, err
+	}
+
+	return synchronised, nil
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,126 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the update of the existing replicas.
+ */
+
+/*****************************************************************************/
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("getReplicasToUpdate", func() {
+	const namespace = "default"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var h          *RequestHandle
+	var existing   map[string]string
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+
+		h = newTestHandle("isvd", namespace, []string{"replica-1"})
+
+		h.directory.Spec.Pods.Image.Repo  = "icr.io/isvd"
+		h.directory.Spec.Pods.Image.Label = "10.0.0"
+
+		existing = map[string]string{"replica-1": "isvd-replica-1-pod"}
+
+		/*
+		 * Create a replica set in the same way as an earlier version of
+		 * the operator, which did not add the hash of the specification.
+		 */
+
+		rep := reconciler.constructReplicaSet(h, "replica-1")
+
+		rep.ObjectMeta.Annotations               = nil
+		rep.ObjectMeta.OwnerReferences           = nil
+		rep.Spec.Template.ObjectMeta.Annotations = nil
+
+		Expect(k8sClient.Create(context.Background(), rep)).To(Succeed())
+
+		DeferCleanup(func() {
+			k8sClient.Delete(context.Background(), rep)
+		})
+	})
+
+	getHash := func() string {
+		rep := &appsv1.ReplicaSet{}
+
+		Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+			Name:      reconciler.getReplicaPodName(h.directory, "replica-1"),
+			Namespace: namespace,
+		}, rep)).To(Succeed())
+
+		return rep.ObjectMeta.Annotations[utils.SpecHashKey]
+	}
+
+	It("adopts a replica set whose template matches the document", func() {
+		toBeUpdated, err := reconciler.getReplicasToUpdate(h, existing)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(toBeUpdated).To(BeEmpty())
+		Expect(getHash()).To(Equal(reconciler.constructReplicaSet(
+				h, "replica-1").ObjectMeta.Annotations[utils.SpecHashKey]))
+	})
+
+	It("updates a replica set whose template differs from the document",
+				func() {
+		h.directory.Spec.Pods.Image.Label = "10.0.1"
+
+		toBeUpdated, err := reconciler.getReplicasToUpdate(h, existing)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(toBeUpdated).To(Equal([]string{"replica-1"}))
+		Expect(getHash()).To(BeEmpty())
+	})
+})
+
+/*****************************************************************************/
+
+var _ = Describe("isReplicaSynchronised", func() {
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var recorder   *record.FakeRecorder
+
+	BeforeEach(func() {
+		reconciler, recorder = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+	})
+
+	It("skips a supplier which is not available", func() {
+		h := newTestHandle("isvd", "isvd-unknown-namespace",
+						[]string{"replica-1", "replica-2"})
+
+		synchronised, err := reconciler.isReplicaSynchronised(h, "replica-1")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(synchronised).To(BeTrue())
+		Expect(getRecordedEvents(recorder)).To(ContainElement(
+						HavePrefix("Warning SupplierUnavailable")))
+	})
+})
+
+/*****************************************************************************/
+
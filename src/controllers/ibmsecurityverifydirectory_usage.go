@@ -0,0 +1,306 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to
+ * monitor the usage of the file system which holds the data of each of the
+ * replicas.  The usage is obtained by running the df command within the
+ * pod of each replica, and is used to raise the StorageLow condition and to
+ * prevent a new replica from being seeded into a PVC which is too small to
+ * hold the data of the principal.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The name of the condition which reports whether the storage of any of the
+ * replicas is running low, and the directory, within the replica pods, at
+ * which the data volume is mounted.
+ */
+
+const StorageLowCondition = "StorageLow"
+const StorageCheckPath    = "/var/isvd/data"
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to check the usage of the file system of
+ * each of the replicas.  The usage is saved in the status of the replica,
+ * the StorageLow condition is set and the storage metrics are published.
+ * The status is not saved by this function.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) checkStorage(
+			h *RequestHandle) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "checkStorage")...)
+
+	threshold := h.directory.Spec.GetStorageLowThreshold()
+
+	var problems []string
+
+	published := make(map[string]*ibmv1.IBMSecurityVerifyDirectoryStorageUsage)
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		status := r.getReplicaStatus(h, pvcName)
+
+		/*
+		 * We can only query a replica which is currently running.
+		 */
+
+		healthy, err := r.isReplicaHealthy(h, pvcName)
+
+		if err != nil || !healthy {
+			continue
+		}
+
+		usage, err := r.getStorageUsage(h, pvcName)
+
+		if err != nil {
+			r.Log.Info("Failed to retrieve the storage usage of the replica",
+					r.createLogParams(h, "PVC.Name", pvcName,
+							"Error", err.Error())...)
+
+			continue
+		}
+
+		status.Storage     = usage
+		published[pvcName] = usage
+
+		if usage.UsedPercent >= threshold {
+			problems = append(problems, fmt.Sprintf("The replica, %s, has " +
+				"used %d%% of its storage.", pvcName, usage.UsedPercent))
+		}
+	}
+
+	r.setStorageMetrics(h.directory.Namespace, h.directory.Name, published)
+
+	/*
+	 * Set the condition.  A warning event is recorded when the storage of a
+	 * replica first becomes low.
+	 */
+
+	condition := metav1.Condition{
+		Type:               StorageLowCondition,
+		ObservedGeneration: h.directory.Generation,
+	}
+
+	if len(problems) == 0 {
+		condition.Status  = metav1.ConditionFalse
+		condition.Reason  = "StorageSufficient"
+		condition.Message = fmt.Sprintf("All of the replicas have used less " +
+				"than %d%% of their storage.", threshold)
+	} else {
+		condition.Status  = metav1.ConditionTrue
+		condition.Reason  = "StorageLow"
+		condition.Message = strings.Join(problems, " ")
+
+		r.Log.Info("The storage of the replicas is low",
+				r.createLogParams(h, "Problems", problems)...)
+
+		if ! meta.IsStatusConditionTrue(
+					h.directory.Status.Conditions, StorageLowCondition) {
+			r.recordWarning(h, EventStorageLow, "%s", condition.Message)
+		}
+	}
+
+	meta.SetStatusCondition(&h.directory.Status.Conditions, condition)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to ensure that the PVC of each of the new
+ * replicas is large enough to hold the data of the principal before the new
+ * replicas are seeded.  A PVC which is smaller than the storage size of the
+ * document will be expanded before it is seeded, and so the storage size is
+ * used in place of the capacity of such a PVC.  If the usage of the 
+ * principal cannot be determined the check is skipped.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) checkSeedCapacity(
+			h         *RequestHandle,
+			principal string,
+			replicas  []string) error {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "checkSeedCapacity",
+						"Principal", principal)...)
+
+	usage, err := r.getStorageUsage(h, principal)
+
+	if err != nil {
+		r.Log.Info("Failed to retrieve the storage usage of the principal",
+				r.createLogParams(h, "Principal", principal,
+						"Error", err.Error())...)
+
+		return nil
+	}
+
+	size := h.directory.Spec.StorageSize
+
+	for _, pvcName := range replicas {
+		pvc, err := r.getPVC(h, pvcName)
+
+		if err != nil {
+			return err
+		}
+
+		capacity := r.getPVCCapacity(pvc)
+
+		if capacity == nil {
+			capacity = pvc.Spec.Resources.Requests.Storage()
+		}
+
+		if size != nil && size.Cmp(*capacity) > 0 {
+			capacity = size
+		}
+
+		if capacity.Value() < usage.Used {
+			r.recordWarning(h, EventStorageInsufficient,
+				"The PVC, %s, (%d bytes) is too small to hold the data of " +
+				"the principal, %s, (%d bytes).", pvcName, capacity.Value(),
+				principal, usage.Used)
+
+			return errors.New(fmt.Sprintf("The PVC, %s, (%d bytes) is too " +
+				"small to hold the data of the principal, %s, (%d bytes).",
+				pvcName, capacity.Value(), principal, usage.Used))
+		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the usage of the file system
+ * of the specified replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getStorageUsage(
+			h       *RequestHandle,
+			pvcName string) (*ibmv1.IBMSecurityVerifyDirectoryStorageUsage, error) {
+
+	podName, err := r.getReplicaSetPodName(h,
+						r.getReplicaPodName(h.directory, pvcName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getPodStorageUsage(h, podName)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the usage of the file system
+ * which holds the data of the replica which is running in the specified pod.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getPodStorageUsage(
+			h       *RequestHandle,
+			podName string) (*ibmv1.IBMSecurityVerifyDirectoryStorageUsage, error) {
+
+	return r.getPathStorageUsage(h, podName, StorageCheckPath)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to retrieve the usage of the file system
+ * which is mounted at the specified path of the specified pod.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getPathStorageUsage(
+			h       *RequestHandle,
+			podName string,
+			path    string) (*ibmv1.IBMSecurityVerifyDirectoryStorageUsage, error) {
+
+	output, err := r.executeCommandWithOutput(h, podName,
+						[]string{"df", "-P", "-k", path})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.parseStorageUsage(output)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to parse the output of the 'df -P -k'
+ * command.  The output contains a header line followed by a line of the
+ * format:
+ *     <filesystem> <1024-blocks> <used> <available> <capacity>% <mount>
+ * The fields are parsed from the end of the line, as the name of the file
+ * system may contain spaces.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) parseStorageUsage(
+			output string) (*ibmv1.IBMSecurityVerifyDirectoryStorageUsage, error) {
+
+	lines  := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+
+	if len(lines) < 2 || len(fields) < 6 {
+		return nil, errors.New(fmt.Sprintf("The output of the df command " +
+				"could not be parsed: %s", output))
+	}
+
+	fields = fields[len(fields)-5:]
+
+	var values [3]int64
+
+	for idx := range values {
+		value, err := strconv.ParseInt(fields[idx], 10, 64)
+
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("The output of the df " +
+				"command could not be parsed: %s", output))
+		}
+
+		values[idx] = value * 1024
+	}
+
+	percent, err := strconv.ParseInt(
+						strings.TrimSuffix(fields[3], "%"), 10, 32)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("The output of the df command " +
+				"could not be parsed: %s", output))
+	}
+
+	return &ibmv1.IBMSecurityVerifyDirectoryStorageUsage{
+		Capacity:    values[0],
+		Used:        values[1],
+		Available:   values[2],
+		UsedPercent: int32(percent),
+	}, nil
+}
+
+/*****************************************************************************/
+
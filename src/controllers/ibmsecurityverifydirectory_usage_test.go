@@ -0,0 +1,129 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the tests for the monitoring of the storage usage of
+ * the replicas.
+ */
+
+/*****************************************************************************/
+
+import (
+	corev1  "k8s.io/api/core/v1"
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+/*
+ * The output of the df command for a file system of 4GiB with 2GiB in use.
+ */
+
+const testDfOutput = "Filesystem     1024-blocks    Used Available Capacity Mounted on\n" +
+	"/dev/sdb           4194304 2097152   2097152      50% /var/isvd/data\n"
+
+/*****************************************************************************/
+
+var _ = Describe("parseStorageUsage", func() {
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+
+	BeforeEach(func() {
+		reconciler, _ = newTestReconciler(
+						&FakePodExecutor{}, &FakePodResolver{})
+	})
+
+	It("parses the output of the df command", func() {
+		usage, err := reconciler.parseStorageUsage(testDfOutput)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage.Capacity).To(Equal(int64(4294967296)))
+		Expect(usage.Used).To(Equal(int64(2147483648)))
+		Expect(usage.Available).To(Equal(int64(2147483648)))
+		Expect(usage.UsedPercent).To(Equal(int32(50)))
+	})
+
+	It("rejects unexpected output", func() {
+		_, err := reconciler.parseStorageUsage("df: /var/isvd/data: not found")
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+/*****************************************************************************/
+
+var _ = Describe("checkSeedCapacity", func() {
+	const namespace = "default"
+	const pvcName   = "small-replica"
+
+	var reconciler *IBMSecurityVerifyDirectoryReconciler
+	var recorder   *record.FakeRecorder
+	var h          *RequestHandle
+
+	BeforeEach(func() {
+		requireTestEnvironment()
+
+		reconciler, recorder = newTestReconciler(
+			&FakePodExecutor{
+				Handler: func(pod string, command []string) (string, string, error) {
+					return testDfOutput, "", nil
+				},
+			},
+			&FakePodResolver{
+				Pods: map[string]string{
+					"isvd-replica-1": "isvd-replica-1-pod",
+				},
+			})
+
+		h = newTestHandle("isvd", namespace,
+				[]string{"replica-1", pvcName})
+
+		h.directory.Status.Principal = "replica-1"
+
+		Expect(k8sClient.Create(context.Background(),
+			&corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: pvcName, Namespace: namespace},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{
+						corev1.ReadWriteOnce,
+					},
+					Resources:   corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse("1Gi"),
+						},
+					},
+				},
+			})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		k8sClient.Delete(context.Background(), &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: pvcName, Namespace: namespace},
+		})
+	})
+
+	It("refuses to seed a PVC which is smaller than the principal", func() {
+		err := reconciler.checkSeedCapacity(h, "replica-1",
+						[]string{pvcName})
+
+		Expect(err).To(HaveOccurred())
+		Expect(getRecordedEvents(recorder)).To(ContainElement(
+						HavePrefix("Warning StorageInsufficient")))
+	})
+})
+
+/*****************************************************************************/
+
@@ -18,25 +18,21 @@ import (
 	corev1  "k8s.io/api/core/v1"
 	batchv1 "k8s.io/api/batch/v1"
 
-	"bytes"
-	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
-	"time"
 
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/apimachinery/pkg/util/wait"
 
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/kubectl/pkg/scheme"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
 	"github.com/ibm-security/verify-directory-operator/utils"
 
 	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
@@ -57,117 +53,33 @@ func (r *IBMSecurityVerifyDirectoryReconciler) getReplicaPodName(
 /*****************************************************************************/
 
 /*
- * The following function is used to get the replica controller pod name.
+ * The following function is used to get the name of the pod which is being
+ * managed by the specified replica set.  An error will be returned if the 
+ * pod does not currently exist.
  */
-func (r *IBMSecurityVerifyDirectoryReconciler) getReplicaSetPodName(
-        h *RequestHandle,
-        replicaName string) string {
-
-        r.Log.V(1).Info("Entering a function",
-                r.createLogParams(h, "Function", "getReplicaSetPodName",
-                        "Replica.Name", replicaName)...)
-
-        // Get cluster config
-        clusterconfig := ctrl.GetConfigOrDie()
-
-        // Create a Kubernetes client
-        clientset := kubernetes.NewForConfigOrDie(clusterconfig)
-
-        // Get the replicaset
-        replicaset, err := clientset.AppsV1().ReplicaSets(h.directory.Namespace).Get(context.Background(), replicaName, metav1.GetOptions{})
-        if err != nil {
-                r.Log.Error(err, "Failed to get the replicaset",
-                        r.createLogParams(h, "Replica.Name", replicaName)...)
-        }
-
-       r.Log.Info("Waiting up to 2 minutes for the pod to show up",
-                r.createLogParams(h, "Replica.Name", replicaName)...)
-
-        r.Log.V(1).Info("Replica details",
-                r.createLogParams(h, "Details", replicaName)...)
-	
-	retryCount := 60             // Adjust retry count as needed
-        backoff := time.Second * 2   // Initial backoff time
-        for i := 0; i < retryCount; i++ {
-
-          r.Log.Info("Getting available pods",
-                  r.createLogParams(h, "Available pods", replicaset.Status.FullyLabeledReplicas)...)
-
-          r.Log.V(1).Info("Replica details",
-                  r.createLogParams(h, "Details", replicaName)...)
-
-          if replicaset.Status.FullyLabeledReplicas >= 1 {
-             r.Log.Info("Pod is available for...",
-                      r.createLogParams(h, "Replica.Name", replicaName)...)
-
-             r.Log.V(1).Info("Replica details",
-                      r.createLogParams(h, "Details", replicaName)...)
-             break
-          }
-
-          time.Sleep(backoff)
-
-          // Get the replicaset
-          replicaset, err = clientset.AppsV1().ReplicaSets(h.directory.Namespace).Get(context.Background(), replicaName, metav1.GetOptions{})
-          if err != nil {
-                r.Log.Error(err, "Failed to get the replicaset",
-                        r.createLogParams(h, "Replica.Name", replicaName)...)
-          }
-
-        }
-
-        // Get the replicaset's labels
-        selector, err := metav1.LabelSelectorAsSelector(replicaset.Spec.Selector)
-        if err != nil {
-                r.Log.Error(err, "Failed to get the replicaset labels",
-                        r.createLogParams(h, "Replica.Name", replicaName)...)
-        }
-
-        // Use the app's label selector name. Remember this should match with
-        // the controller selector's matchLabels.
-        options := metav1.ListOptions{
-                LabelSelector: fmt.Sprintf("%s", selector),
-        }
 
-        // Get the pods list controlled by the replicaset
-
-        r.Log.Info("Getting the pod",
-                r.createLogParams(h, "Pod.Label", selector)...)
-
-        r.Log.V(1).Info("Replica details",
-                r.createLogParams(h, "Details", replicaName)...)
-
-        podList, _ := clientset.CoreV1().Pods(h.directory.Namespace).List(context.Background(), options)
-
-        // Get the name of the first pod
-        podname := (*podList).Items[0]
-
-        r.Log.Info("Returning the pod name",
-                r.createLogParams(h, "Pod.Name", podname.Name)...)
-
-        r.Log.V(1).Info("Replica details",
-                r.createLogParams(h, "Details", replicaName)...)
+func (r *IBMSecurityVerifyDirectoryReconciler) getReplicaSetPodName(
+			h           *RequestHandle,
+			replicaName string) (string, error) {
 
-        return fmt.Sprintf("%s", podname.Name)
-}
+	r.Log.V(1).Info("Entering a function",
+			r.createLogParams(h, "Function", "getReplicaSetPodName",
+					"Replica.Name", replicaName)...)
 
-/*****************************************************************************/
+	podName, err := r.Resolver.GetReplicaSetPod(
+						h.ctx, h.directory.Namespace, replicaName)
 
-/*
- * The following function is used to generate the deployment name for the pod.
- */
-
-func (r *IBMSecurityVerifyDirectoryReconciler) getReplicaDeploymentName(
-			podname    string) string {
-	// Find the index of the last dash.
-        lastDashIndex := strings.LastIndex(podname, "-")
+	if err != nil {
+		r.Log.Error(err, "Failed to get the pod for the replicaset",
+				r.createLogParams(h, "Replica.Name", replicaName)...)
 
-        var str string
+		return "", err
+	}
 
-       // Slice the string from the beginning to the last dash index.
-	str = podname[:lastDashIndex]
+	r.Log.V(1).Info("Returning the pod name",
+			r.createLogParams(h, "Pod.Name", podName)...)
 
-	return str
+	return podName, nil
 }
 
 /*****************************************************************************/
@@ -197,6 +109,19 @@ func (r *IBMSecurityVerifyDirectoryReconciler) getSeedJobName(
 
 /*****************************************************************************/
 
+/*
+ * The following function will create the name of the job which is used to
+ * restore a backup into the replica.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getRestoreJobName(
+			directory    *ibmv1.IBMSecurityVerifyDirectory,
+			pvc          string) string {
+	return fmt.Sprintf("%s-restore", r.getReplicaPodName(directory, pvc))
+}
+
+/*****************************************************************************/
+
 /*
  * The following function is used to create a ConfigMap with the specified
  * data.
@@ -233,10 +158,34 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createConfigMap(
 
 	if err != nil {
 		if k8serrors.IsAlreadyExists(err) {
+			/*
+			 * The ConfigMap already exists and so we need to update the
+			 * data in the existing ConfigMap.
+			 */
+
+			existing := &corev1.ConfigMap{}
+
+			err = r.Get(h.ctx, types.NamespacedName{
+						Name:      mapName,
+						Namespace: h.directory.Namespace}, existing)
+
+			if err != nil {
+				r.Log.Error(err, "Failed to retrieve the ConfigMap",
+						r.createLogParams(h, "ConfigMap.Name", mapName)...)
+
+				return
+			}
+
+			if reflect.DeepEqual(existing.Data, configMap.Data) {
+				return
+			}
+
 			r.Log.Info("Updating an existing ConfigMap", 
 						r.createLogParams(h, "ConfigMap.Name", mapName)...)
 
-			err = r.Update(h.ctx, configMap)
+			existing.Data = configMap.Data
+
+			err = r.Update(h.ctx, existing)
 
 			if err != nil {
 				r.Log.Error(err, "Failed to update the ConfigMap",
@@ -257,6 +206,90 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createConfigMap(
 
 /*****************************************************************************/
 
+/*
+ * The following function is used to create a Secret with the specified
+ * data.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) createSecret(
+			h            *RequestHandle,
+			secretName   string,
+			key          string,
+			value        string) (err error) {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "createSecret",
+						"Secret.Name", secretName, "Key", key)...)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: h.directory.Namespace,
+			Labels:    utils.LabelsForApp(h.directory.Name, secretName),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			key: []byte(value),
+		},
+	}
+
+	r.Log.Info("Creating a new Secret", 
+						r.createLogParams(h, "Secret.Name", secretName)...)
+
+	ctrl.SetControllerReference(h.directory, secret, r.Scheme)
+
+	err = r.Create(h.ctx, secret)
+
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			/*
+			 * The Secret already exists and so we need to update the
+			 * data in the existing Secret.
+			 */
+
+			existing := &corev1.Secret{}
+
+			err = r.Get(h.ctx, types.NamespacedName{
+						Name:      secretName,
+						Namespace: h.directory.Namespace}, existing)
+
+			if err != nil {
+				r.Log.Error(err, "Failed to retrieve the Secret",
+						r.createLogParams(h, "Secret.Name", secretName)...)
+
+				return
+			}
+
+			if reflect.DeepEqual(existing.Data, secret.Data) {
+				return
+			}
+
+			r.Log.Info("Updating an existing Secret", 
+						r.createLogParams(h, "Secret.Name", secretName)...)
+
+			existing.Data = secret.Data
+
+			err = r.Update(h.ctx, existing)
+
+			if err != nil {
+				r.Log.Error(err, "Failed to update the Secret",
+						r.createLogParams(h, "Secret.Name", secretName)...)
+
+				return
+			}
+		} else {
+			r.Log.Error(err, "Failed to create the new Secret",
+						r.createLogParams(h, "Secret.Name", secretName)...)
+
+			return
+		}
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
 /*
  * The following function is used to delete the specified config map.
  */
@@ -290,163 +323,329 @@ func (r *IBMSecurityVerifyDirectoryReconciler) deleteConfigMap(
 /*****************************************************************************/
 
 /*
- * Return a condition function that indicates whether the given job has
- * completed.
+ * The following function is used to delete the specified job if the job has
+ * failed.  This allows the job to be recreated when a failed phase is
+ * retried.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteFailedJob(
+				h    *RequestHandle,
+				name string) (err error) {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "deleteFailedJob",
+						"Job.Name", name)...)
+
+	job := &batchv1.Job{}
+	err	 = r.Get(h.ctx, 
+				types.NamespacedName{
+					Name:	   name,
+					Namespace: h.directory.Namespace}, job)
+
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	if ! r.hasJobCondition(job, batchv1.JobFailed) {
+		return
+	}
+
+	r.Log.Info("Deleting a failed job", 
+				r.createLogParams(h, "Job.Name", name)...)
+
+	return r.deleteJob(h, name)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to delete the specified job, along with
+ * its pods.  It is not an error if the job does not exist.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) deleteJob(
+				h    *RequestHandle,
+				name string) error {
+
+	r.Log.V(1).Info("Entering a function", 
+				r.createLogParams(h, "Function", "deleteJob",
+						"Job.Name", name)...)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: h.directory.Namespace,
+		},
+	}
+
+	err := r.Delete(h.ctx, job, 
+				client.PropagationPolicy(metav1.DeletePropagationBackground))
+
+	if err != nil && ! k8serrors.IsNotFound(err) {
+ 		r.Log.Error(err, "Failed to delete the job",
+						r.createLogParams(h, "Job.Name", name)...)
+
+		return err
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the specified job has
+ * completed.  An error will be returned if the job has failed, once all of
+ * its retries have been used, if the job cannot be retrieved, or if the job
+ * has not completed within the allocated time.  A job which does not exist
+ * has not yet completed.
  */
 
 func (r *IBMSecurityVerifyDirectoryReconciler) isJobComplete(
-				h         *RequestHandle,
-				podName   string) wait.ConditionFunc {
+				h    *RequestHandle,
+				name string) (bool, error) {
+
+	job := &batchv1.Job{}
+	err	:= r.Get(h.ctx, 
+				types.NamespacedName{
+					Name:	   name,
+					Namespace: h.directory.Namespace}, job)
 
-	return func() (bool, error) {
-		job := &batchv1.Job{}
-		err	:= r.Get(h.ctx, 
-					types.NamespacedName{
-						Name:	   podName,
-						Namespace: h.directory.Namespace}, job)
+	r.Log.V(1).Info("Checking if a job has completed", 
+			r.createLogParams(h, "Job", job)...)
 
-		r.Log.V(1).Info("Checking if a job has completed", 
-				r.createLogParams(h, "Job", job)...)
+	if err != nil && ! k8serrors.IsNotFound(err) {
+ 		r.Log.Error(err, "Failed to retrieve the job",
+						r.createLogParams(h, "Job.Name", name)...)
 
-		if err != nil {
+		return false, err
+	}
+
+	if err == nil {
+		/*
+		 * A job which is being deleted will be recreated once the deletion
+		 * has completed.
+		 */
+
+		if job.ObjectMeta.DeletionTimestamp != nil {
 			return false, nil
 		}
 
-		if job.Status.Failed > 0 {
-			return true, errors.New("The job failed!")
+		if r.hasJobCondition(job, batchv1.JobFailed) {
+			return false, errors.New(
+						fmt.Sprintf("The job, %s, failed!", name))
 		}
 
-		if job.Status.Succeeded > 0 {
+		if r.hasJobCondition(job, batchv1.JobComplete) {
 			return true, nil
 		}
+	}
+
+	if r.hasPhaseTimedOut(h, JobTimeout) {
+		err = errors.New(fmt.Sprintf("The job, %s, failed to complete " +
+				"within the allocated time.", name))
 
-		return false, nil
+ 		r.Log.Error(err, 
+				"The job failed to complete within the allocated time.",
+				r.createLogParams(h, "Job.Name", name)...)
+
+		return false, err
 	}
+
+	return false, nil
 }
 
 /*****************************************************************************/
 
 /*
- * Return a condition function that indicates whether the given pod is
- * currently running and available.
+ * The following function is used to determine whether the specified 
+ * condition of a job is true.  The JobFailed condition is only set once the
+ * back-off limit of the job has been reached, and so a job which has a 
+ * failed pod may still be retried.
  */
 
-func (r *IBMSecurityVerifyDirectoryReconciler) isPodOpComplete(
-				h            *RequestHandle,
-				podName      string,
-				waitForStart bool) wait.ConditionFunc {
+func (r *IBMSecurityVerifyDirectoryReconciler) hasJobCondition(
+				job           *batchv1.Job,
+				conditionType batchv1.JobConditionType) bool {
 
-	return func() (bool, error) {
-		pod := &corev1.Pod{}
-		err	:= r.Get(h.ctx, 
-					types.NamespacedName{
-						Name:	   podName,
-						Namespace: h.directory.Namespace}, pod)
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && 
+					condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
 
-		r.Log.V(1).Info("Checking if a Pod operation has completed", 
-			r.createLogParams(h, "Wait.For.Start", waitForStart, "Pod", pod)...)
+	return false
+}
 
-		/*
-		 * If we are waiting for the pod to stop we can return immediately
-		 * based on whether the pod was found or not.
-		 */
+/*****************************************************************************/
 
-		if (!waitForStart) {
-			if err == nil {
-				return false, nil
-			} else {
-				return true, nil
-			}
-		}
+/*
+ * The following function is used to retrieve the list of pods which are
+ * currently running for the specified replica.
+ */
 
-		/*
-		 * We are waiting for the pod to start and so we need to check the
-		 * current status of the pod.
-		 */
+func (r *IBMSecurityVerifyDirectoryReconciler) getReplicaPods(
+				h       *RequestHandle,
+				pvcName string) ([]corev1.Pod, error) {
 
-		if err != nil {
-			return false, nil
+	podList := &corev1.PodList{}
+
+	opts := []client.ListOption{
+		client.InNamespace(h.directory.Namespace),
+		client.MatchingLabels(
+					utils.LabelsForReplica(h.directory.Name, pvcName)),
+	}
+
+	err := r.List(h.ctx, podList, opts...)
+
+	if err != nil {
+ 		r.Log.Error(err, "Failed to retrieve the pods for the replica",
+						r.createLogParams(h, "PVC.Name", pvcName)...)
+
+		return nil, err
+	}
+
+	return podList.Items, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the pod for the
+ * specified replica is currently running and ready.  An error will be 
+ * returned if the pod has failed, or if the pod has not become ready within
+ * the allocated time.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isReplicaReady(
+				h       *RequestHandle,
+				pvcName string) (bool, error) {
+
+	pods, err := r.getReplicaPods(h, pvcName)
+
+	if err != nil {
+		return false, err
+	}
+
+	r.Log.V(1).Info("Checking if a replica is ready", 
+			r.createLogParams(h, "PVC.Name", pvcName, "Pods", pods)...)
+
+	for _, pod := range pods {
+		if pod.ObjectMeta.DeletionTimestamp != nil {
+			continue
 		}
 
 		switch pod.Status.Phase {
 			case corev1.PodRunning:
+				if len(pod.Status.ContainerStatuses) == 0 {
+					break
+				}
+
 				if pod.Status.ContainerStatuses[0].Ready {
 					return true, nil
 				}
 
 				if pod.Status.ContainerStatuses[0].RestartCount > 3 {
-					return true, 
-						errors.New("The pod has been restarted too many times.")
+					return false, errors.New(fmt.Sprintf("The pod, %s, has " +
+						"been restarted too many times.", pod.Name))
 				}
 
 			case corev1.PodFailed, corev1.PodSucceeded:
-				return true, errors.New("The pod is no longer running")
+				return false, errors.New(fmt.Sprintf(
+						"The pod, %s, is no longer running", pod.Name))
 		}
+	}
+
+	if r.hasPhaseTimedOut(h, PodStartTimeout) {
+		err = errors.New(fmt.Sprintf("The pod for the replica, %s, failed " +
+				"to become ready within the allocated time.", pvcName))
+
+ 		r.Log.Error(err, 
+				"The pod failed to become ready within the allocated time.",
+				r.createLogParams(h, "PVC.Name", pvcName)...)
 
-		return false, nil
+		return false, err
 	}
+
+	return false, nil
 }
 
 /*****************************************************************************/
 
 /*
- * The following function is used to wait for the specified pod to start
- * and be ready.
+ * The following function is used to determine whether the specified replica
+ * is currently healthy, which means that a pod for the replica is running
+ * and ready.  Unlike isReplicaReady this function will not wait for the
+ * replica to become ready.
  */
 
-func (r *IBMSecurityVerifyDirectoryReconciler) waitForPod(
-				h    *RequestHandle,
-				name string) (err error) {
-
-	r.Log.Info("Waiting up to 10 minutes for the pod to become ready", 
-					r.createLogParams(h, "Pod.Name", name)...)
+func (r *IBMSecurityVerifyDirectoryReconciler) isReplicaHealthy(
+				h       *RequestHandle,
+				pvcName string) (bool, error) {
 
-	err = wait.PollImmediate(time.Second, time.Duration(600) * time.Second, 
-					r.isPodOpComplete(h, name, true))
+	pods, err := r.getReplicaPods(h, pvcName)
 
 	if err != nil {
- 		r.Log.Error(err, 
-				"The pod failed to become ready within the allocated time.",
-				r.createLogParams(h, "Pod.Name", name)...)
+		return false, err
+	}
 
-		err = errors.New(fmt.Sprintf("The pod, %s, failed to become ready " +
-				"within the allocated time.", name))
+	for _, pod := range pods {
+		if pod.ObjectMeta.DeletionTimestamp != nil ||
+				pod.Status.Phase != corev1.PodRunning ||
+				len(pod.Status.ContainerStatuses) == 0 {
+			continue
+		}
 
-		return
+		if pod.Status.ContainerStatuses[0].Ready {
+			return true, nil
+		}
 	}
 
-	return
+	return false, nil
 }
 
 /*****************************************************************************/
 
 /*
- * The following function is used to wait for the specified job to complete.
+ * The following function is used to determine whether all pods for the
+ * specified replica have stopped.  An error will be returned if the pods
+ * have not stopped within the allocated time.
  */
 
-func (r *IBMSecurityVerifyDirectoryReconciler) waitForJob(
-				h    *RequestHandle,
-				name string) (err error) {
+func (r *IBMSecurityVerifyDirectoryReconciler) isReplicaStopped(
+				h       *RequestHandle,
+				pvcName string) (bool, error) {
 
-	/*
-	 * Wait for the job to finish.
-	 */
+	pods, err := r.getReplicaPods(h, pvcName)
 
-	r.Log.Info("Waiting up to 10 minutes for the job to finish", 
-					r.createLogParams(h, "Job.Name", name)...)
+	if err != nil {
+		return false, err
+	}
 
-	err = wait.PollImmediate(time.Second, time.Duration(600) * time.Second, 
-					r.isJobComplete(h, name))
+	r.Log.V(1).Info("Checking if a replica has stopped", 
+			r.createLogParams(h, "PVC.Name", pvcName, "Pods", pods)...)
 
-	if err != nil {
- 		r.Log.Error(err, 
-				"The job failed to complete within the allocated time.",
-				r.createLogParams(h, "Job.Name", name)...)
+	if len(pods) == 0 {
+		return true, nil
+	}
 
-		return
+	if r.hasPhaseTimedOut(h, PodStopTimeout) {
+		err = errors.New(fmt.Sprintf("The pod for the replica, %s, failed " +
+				"to stop within the allocated time.", pvcName))
+
+		r.Log.Error(err, 
+			"The pod failed to stop within the allocated time.",
+			r.createLogParams(h, "PVC.Name", pvcName)...)
+
+		return false, err
 	}
 
-	return
+	return false, nil
 }
 
 /*****************************************************************************/
@@ -497,7 +696,7 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createClusterService(
 	 * Create the service.
 	 */
 
-	r.Log.Info("Creating a new service for the replica", 
+	r.Log.V(1).Info("Creating a new service for the replica", 
 				r.createLogParams(h, "Replica.Name", podName)...)
 
 	r.Log.V(1).Info("Service details", 
@@ -506,6 +705,10 @@ func (r *IBMSecurityVerifyDirectoryReconciler) createClusterService(
 	err := r.Create(h.ctx, service)
 
 	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			return nil
+		}
+
  		r.Log.Error(err, "Failed to create the service for the replica",
 				r.createLogParams(h, "Replica.Name", podName)...)
 
@@ -530,67 +733,59 @@ func (r *IBMSecurityVerifyDirectoryReconciler) executeCommand(
 	r.Log.Info("Executing a command", 
 			r.createLogParams(h, "Pod", pod, "Command", command)...)
 
-	/*
-	 * Create a client which can be used.
-	 */
+	_, err := r.executeCommandWithOutput(h, pod, command)
 
-	kubeConfig := ctrl.GetConfigOrDie()
-	kubeClient := kubernetes.NewForConfigOrDie(kubeConfig)
+	return err
+}
 
-	/*
-	 * Construct the request.
-	 */
+/*****************************************************************************/
 
-	option := &corev1.PodExecOptions{
-		Command:   command,
-		Stdout:    true,
-		Stderr:    true,
-		TTY:       true,
-	}
+/*
+ * The following function is used to execute a command on the specified
+ * pod, returning the output of the command.
+ */
 
-	request := kubeClient.
-		CoreV1().
-		RESTClient().
-		Post().
-		Resource("pods").
-		Namespace(h.directory.Namespace).
-		Name(pod).
-		SubResource("exec").
-		VersionedParams(option, scheme.ParameterCodec).Timeout(
-								120 * time.Second)
+func (r *IBMSecurityVerifyDirectoryReconciler) executeCommandWithOutput(
+				h       *RequestHandle,
+				pod     string,
+				command []string) (string, error) {
 
-	/*
-	 * Execute the command.
-	 */
+	result, err := r.executeCommandWithResult(h, pod, command)
 
-	exec, err := remotecommand.NewSPDYExecutor(
-								kubeConfig, "POST", request.URL())
-	if err != nil {
-		r.Log.Error(err, "Failed to execute a command!", 
-				r.createLogParams(h, "command", command)...)
+	return result.Stdout, err
+}
 
-		return err
-	}
+/*****************************************************************************/
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
 
-	if err := exec.Stream(remotecommand.StreamOptions{
-					Stdout: &stdout, Stderr: &stderr}); err != nil {
-		r.Log.Error(err, "Failed to execute a command!", 
-				r.createLogParams(h, "command", command, 
-					"stdout", stdout.String(), "stderr", stderr.String())...)
 
-		return err
-	}
+/*
+ * The following function is used to construct the affinity which schedules
+ * a pod in the specified zone.  Nil is returned if no zone is specified.
+ */
 
-	r.Log.V(1).Info("Command Results", 
-			r.createLogParams(h, "Pod", pod, "Command", command,
-				"stdout", stdout.String(), "stderr", stderr.String())...)
+func (r *IBMSecurityVerifyDirectoryReconciler) getZoneAffinity(
+				zone string) *corev1.Affinity {
 
-	return nil
+	if zone == "" {
+		return nil
+	}
+
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: 
+								&corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key:      utils.ZoneLabel,
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   []string{zone},
+					}},
+				}},
+			},
+		},
+	}
 }
 
 /*****************************************************************************/
 
-
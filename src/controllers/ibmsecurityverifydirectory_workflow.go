@@ -0,0 +1,886 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the functions which are used by the controller to manage
+ * the deployment workflow.  The workflow is modelled as a series of phases,
+ * with the current phase being persisted in the status of the document.  Each
+ * reconciliation will advance the workflow by at most a single phase, and
+ * a phase which is waiting on a resource will requeue the request rather
+ * than blocking the worker.
+ */
+
+/*****************************************************************************/
+
+import (
+	metav1  "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/ibm-security/verify-directory-operator/utils"
+
+	ctrl  "sigs.k8s.io/controller-runtime"
+	ibmv1 "github.com/ibm-security/verify-directory-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the current generation
+ * of the document has already been fully processed by a workflow.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isDocumentProcessed(
+			h *RequestHandle) bool {
+
+	condition := meta.FindStatusCondition(
+						h.directory.Status.Conditions, "Available")
+
+	return condition != nil && 
+			condition.Status == metav1.ConditionTrue &&
+			condition.ObservedGeneration == h.directory.Generation
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to bring the deployment back in line with
+ * the document when no workflow is required.  This will recreate any replica
+ * or service which has been deleted, will regenerate the proxy 
+ * configuration and deployment, restarting the proxy if the configuration
+ * has changed, and will create or update the backup CronJob.  Each of these
+ * operations is a no-op if the resource already matches the document.  It
+ * will then check the results of the backups and, at most once in each
+ * health check interval, repair the replication topology and check the
+ * health of the replication agreements and the storage usage of the 
+ * replicas.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) convergeDeployment(
+			h *RequestHandle) (ctrl.Result, error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "convergeDeployment")...)
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		err := r.startReplica(h, pvcName)
+
+		if err != nil {
+			r.setCondition(err, h, "Failed to restore the replica.")
+
+			return r.getRetryResult(h), nil
+		}
+	}
+
+	err := r.deployProxy(h)
+
+	if err != nil {
+		r.setCondition(err, h, "Failed to restore the proxy.")
+
+		return r.getRetryResult(h), nil
+	}
+
+	err = r.deployBackup(h)
+
+	if err != nil {
+		r.setCondition(err, h, "Failed to deploy the backup CronJob.")
+
+		return r.getRetryResult(h), nil
+	}
+
+	/*
+	 * Check the results of the backups, and bring the observed state of the
+	 * deployment up to date.  The checks of the topology, replication 
+	 * health and storage usage need to contact each of the replicas, and 
+	 * so they are only performed once the health check interval has elapsed
+	 * since the last check.  This means that a reconcile which has been 
+	 * triggered by an event will only restore the missing resources.  We
+	 * requeue the request so that the checks are performed periodically.
+	 */
+
+	original := h.directory.Status.DeepCopy()
+	delay    := HealthCheckInterval
+	last     := h.directory.Status.LastTopologyCheckTime
+
+	if last == nil || time.Since(last.Time) >= HealthCheckInterval {
+		r.checkTopology(h)
+		r.checkReplicationHealth(h)
+		r.checkStorage(h)
+	} else {
+		delay = HealthCheckInterval - time.Since(last.Time)
+	}
+
+	r.checkBackups(h)
+
+	err = r.saveStatus(h, original)
+
+	if err != nil {
+		return ctrl.Result{RequeueAfter: RequeueDelay}, nil
+	}
+
+	return ctrl.Result{RequeueAfter: delay}, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to start a new workflow.  It will work out
+ * the replicas which are to be added and deleted, and the principal which is
+ * to be used, and then save this information in the status of the document
+ * so that the workflow can be resumed if the operator is restarted.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) startWorkflow(
+			h *RequestHandle) error {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "startWorkflow")...)
+
+	/*
+	 * Create any PVCs which are to be created by the operator, so that they
+	 * are available to the new replicas.
+	 */
+
+	err := r.deployReplicaPVCs(h)
+
+	if err != nil {
+		return err
+	}
+
+	err = r.deploySeedPVCs(h)
+
+	if err != nil {
+		return err
+	}
+
+	/*
+	 * Retrieve the list of existing pods for the deployment.
+	 */
+
+	existing, err := r.getExistingPods(h)
+
+	if err != nil {
+		return err
+	}
+
+	r.Log.Info("Existing pods", r.createLogParams(h, "Pods", existing)...)
+
+	/*
+	 * Work out the list of replicas to be deleted, and the list of
+	 * replicas to be added.
+	 */
+
+	toBeDeleted, toBeAdded := r.analyseExistingPods(h, existing)
+
+	/*
+	 * Any seed job which has been left behind by a previous workflow is
+	 * deleted, as the new replicas need to be seeded with the current data.
+	 */
+
+	for _, pvcName := range toBeAdded {
+		err = r.deleteJob(h, r.getSeedJobName(h.directory, pvcName))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	/*
+	 * Work out the list of existing replicas which need to be updated to
+	 * match the current document (e.g. a new image label).
+	 */
+
+	toBeUpdated, err := r.getReplicasToUpdate(h, existing)
+
+	if err != nil {
+		return err
+	}
+
+	r.Log.Info("Updates required",
+		r.createLogParams(h,
+			"to be deleted", toBeDeleted,
+			"to be added", toBeAdded,
+			"to be updated", toBeUpdated)...)
+
+	/*
+	 * Work out the principal, and the first phase of the workflow.  If we
+	 * have any existing replicas a healthy existing replica will be the
+	 * principal, otherwise one of the new replicas will be the principal
+	 * and will need to be created.
+	 */
+
+	var principal string
+
+	phase := ibmv1.PhaseDeployingProxy
+	inUse := len(toBeAdded) < len(h.directory.Spec.Replicas.PVCs)
+
+	if len(toBeAdded) > 0 {
+		if len(toBeAdded) < len(h.directory.Spec.Replicas.PVCs) {
+			principal, err = r.selectPrincipal(h, toBeAdded)
+
+			if err != nil {
+				return err
+			}
+
+			/*
+			 * Ensure that each of the new replicas is large enough to hold
+			 * the data of the principal before the workflow is started.  
+			 * The replicas cannot be changed once a workflow phase has 
+			 * failed, and so the check is made here, where a failure can 
+			 * be corrected by removing the replica or replacing its PVC.
+			 */
+
+			err = r.checkSeedCapacity(h, principal, toBeAdded)
+
+			if err != nil {
+				return err
+			}
+
+			phase = ibmv1.PhaseCreatingAgreements
+		} else {
+			principal = toBeAdded[0]
+
+			pinned := h.directory.Spec.Replicas.Principal
+
+			if pinned != "" && utils.Contains(toBeAdded, pinned) {
+				principal = pinned
+			}
+
+			toBeAdded = utils.Remove(toBeAdded, principal)
+
+			phase = ibmv1.PhaseCreatingPrincipal
+
+			/*
+			 * A new deployment is cloned from the source document, if one
+			 * has been specified, before the principal is created.  A 
+			 * backup, on the other hand, is restored once the principal has
+			 * been created.  This is only ever done once.
+			 */
+
+			if h.directory.Spec.CloneFrom != "" &&
+						h.directory.Status.CloneTime == nil {
+				phase = ibmv1.PhaseBackingUpSource
+			}
+		}
+
+		r.Log.Info("Using a principal.",
+				r.createLogParams(h, "Principal", principal)...)
+
+		h.directory.Status.Principal = principal
+	}
+
+	/*
+	 * Any existing replicas which need to be updated are updated before
+	 * we add any new replicas, so that the new replicas are seeded from 
+	 * a principal which is running the current image.
+	 */
+
+	if len(toBeUpdated) > 0 {
+		phase = ibmv1.PhaseUpdatingReplicas
+	}
+
+	/*
+	 * Any PVCs which are smaller than the storage size are expanded before
+	 * the replicas are updated or seeded, so that the replicas have the
+	 * additional space available.  If none of the existing replicas are 
+	 * being kept the PVCs are not in use, and so we just request the new 
+	 * size and leave the file systems to be resized when the volumes are
+	 * first mounted.
+	 */
+
+	toBeExpanded, err := r.getVolumesToExpand(h)
+
+	if err != nil {
+		return err
+	}
+
+	if len(toBeExpanded) > 0 && !inUse {
+		for _, volume := range toBeExpanded {
+			err = r.expandVolume(h, volume.PVC, volume.Requested)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		toBeExpanded = nil
+	}
+
+	if len(toBeExpanded) > 0 {
+		phase = ibmv1.PhaseExpandingVolumes
+	}
+
+	/*
+	 * Mark the deployment as in-progress.
+	 */
+
+	condition := metav1.Condition{
+		Type:    "InProgress",
+		Reason:  "DeploymentProgress",
+		Message: "The deployment is being processed.",
+		Status:  metav1.ConditionTrue,
+	}
+
+	meta.SetStatusCondition(&h.directory.Status.Conditions, condition)
+
+	h.directory.Status.ReplicasToAdd    = toBeAdded
+	h.directory.Status.ReplicasToUpdate = toBeUpdated
+	h.directory.Status.ReplicasToDelete = toBeDeleted
+	h.directory.Status.SeededReplicas   = nil
+	h.directory.Status.VolumesToExpand  = toBeExpanded
+	h.directory.Status.TargetVersion    = h.directory.Spec.Pods.Image.Label
+
+	h.directory.Status.WorkflowGeneration = h.directory.Generation
+
+	return r.setPhase(h, phase)
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to process the current phase of the
+ * workflow.  If the phase completes the workflow will be moved on to the next
+ * phase and the request requeued, otherwise the request will be requeued so
+ * that the phase can be checked again a little later.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) processPhase(
+			h *RequestHandle) (ctrl.Result, error) {
+
+	phase := h.directory.Status.Phase
+
+	r.Log.Info("Processing a workflow phase",
+				r.createLogParams(h, "Phase", phase)...)
+
+	var next ibmv1.IBMSecurityVerifyDirectoryPhase
+	var err  error
+
+	switch phase {
+		case ibmv1.PhaseExpandingVolumes:
+			next, err = r.expandVolumes(h)
+
+		case ibmv1.PhaseUpdatingReplicas:
+			next, err = r.updateReplicas(h)
+
+		case ibmv1.PhaseRestoringPrincipal:
+			next, err = r.restorePrincipal(h)
+
+		case ibmv1.PhaseBackingUpSource:
+			next, err = r.backupSource(h)
+
+		case ibmv1.PhaseCloningReplicas:
+			next, err = r.cloneReplicas(h)
+
+		case ibmv1.PhaseCreatingPrincipal:
+			next, err = r.createPrincipal(h)
+
+		case ibmv1.PhaseCreatingAgreements:
+			next, err = r.createPrincipalAgreements(h)
+
+		case ibmv1.PhaseBackingUpPrincipal:
+			next, err = r.backupPrincipal(h)
+
+		case ibmv1.PhaseStoppingPrincipal:
+			next, err = r.stopPrincipal(h)
+
+		case ibmv1.PhaseSeedingReplicas:
+			next, err = r.seedReplicas(h)
+
+		case ibmv1.PhaseStartingReplicas:
+			next, err = r.startReplicas(h)
+
+		case ibmv1.PhaseConfiguringReplicas:
+			next, err = r.configureReplicas(h)
+
+		case ibmv1.PhaseStartingPrincipal:
+			next, err = r.startPrincipal(h)
+
+		case ibmv1.PhaseDeployingProxy:
+			err  = r.deployProxy(h)
+			next = ibmv1.PhaseDeletingReplicas
+
+		case ibmv1.PhaseDeletingReplicas:
+			next, err = r.deleteReplicas(h)
+
+		default:
+			err = errors.New(
+				fmt.Sprintf("The workflow phase, %s, is not known.", phase))
+	}
+
+	if err != nil {
+		r.setCondition(err, h,
+			fmt.Sprintf("Failed to process the %s workflow phase.", phase))
+
+		return r.getRetryResult(h), nil
+	}
+
+	/*
+	 * If the phase has not yet completed we requeue the request so that
+	 * we can check on the progress of the phase a little later.
+	 */
+
+	if next == phase {
+		r.Log.V(1).Info("The workflow phase is still in progress",
+				r.createLogParams(h, "Phase", phase)...)
+
+		return ctrl.Result{RequeueAfter: RequeueDelay}, nil
+	}
+
+	r.observePhaseDuration(h)
+
+	/*
+	 * If the workflow has completed we can clear out the workflow
+	 * information and set the condition of the document.
+	 */
+
+	if next == ibmv1.PhaseReady {
+		r.Log.Info("Reconciled the document", r.createLogParams(h)...)
+
+		now := metav1.Now()
+
+		h.directory.Status.Phase            = ibmv1.PhaseReady
+		h.directory.Status.PhaseStartTime   = &now
+		h.directory.Status.ReplicasToAdd    = nil
+		h.directory.Status.ReplicasToUpdate = nil
+		h.directory.Status.ReplicasToDelete = nil
+		h.directory.Status.SeededReplicas   = nil
+		h.directory.Status.VolumesToExpand  = nil
+		h.directory.Status.CloneSource      = ""
+		h.directory.Status.ClonedReplicas   = nil
+		h.directory.Status.CurrentVersion   = h.directory.Status.TargetVersion
+		h.directory.Status.TargetVersion    = ""
+
+		if err := r.refreshStatus(h); err != nil {
+			return ctrl.Result{RequeueAfter: RequeueDelay}, nil
+		}
+
+		r.setCondition(nil, h, "")
+
+		r.recordEvent(h, EventReconciled, "The deployment has been reconciled.")
+
+		/*
+		 * If the document was changed while the workflow was running we
+		 * requeue the request so that the changes are processed by a new
+		 * workflow.
+		 */
+
+		if ! r.isDocumentProcessed(h) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	/*
+	 * Move on to the next phase of the workflow.
+	 */
+
+	err = r.setPhase(h, next)
+
+	if err != nil {
+		return ctrl.Result{RequeueAfter: RequeueDelay}, nil
+	}
+
+	return ctrl.Result{Requeue: true}, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to move the workflow to the specified
+ * phase.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) setPhase(
+			h     *RequestHandle,
+			phase ibmv1.IBMSecurityVerifyDirectoryPhase) error {
+
+	r.Log.Info("Moving to a new workflow phase",
+				r.createLogParams(h, "Phase", phase)...)
+
+	now := metav1.Now()
+
+	/*
+	 * If we are moving on to a new phase any failure of the previous phase
+	 * has now been recovered.
+	 */
+
+	if h.directory.Status.Phase != phase {
+		h.directory.Status.RetryCount = 0
+	}
+
+	h.directory.Status.Phase          = phase
+	h.directory.Status.PhaseStartTime = &now
+
+	if err := r.refreshStatus(h); err != nil {
+		return err
+	}
+
+	if err := r.Status().Update(h.ctx, h.directory); err != nil {
+		r.Log.Error(err, "Failed to update the phase for the resource",
+						r.createLogParams(h, "Phase", phase)...)
+
+		return err
+	}
+
+	r.recordEvent(h, EventPhaseStarted, 
+				"The %s phase of the workflow has started.", phase)
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether the current phase has
+ * been running for longer than the specified amount of time.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) hasPhaseTimedOut(
+			h     *RequestHandle,
+			limit time.Duration) bool {
+
+	start := h.directory.Status.PhaseStartTime
+
+	return start != nil && time.Since(start.Time) > limit
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to calculate the amount of time to wait
+ * before the next retry of a failed phase.  The delay is doubled for each
+ * consecutive failure, up to a maximum delay.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getRetryDelay(
+			retryCount int32) time.Duration {
+
+	delay := RetryDelay
+
+	for idx := int32(1); idx < retryCount && delay < MaxRetryDelay; idx++ {
+		delay = delay * 2
+	}
+
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+
+	return delay
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to construct the result which is returned
+ * from a reconciliation which has failed.  The request will be requeued so
+ * that it is processed again when the next retry is due.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getRetryResult(
+			h *RequestHandle) ctrl.Result {
+
+	nextRetry := h.directory.Status.NextRetryTime
+
+	if nextRetry == nil {
+		return ctrl.Result{RequeueAfter: RetryDelay}
+	}
+
+	delay := time.Until(nextRetry.Time)
+
+	if delay <= 0 {
+		return ctrl.Result{Requeue: true}
+	}
+
+	return ctrl.Result{RequeueAfter: delay}
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to determine whether a failed document is
+ * due to be retried.  A retry is due if the retry delay has expired, or if
+ * the document has been updated since the failure occurred.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) isRetryDue(
+			h *RequestHandle) bool {
+
+	nextRetry := h.directory.Status.NextRetryTime
+
+	if nextRetry == nil || ! time.Now().Before(nextRetry.Time) {
+		return true
+	}
+
+	condition := meta.FindStatusCondition(
+						h.directory.Status.Conditions, "Available")
+
+	return condition != nil && 
+				condition.ObservedGeneration != h.directory.Generation
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to start the retry of a failed phase.  The
+ * scheduled retry is cleared, and the start time of the phase is reset so 
+ * that the phase is given the full amount of time to complete.  Each of the
+ * phases is idempotent and so it is safe to simply process the failed phase
+ * again.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) startRetry(
+			h *RequestHandle) error {
+
+	/*
+	 * If there is no retry scheduled the retry has already been started.
+	 */
+
+	if h.directory.Status.NextRetryTime == nil {
+		return nil
+	}
+
+	r.Log.Info("Retrying the failed workflow phase",
+				r.createLogParams(h, 
+					"Phase",       h.directory.Status.Phase,
+					"Retry.Count", h.directory.Status.RetryCount)...)
+
+	/*
+	 * Any seed or restore jobs which have failed need to be deleted so that
+	 * they will be recreated when the phase is processed again.
+	 */
+
+	if h.directory.Status.Phase == ibmv1.PhaseSeedingReplicas {
+		for _, pvcName := range h.directory.Status.ReplicasToAdd {
+			err := r.deleteFailedJob(h, r.getSeedJobName(h.directory, pvcName))
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if h.directory.Status.Phase == ibmv1.PhaseCloningReplicas {
+		replicas := append([]string{h.directory.Status.Principal},
+							h.directory.Status.ReplicasToAdd...)
+
+		for _, pvcName := range replicas {
+			err := r.deleteFailedJob(h, r.getSeedJobName(h.directory, pvcName))
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if h.directory.Status.Phase == ibmv1.PhaseRestoringPrincipal {
+		err := r.deleteFailedJob(h, 
+				r.getRestoreJobName(h.directory, h.directory.Status.Principal))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	/*
+	 * A failed backup of the principal, or of the source of a clone, needs
+	 * to be removed so that the backup will be taken again when the phase
+	 * is processed again.
+	 */
+
+	if h.directory.Status.Phase == ibmv1.PhaseBackingUpPrincipal {
+		err := r.removeSeedBackup(h, h.directory.Status.Principal)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if h.directory.Status.Phase == ibmv1.PhaseBackingUpSource {
+		err := r.removeCloneBackup(h)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	now := metav1.Now()
+
+	h.directory.Status.NextRetryTime  = nil
+	h.directory.Status.PhaseStartTime = &now
+
+	if err := r.Status().Update(h.ctx, h.directory); err != nil {
+		r.Log.Error(err, "Failed to update the retry status for the resource",
+						r.createLogParams(h)...)
+
+		return err
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to select the principal from the existing
+ * replicas.  The principal specified in the document is preferred, followed
+ * by the principal which was used by the previous workflow, followed by the
+ * existing replicas in the order in which they appear in the document.  The
+ * first of these replicas which is currently healthy will be selected.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) selectPrincipal(
+			h         *RequestHandle,
+			toBeAdded []string) (string, error) {
+
+	r.Log.V(1).Info("Entering a function",
+				r.createLogParams(h, "Function", "selectPrincipal")...)
+
+	/*
+	 * If the new replicas are being added to a replication domain which 
+	 * already contains replicas the principal must come from that domain,
+	 * as the new replicas are seeded from the principal.
+	 */
+
+	domain, err := r.getSeedDomain(h, toBeAdded)
+
+	if err != nil {
+		return "", err
+	}
+
+	/*
+	 * Build up the ordered list of candidates.
+	 */
+
+	var candidates []string
+
+	for _, pvcName := range h.directory.Spec.Replicas.PVCs {
+		if utils.Contains(toBeAdded, pvcName) {
+			continue
+		}
+
+		if domain == nil || utils.Contains(domain, pvcName) {
+			candidates = append(candidates, pvcName)
+		}
+	}
+
+	preferred := []string{
+		h.directory.Spec.Replicas.Principal,
+		h.directory.Status.Principal,
+	}
+
+	for idx := len(preferred) - 1; idx >= 0; idx-- {
+		if utils.Contains(candidates, preferred[idx]) {
+			candidates = append([]string{preferred[idx]},
+							utils.Remove(candidates, preferred[idx])...)
+		}
+	}
+
+	/*
+	 * Select the first healthy candidate.
+	 */
+
+	for _, pvcName := range candidates {
+		healthy, err := r.isReplicaHealthy(h, pvcName)
+
+		if err != nil {
+			return "", err
+		}
+
+		if healthy {
+			if pvcName != candidates[0] {
+				r.Log.Info("The preferred principal is not available, " +
+						"failing over to another replica.",
+						r.createLogParams(h, "Preferred", candidates[0],
+								"Principal", pvcName)...)
+			}
+
+			return pvcName, nil
+		}
+
+		r.Log.Info("A replica is not healthy and cannot be the principal.",
+				r.createLogParams(h, "PVC.Name", pvcName)...)
+	}
+
+	return "", errors.New("None of the existing replicas are currently " +
+						"healthy and so a principal cannot be selected.")
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to work out the replication domain to
+ * which the specified new replicas are being added.  Nil is returned if none
+ * of the new replicas belong to a domain which already contains replicas.
+ * An error is returned if the new replicas are being added to more than one
+ * domain which already contains replicas, as each of these domains would
+ * need to be seeded from a different principal.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getSeedDomain(
+			h         *RequestHandle,
+			toBeAdded []string) (domain []string, err error) {
+
+	for _, pvcName := range toBeAdded {
+		candidate := h.directory.Spec.GetReplicationDomain(pvcName)
+		existing  := false
+
+		for _, member := range candidate {
+			if ! utils.Contains(toBeAdded, member) {
+				existing = true
+			}
+		}
+
+		if !existing {
+			continue
+		}
+
+		if domain != nil && domain[0] != candidate[0] {
+			return nil, errors.New(fmt.Sprintf("The new replicas are being " +
+				"added to more than one partition which already contains " +
+				"replicas (%s and %s).  Replicas can only be added to a " +
+				"single existing partition at a time.", 
+				h.directory.Spec.GetReplicaGroup(domain[0]),
+				h.directory.Spec.GetReplicaGroup(candidate[0])))
+		}
+
+		domain = candidate
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to work out the replica which acts as the
+ * principal of the replication domain of the specified replica.  This is
+ * the principal of the deployment if the principal is in the same domain,
+ * otherwise it is the first replica of the domain.
+ */
+
+func (r *IBMSecurityVerifyDirectoryReconciler) getDomainPrincipal(
+			h       *RequestHandle,
+			pvcName string) string {
+
+	principal := h.directory.Status.Principal
+	domain    := h.directory.Spec.GetReplicationDomain(pvcName)
+
+	if principal != "" && utils.Contains(domain, principal) {
+		return principal
+	}
+
+	return domain[0]
+}
+
+/*****************************************************************************/
+
@@ -82,10 +82,19 @@ func main() {
 
 	utils.K8sClient = mgr.GetClient()
 
+	executor, err := controllers.NewClusterPodExecutor(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create the pod executor")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.IBMSecurityVerifyDirectoryReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("IBMSecurityVerifyDirectory"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("IBMSecurityVerifyDirectory"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("verify-directory-operator"),
+		Executor: executor,
+		Resolver: controllers.NewClusterPodResolver(mgr.GetClient()),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IBMSecurityVerifyDirectory")
 		os.Exit(1)
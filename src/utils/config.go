@@ -0,0 +1,422 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package utils
+
+/*
+ * This file contains the typed model of the server and proxy configuration
+ * YAML which is used by both the controller and the Web hook.  Only the
+ * configuration entries which are of interest to the operator are modelled,
+ * and each accessor function will return a precise error if the
+ * configuration entry is missing or incorrect.
+ */
+
+/*****************************************************************************/
+
+import (
+	"fmt"
+
+	"github.com/go-yaml/yaml"
+)
+
+/*****************************************************************************/
+
+/*
+ * The default ports which are used by the server and proxy, along with the
+ * default administrator DN.
+ */
+
+const DefaultLdapPort  int32 = 9389
+const DefaultLdapsPort int32 = 9636
+const DefaultAdminDn         = "cn=root"
+
+/*****************************************************************************/
+
+/*
+ * The error which is returned when a configuration entry is missing or
+ * incorrect.  The entry is the full name of the configuration entry (e.g.
+ * general.ports.ldap).
+ */
+
+type ConfigError struct {
+	Entry   string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("The %s configuration entry %s.", e.Entry, e.Message)
+}
+
+/*****************************************************************************/
+
+/*
+ * The typed model of the configuration.  The leaf values are left as
+ * generic values as they may contain either a literal value or a reference
+ * to a secret (e.g. secret:<name>/<key>), and so they are validated by the
+ * accessor functions rather than when the YAML is unmarshalled.
+ */
+
+type PortsConfig struct {
+	Ldap  interface{} `yaml:"ldap"`
+	Ldaps interface{} `yaml:"ldaps"`
+}
+
+type LicenseConfig struct {
+	Accept interface{} `yaml:"accept"`
+	Key    interface{} `yaml:"key"`
+}
+
+type AdminConfig struct {
+	Dn  interface{} `yaml:"dn"`
+	Pwd interface{} `yaml:"pwd"`
+}
+
+type GeneralConfig struct {
+	Ports   PortsConfig   `yaml:"ports"`
+	License LicenseConfig `yaml:"license"`
+	Admin   AdminConfig   `yaml:"admin"`
+}
+
+type ServerConfig struct {
+	Suffixes interface{} `yaml:"suffixes"`
+}
+
+type Config struct {
+	General GeneralConfig          `yaml:"general"`
+	Server  ServerConfig           `yaml:"server"`
+	Proxy   map[string]interface{} `yaml:"proxy"`
+}
+
+/*****************************************************************************/
+
+/*
+ * The typed model of the proxy configuration entries which are generated by
+ * the operator.  The entries are marshalled as JSON, and so the fields will
+ * always be generated in the order in which they are declared.
+ */
+
+type ProxyUser struct {
+	Dn       string `json:"dn"`
+	Password string `json:"password"`
+}
+
+type ProxyServer struct {
+	Name   string    `json:"name"`
+	Id     string    `json:"id"`
+	Target string    `json:"target"`
+	User   ProxyUser `json:"user"`
+}
+
+type ProxyServerGroup struct {
+	Name       string        `json:"name"`
+	Weight     int           `json:"weight,omitempty"`
+	Preference int           `json:"preference,omitempty"`
+	Servers    []ProxyServer `json:"servers"`
+}
+
+type ProxySuffixServer struct {
+	Name           string `json:"name"`
+	PartitionIndex int    `json:"partition-index,omitempty"`
+}
+
+type ProxySuffix struct {
+	Base          string              `json:"base"`
+	Name          string              `json:"name"`
+	NumPartitions int                 `json:"num-partitions,omitempty"`
+	Servers       []ProxySuffixServer `json:"servers"`
+}
+
+/*****************************************************************************/
+
+/*
+ * Parse the specified configuration YAML into the typed model.
+ */
+
+func ParseConfig(data string) (config *Config, err error) {
+	config = &Config{}
+
+	if err = yaml.Unmarshal([]byte(data), config); err != nil {
+		return nil, &ConfigError{
+			Entry:   "YAML",
+			Message: fmt.Sprintf("could not be parsed: %s", err.Error()),
+		}
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the port which is used to communicate with the server, and
+ * whether the port is secure.  The LDAP port is used unless it has been
+ * disabled by setting the port to 0, in which case the LDAPS port is used.
+ */
+
+func (c *Config) GetPort(namespace string) (port int32, secure bool, err error) {
+	port = DefaultLdapPort
+
+	if c.General.Ports.Ldap != nil {
+		port, err = getPortValue(
+				"general.ports.ldap", c.General.Ports.Ldap, namespace)
+
+		if err != nil || port != 0 {
+			return
+		}
+
+		/*
+		 * The LDAP port has been disabled and so we need to use the LDAPS
+		 * port.
+		 */
+
+		secure = true
+		port   = DefaultLdapsPort
+
+		if c.General.Ports.Ldaps != nil {
+			port, err = getPortValue(
+					"general.ports.ldaps", c.General.Ports.Ldaps, namespace)
+
+			if err == nil && port == 0 {
+				err = &ConfigError{
+					Entry:   "general.ports.ldaps",
+					Message: "cannot be 0 when general.ports.ldap is also 0",
+				}
+			}
+		}
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the license key.  The key is not resolved as it is passed
+ * unchanged to the containers.
+ */
+
+func (c *Config) GetLicenseKey() (string, error) {
+	return getStringValue("general.license.key", c.General.License.Key,
+							false, "")
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the DN of the administrator.  The DN will default to cn=root if
+ * it has not been specified.
+ */
+
+func (c *Config) GetAdminDn(resolve bool, namespace string) (string, error) {
+	if c.General.Admin.Dn == nil {
+		return DefaultAdminDn, nil
+	}
+
+	return getStringValue("general.admin.dn", c.General.Admin.Dn,
+							resolve, namespace)
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the password of the administrator.
+ */
+
+func (c *Config) GetAdminPwd(resolve bool, namespace string) (string, error) {
+	return getStringValue("general.admin.pwd", c.General.Admin.Pwd,
+							resolve, namespace)
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the DN of each of the suffixes which are defined in the
+ * server.suffixes configuration entry.
+ */
+
+func (c *Config) GetSuffixes() (suffixes []string, err error) {
+	if c.Server.Suffixes == nil {
+		return nil, &ConfigError{
+			Entry:   "server.suffixes",
+			Message: "is missing",
+		}
+	}
+
+	entries, ok := c.Server.Suffixes.([]interface{})
+
+	if !ok {
+		return nil, &ConfigError{
+			Entry:   "server.suffixes",
+			Message: fmt.Sprintf("must be a list of suffixes, but a value " +
+						"of type %T was found", c.Server.Suffixes),
+		}
+	}
+
+	for idx, entry := range entries {
+		name := fmt.Sprintf("server.suffixes[%d].dn", idx)
+
+		/*
+		 * The entry is not converted with ConvertYaml, as the keys of the
+		 * entry are not guaranteed to be strings.
+		 */
+
+		var value interface{}
+
+		switch suffix := entry.(type) {
+			case map[interface{}]interface{}:
+				value = suffix["dn"]
+
+			case map[string]interface{}:
+				value = suffix["dn"]
+
+			default:
+				return nil, &ConfigError{
+					Entry:   fmt.Sprintf("server.suffixes[%d]", idx),
+					Message: fmt.Sprintf("must contain a dn entry, but a " +
+							"value of type %T was found", entry),
+				}
+		}
+
+		dn, err := getStringValue(name, value, false, "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		suffixes = append(suffixes, dn)
+	}
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * Determine whether the specified proxy configuration entry (e.g. suffixes)
+ * has been defined.
+ */
+
+func (c *Config) HasProxyEntry(entry string) bool {
+	_, ok := c.Proxy[entry]
+
+	return ok
+}
+
+/*****************************************************************************/
+
+/*
+ * Validate the configuration entries which are required by the server.
+ */
+
+func (c *Config) ValidateServer(namespace string) (err error) {
+	if _, _, err = c.GetPort(namespace); err != nil {
+		return
+	}
+
+	if _, err = c.GetLicenseKey(); err != nil {
+		return
+	}
+
+	if _, err = c.GetAdminDn(false, namespace); err != nil {
+		return
+	}
+
+	if _, err = c.GetAdminPwd(false, namespace); err != nil {
+		return
+	}
+
+	_, err = c.GetSuffixes()
+
+	return
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the value of a port configuration entry.
+ */
+
+func getPortValue(
+				name      string,
+				value     interface{},
+				namespace string) (int32, error) {
+
+	value = ResolveEntry(value, namespace)
+
+	if value == nil {
+		return 0, &ConfigError{
+			Entry:   name,
+			Message: "references a secret which could not be resolved",
+		}
+	}
+
+	port, ok := value.(int)
+
+	if !ok {
+		return 0, &ConfigError{
+			Entry:   name,
+			Message: fmt.Sprintf("must be an integer, but a value of type " +
+						"%T was found", value),
+		}
+	}
+
+	if port < 0 || port > 65535 {
+		return 0, &ConfigError{
+			Entry:   name,
+			Message: fmt.Sprintf("must be between 0 and 65535, but %d " +
+						"was found", port),
+		}
+	}
+
+	return int32(port), nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the value of a string configuration entry, optionally resolving
+ * any secret reference.  An error is returned if the entry is missing.
+ */
+
+func getStringValue(
+				name      string,
+				value     interface{},
+				resolve   bool,
+				namespace string) (string, error) {
+
+	if value == nil {
+		return "", &ConfigError{
+			Entry:   name,
+			Message: "is missing",
+		}
+	}
+
+	if resolve {
+		value = ResolveEntry(value, namespace)
+
+		if value == nil {
+			return "", &ConfigError{
+				Entry:   name,
+				Message: "references a secret which could not be resolved",
+			}
+		}
+	}
+
+	str, ok := value.(string)
+
+	if !ok {
+		return "", &ConfigError{
+			Entry:   name,
+			Message: fmt.Sprintf("must be a string, but a value of type " +
+						"%T was found", value),
+		}
+	}
+
+	return str, nil
+}
+
+/*****************************************************************************/
+
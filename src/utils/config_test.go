@@ -0,0 +1,174 @@
+/* vi: set ts=4 sw=4 noexpandtab : */
+
+/*
+ * Copyright contributors to the IBM Security Verify Directory Operator project
+ */
+
+package utils
+
+/*
+ * This file contains the tests for the typed model of the server and proxy
+ * configuration.
+ */
+
+/*****************************************************************************/
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+/*
+ * A valid server configuration, to which each of the tests appends a
+ * modified entry.
+ */
+
+const testLicense = "general:\n" +
+	"  license:\n" +
+	"    accept: limited\n" +
+	"    key: license-key\n"
+
+const testAdmin = "  admin:\n" +
+	"    pwd: passw0rd\n"
+
+const testSuffixes = "server:\n" +
+	"  suffixes:\n" +
+	"    - dn: o=sample\n"
+
+/*****************************************************************************/
+
+var _ = Describe("ValidateServer", func() {
+	DescribeTable("returns a configuration error rather than panicking",
+		func(data string, message string) {
+			var err error
+
+			Expect(func() {
+				var config *Config
+
+				config, err = ParseConfig(data)
+
+				if err == nil {
+					err = config.ValidateServer("default")
+				}
+			}).NotTo(Panic())
+
+			if message == "" {
+				Expect(err).NotTo(HaveOccurred())
+
+				return
+			}
+
+			var configErr *ConfigError
+
+			Expect(err).To(BeAssignableToTypeOf(configErr))
+			Expect(err.Error()).To(ContainSubstring(message))
+		},
+
+		Entry("a valid configuration",
+			testLicense + testAdmin + testSuffixes, ""),
+
+		Entry("YAML which cannot be parsed",
+			"general: [", "The YAML configuration entry could not be parsed"),
+
+		Entry("a general entry which is not a map",
+			"general: 5\n" + testSuffixes,
+			"The YAML configuration entry could not be parsed"),
+
+		Entry("a proxy entry which is not a map",
+			testLicense + testAdmin + testSuffixes + "proxy: [1, 2]\n",
+			"The YAML configuration entry could not be parsed"),
+
+		Entry("a port which is not an integer",
+			testLicense + testAdmin + "  ports:\n    ldap: abc\n" +
+			testSuffixes, "general.ports.ldap configuration entry must be " +
+			"an integer"),
+
+		Entry("a port which is out of range",
+			testLicense + testAdmin + "  ports:\n    ldap: 70000\n" +
+			testSuffixes, "general.ports.ldap configuration entry must be " +
+			"between 0 and 65535"),
+
+		Entry("a port which is a map",
+			testLicense + testAdmin + "  ports:\n    ldap: {a: 1}\n" +
+			testSuffixes, "general.ports.ldap configuration entry must be " +
+			"an integer"),
+
+		Entry("both ports disabled",
+			testLicense + testAdmin +
+			"  ports:\n    ldap: 0\n    ldaps: 0\n" + testSuffixes,
+			"general.ports.ldaps configuration entry cannot be 0"),
+
+		Entry("a missing license key",
+			"general:\n  license:\n    accept: limited\n" + testAdmin +
+			testSuffixes, "general.license.key configuration entry is missing"),
+
+		Entry("a license key which is a list",
+			"general:\n  license:\n    key: [a, b]\n" + testAdmin +
+			testSuffixes, "general.license.key configuration entry must be " +
+			"a string"),
+
+		Entry("a missing administrator password",
+			testLicense + testSuffixes,
+			"general.admin.pwd configuration entry is missing"),
+
+		Entry("an administrator DN which is an integer",
+			testLicense + testAdmin + "    dn: 5\n" + testSuffixes,
+			"general.admin.dn configuration entry must be a string"),
+
+		Entry("missing suffixes",
+			testLicense + testAdmin,
+			"server.suffixes configuration entry is missing"),
+
+		Entry("suffixes which are not a list",
+			testLicense + testAdmin + "server:\n  suffixes: o=sample\n",
+			"server.suffixes configuration entry must be a list"),
+
+		Entry("a suffix which is not a map",
+			testLicense + testAdmin + "server:\n  suffixes:\n    - o=sample\n",
+			"server.suffixes[0] configuration entry must contain a dn entry"),
+
+		Entry("a suffix with a key which is not a string",
+			testLicense + testAdmin + "server:\n  suffixes:\n    - 1: o=sample\n",
+			"server.suffixes[0].dn configuration entry is missing"),
+
+		Entry("a suffix without a DN",
+			testLicense + testAdmin + "server:\n  suffixes:\n    - cn: a\n",
+			"server.suffixes[0].dn configuration entry is missing"),
+
+		Entry("a suffix DN which is a list",
+			testLicense + testAdmin + "server:\n  suffixes:\n    - dn: [a]\n",
+			"server.suffixes[0].dn configuration entry must be a string"),
+	)
+})
+
+/*****************************************************************************/
+
+var _ = Describe("GetPort", func() {
+	DescribeTable("selects the port which is used to contact the server",
+		func(data string, port int32, secure bool) {
+			config, err := ParseConfig(data)
+
+			Expect(err).NotTo(HaveOccurred())
+
+			actualPort, actualSecure, err := config.GetPort("default")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actualPort).To(Equal(port))
+			Expect(actualSecure).To(Equal(secure))
+		},
+
+		Entry("the default port", "general: {}\n", DefaultLdapPort, false),
+		Entry("a custom LDAP port",
+			"general:\n  ports:\n    ldap: 1389\n", int32(1389), false),
+		Entry("a disabled LDAP port",
+			"general:\n  ports:\n    ldap: 0\n", DefaultLdapsPort, true),
+		Entry("a disabled LDAP port and a custom LDAPS port",
+			"general:\n  ports:\n    ldap: 0\n    ldaps: 1636\n",
+			int32(1636), true),
+	)
+})
+
+/*****************************************************************************/
+
@@ -14,6 +14,8 @@ package utils
 /*****************************************************************************/
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -23,6 +25,9 @@ import (
  */
 
 const PVCLabel        = "app.kubernetes.io/pvc-name"
+const SpecHashKey     = "ibm.com/spec-hash"
+const ZoneLabel       = "topology.kubernetes.io/zone"
+const ProxyZoneLabel  = "app.kubernetes.io/zone"
 var   ProxyCMKey      = "config.yaml"
 
 /*****************************************************************************/
@@ -39,11 +44,24 @@ func GetProxyDeploymentName(name string) string {
 /*****************************************************************************/
 
 /*
- * The following function is used to generate the ConfigMap name for the
- * proxy deployment.
+ * The following function is used to generate the name of the proxy 
+ * deployment, or proxy configuration Secret, for the specified zone.
  */
 
-func GetProxyConfigMapName(name string) string {
+func GetProxyZoneName(name string, zone string) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s", name, zone))
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to generate the name of the Secret which
+ * contains the generated configuration for the proxy deployment.  Earlier
+ * versions of the operator stored the generated configuration in a ConfigMap
+ * of the same name.
+ */
+
+func GetProxyConfigName(name string) string {
 	return strings.ToLower(fmt.Sprintf("%s-proxy", name))
 }
 
@@ -105,3 +123,53 @@ func LabelsForReplica(name string, pvc string) map[string]string {
 
 /*****************************************************************************/
 
+
+/*
+ * Generate a hash of the specified specification.  The hash is stored as an
+ * annotation on the resources which are created by the operator so that we
+ * can easily determine whether the specification of a resource has changed,
+ * without having to worry about the default values which are added by
+ * Kubernetes.
+ */
+
+func GetSpecHash(spec interface{}) string {
+	data, _ := json.Marshal(spec)
+
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+/*****************************************************************************/
+
+/*
+ * Determine whether the specified slice contains the specified value.
+ */
+
+func Contains(values []string, value string) bool {
+	for _, entry := range values {
+		if entry == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*****************************************************************************/
+
+/*
+ * Return a copy of the specified slice with the specified value removed.
+ */
+
+func Remove(values []string, value string) []string {
+	var result []string
+
+	for _, entry := range values {
+		if entry != value {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
+
+/*****************************************************************************/